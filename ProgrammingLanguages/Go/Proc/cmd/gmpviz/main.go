@@ -0,0 +1,245 @@
+// gmpviz 在终端中实时画出 GMP 调度器的状态
+//
+// 每个 P 的 runnext 和本地环形队列、全局队列、M 和它们正在运行的 G、
+// 自旋和空闲状态都画在一个屏幕上，按键单步执行或连续运行调度器。
+// 只使用 ANSI 转义序列，没有第三方依赖。
+//
+//	go run ./cmd/gmpviz -workload work-stealing
+//
+// 按键：
+//
+//	空格 / s  单步（一次调度决定）
+//	r        连续运行
+//	p        暂停
+//	g        新建一个 G
+//	+ / -    加快 / 减慢连续运行
+//	q        退出
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go-rem/gmp"
+)
+
+// epoch 是虚拟时钟的起点，界面上的时间都相对于它
+var epoch = time.Unix(0, 0)
+
+const (
+	maxEvents = 8
+	maxOutput = 6
+)
+
+func main() {
+	name := flag.String("workload", "work-stealing", "要观察的场景")
+	procs := flag.Int("procs", 0, "P 的数量，0 表示使用场景的默认值")
+	interval := flag.Duration("interval", 300*time.Millisecond, "连续运行时每一步的间隔")
+	plain := flag.Bool("plain", false, "不进入交互模式，单步执行到结束并依次输出每一帧（没有颜色）")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "用法: gmpviz [flags]\n\n场景:\n")
+		for _, w := range workloads {
+			fmt.Fprintf(os.Stderr, "  %-18s %s\n", w.name, w.desc)
+		}
+		fmt.Fprintf(os.Stderr, "\nflags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	w, err := findWorkload(*name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gmpviz:", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *procs > 0 {
+		w.procs = *procs
+	}
+
+	v, err := newViz(w)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gmpviz:", err)
+		os.Exit(1)
+	}
+	if *plain {
+		v.runPlain()
+		return
+	}
+	if err := v.runInteractive(*interval); err != nil {
+		fmt.Fprintln(os.Stderr, "gmpviz:", err)
+		os.Exit(1)
+	}
+}
+
+// viz 持有调度器之外的界面状态
+type viz struct {
+	workload workload
+	out      output
+	steps    int
+	spawned  int
+	done     bool
+	events   []gmp.Event
+}
+
+// newViz 用虚拟时钟初始化调度器并创建场景的初始 G
+// 虚拟时钟让 Sleep 不需要真的等待，单步时时间只随定时器前进
+func newViz(w workload) (*viz, error) {
+	err := gmp.InitWithConfig(gmp.Config{Procs: w.procs, Clock: gmp.NewVirtualClock(epoch)})
+	if err != nil {
+		return nil, err
+	}
+	v := &viz{workload: w}
+	w.start(&v.out)
+	return v, nil
+}
+
+// step 做一次调度决定
+func (v *viz) step() {
+	if v.done {
+		return
+	}
+	ev, ok := gmp.Step()
+	v.steps++
+	v.events = append(v.events, ev)
+	if len(v.events) > maxEvents {
+		v.events = v.events[1:]
+	}
+	v.done = !ok
+}
+
+// spawn 新建一个 G，调度循环结束后也可以继续单步
+func (v *viz) spawn() {
+	v.spawned++
+	v.workload.spawn(&v.out, v.spawned)
+	v.done = false
+}
+
+func (v *viz) frame(state string) *frame {
+	if v.done {
+		state = "done"
+	}
+	return &frame{
+		workload: v.workload,
+		si:       gmp.Snapshot(),
+		steps:    v.steps,
+		state:    state,
+		events:   v.events,
+		output:   v.out.tail(maxOutput),
+	}
+}
+
+// runPlain 单步执行到结束，每一步输出一帧
+func (v *viz) runPlain() {
+	r := &renderer{}
+	fmt.Print(r.render(v.frame("paused")))
+	for !v.done {
+		v.step()
+		fmt.Println(strings.Repeat("─", 60))
+		fmt.Print(r.render(v.frame("paused")))
+	}
+}
+
+// runInteractive 进入备用屏幕，按键控制调度器
+func (v *viz) runInteractive(interval time.Duration) error {
+	restore, err := makeRaw()
+	if err != nil {
+		return fmt.Errorf("cannot put terminal into raw mode (try -plain): %w", err)
+	}
+	fmt.Print("\x1b[?1049h\x1b[?25l") // 备用屏幕，隐藏光标
+	defer func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		restore()
+	}()
+
+	keys := make(chan byte)
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if n, err := os.Stdin.Read(buf); err != nil || n == 0 {
+				close(keys)
+				return
+			}
+			keys <- buf[0]
+		}
+	}()
+
+	r := &renderer{color: true}
+	running := false
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		state := "paused"
+		if running {
+			state = "running"
+		}
+		draw(r.render(v.frame(state)), interval)
+
+		select {
+		case k, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			switch k {
+			case ' ', 's':
+				running = false
+				v.step()
+			case 'r':
+				running = true
+			case 'p':
+				running = false
+			case 'g':
+				v.spawn()
+			case '+':
+				interval = max(interval/2, 10*time.Millisecond)
+				ticker.Reset(interval)
+			case '-':
+				interval = min(interval*2, 5*time.Second)
+				ticker.Reset(interval)
+			case 'q', 3: // 3 是 Ctrl-C，raw 模式下不会产生 SIGINT
+				return nil
+			}
+		case <-ticker.C:
+			if running {
+				v.step()
+				running = !v.done
+			}
+		}
+	}
+}
+
+// draw 从左上角重画整个屏幕
+// raw 模式下 \n 不会回到行首，所以换成 \r\n；每行末尾清除上一帧留下的字符
+func draw(s string, interval time.Duration) {
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for _, l := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		b.WriteString(l)
+		b.WriteString("\x1b[K\r\n")
+	}
+	fmt.Fprintf(&b, "\r\n\x1b[2m[空格] 单步  [r] 运行  [p] 暂停  [g] 新建 G  [+/-] 速度 (%v)  [q] 退出\x1b[0m\x1b[K\x1b[J", interval)
+	os.Stdout.WriteString(b.String())
+}
+
+// makeRaw 用 stty 把终端切换到 raw 模式，返回恢复原来设置的函数
+// 不依赖 golang.org/x/term
+func makeRaw() (func(), error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() { stty(strings.TrimSpace(state)) }, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
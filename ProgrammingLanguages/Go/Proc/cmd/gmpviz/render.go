@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"go-rem/gmp"
+)
+
+// ANSI 转义序列
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// 每个队列最多画出的槽位数，多出的部分用 "+N" 表示
+const maxSlots = 12
+
+// output 收集 workload 中 G 的输出
+// G 运行在自己的 goroutine 上，所以用锁保护
+type output struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (o *output) printf(format string, args ...any) {
+	o.mu.Lock()
+	o.lines = append(o.lines, fmt.Sprintf(format, args...))
+	o.mu.Unlock()
+}
+
+// tail 返回最后 n 行
+func (o *output) tail(n int) []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]string(nil), o.lines[max(0, len(o.lines)-n):]...)
+}
+
+// frame 是画一帧需要的全部状态
+type frame struct {
+	workload workload
+	si       gmp.SchedInfo
+	steps    int
+	state    string      // "paused"、"running"、"done"
+	events   []gmp.Event // 最近的调度事件，最新的在最后
+	output   []string
+}
+
+// renderer 把 frame 画成文本，color 为 false 时不输出任何转义序列
+type renderer struct {
+	color bool
+	b     strings.Builder
+}
+
+func (r *renderer) style(code, s string) string {
+	if !r.color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+func (r *renderer) line(format string, args ...any) {
+	fmt.Fprintf(&r.b, format, args...)
+	r.b.WriteByte('\n')
+}
+
+// slots 把 goid 画成一排格子：│G4│G5│G6│
+func (r *renderer) slots(ids []uint64, code string) string {
+	if len(ids) == 0 {
+		return r.style(ansiDim, "(empty)")
+	}
+	var b strings.Builder
+	b.WriteString("│")
+	for i, id := range ids {
+		if i == maxSlots {
+			fmt.Fprintf(&b, " +%d", len(ids)-maxSlots)
+			break
+		}
+		b.WriteString(r.style(code, fmt.Sprintf("G%d", id)))
+		b.WriteString("│")
+	}
+	return b.String()
+}
+
+func (r *renderer) render(f *frame) string {
+	r.b.Reset()
+	si := &f.si
+
+	r.line("%s  workload=%s  gomaxprocs=%d  t=%v  steps=%d  [%s]",
+		r.style(ansiBold, "GMP 调度器"), f.workload.name, si.Gomaxprocs,
+		si.Time.Sub(epoch), f.steps, r.stateString(f.state))
+	r.line("%s", r.style(ansiDim, f.workload.desc))
+	r.line("")
+
+	// P：runnext 和本地环形队列
+	for _, pi := range si.Procs {
+		status := fmt.Sprintf("%-7s", pi.Status) // 先补齐再上色，转义序列不占宽度
+		switch pi.Status {
+		case "running":
+			status = r.style(ansiGreen, status)
+		case "idle":
+			status = r.style(ansiDim, status)
+		case "syscall":
+			status = r.style(ansiYellow, status)
+		}
+		owner := "no M"
+		if pi.M >= 0 {
+			owner = fmt.Sprintf("M%d", pi.M)
+		}
+		r.line("%s %s %-5s schedtick=%d steals=%d globalgets=%d",
+			r.style(ansiBold, fmt.Sprintf("P%d", pi.ID)), status, owner, pi.SchedTick, pi.Steals, pi.GlobalGets)
+		runnext := r.style(ansiDim, "(empty)")
+		if pi.Runnext != 0 {
+			runnext = "┃" + r.style(ansiCyan, fmt.Sprintf("G%d", pi.Runnext)) + "┃"
+		}
+		r.line("   runnext %s", runnext)
+		r.line("   runq    %s  head=%d tail=%d %d/%d",
+			r.slots(pi.Runq, ansiCyan), pi.RunqHead%uint32(max(pi.RunqCap, 1)), pi.RunqTail%uint32(max(pi.RunqCap, 1)),
+			len(pi.Runq), pi.RunqCap)
+	}
+	r.line("")
+	r.line("%s  %s", r.style(ansiBold, "全局队列"), r.slots(si.GlobalRunq, ansiCyan))
+	if len(si.Netpoll) > 0 {
+		r.line("%s   %s", r.style(ansiBold, "netpoll"), r.slots(si.Netpoll, ansiCyan))
+	}
+	r.line("")
+
+	// M：持有的 P、当前的 G、自旋或空闲
+	for _, mi := range si.Ms {
+		parts := []string{r.style(ansiBold, fmt.Sprintf("M%d", mi.ID))}
+		if mi.P >= 0 {
+			parts = append(parts, fmt.Sprintf("P%d", mi.P))
+		}
+		if mi.Curg != 0 {
+			parts = append(parts, "curg="+r.style(ansiGreen, fmt.Sprintf("G%d", mi.Curg)))
+		}
+		switch {
+		case mi.Spinning:
+			parts = append(parts, r.style(ansiYellow, "spinning"))
+		case mi.Idle:
+			parts = append(parts, r.style(ansiDim, "idle"))
+		}
+		r.line("%s", strings.Join(parts, "  "))
+	}
+	r.line("空闲 P: %v   空闲 M: %v   syscall=%d timers=%d", si.IdleProcs, si.IdleMs, si.NumSyscall, si.NumTimers)
+	r.line("")
+
+	// 等待中的 G
+	var waiting []string
+	for _, gi := range si.Gs {
+		if gi.Status == "waiting" || gi.Status == "syscall" {
+			what := gi.WaitReason
+			if what == "" {
+				what = gi.Status
+			}
+			waiting = append(waiting, fmt.Sprintf("G%d(%s)", gi.Goid, what))
+		}
+	}
+	r.line("%s  %d 个 G  等待中: %s", r.style(ansiBold, "G"), len(si.Gs), strings.Join(waiting, " "))
+	r.line("")
+
+	r.line("%s", r.style(ansiBold, "调度事件"))
+	for i, ev := range f.events {
+		r.line("  %4d  %s", f.steps-len(f.events)+i+1, r.eventString(ev))
+	}
+	r.line("")
+	r.line("%s", r.style(ansiBold, "输出"))
+	for _, l := range f.output {
+		r.line("  %s", l)
+	}
+	return r.b.String()
+}
+
+func (r *renderer) stateString(state string) string {
+	switch state {
+	case "running":
+		return r.style(ansiGreen, state)
+	case "done":
+		return r.style(ansiYellow, state)
+	}
+	return state
+}
+
+func (r *renderer) eventString(ev gmp.Event) string {
+	s := ev.String()
+	switch {
+	case ev.Err != nil:
+		return r.style(ansiRed, s)
+	case ev.Source == "steal":
+		return r.style(ansiYellow, s)
+	case ev.Kind != gmp.EventRun:
+		return r.style(ansiDim, s)
+	}
+	return s
+}
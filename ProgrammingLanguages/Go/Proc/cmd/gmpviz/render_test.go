@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWorkloadsRunToCompletion(t *testing.T) {
+	for _, w := range workloads {
+		t.Run(w.name, func(t *testing.T) {
+			v, err := newViz(w)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v.spawn()
+			for !v.done {
+				if v.steps > 1000 {
+					t.Fatal("场景没有结束")
+				}
+				v.step()
+			}
+			last := v.events[len(v.events)-1]
+			if last.Err != nil {
+				t.Fatalf("场景以错误结束: %v", last.Err)
+			}
+			if out := v.out.tail(maxOutput); len(out) == 0 {
+				t.Error("场景应该有输出")
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	w, err := findWorkload("work-stealing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := newViz(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := (&renderer{}).render(v.frame("paused"))
+	if strings.Contains(plain, "\x1b[") {
+		t.Error("没有颜色时不应该输出转义序列")
+	}
+	// 10 个 G 都在 P0 上创建：最后一个在 runnext，其余 9 个在环形队列中
+	for _, want := range []string{"P0 running M0", "runnext ┃G", "head=0 tail=9 9/256", "P1 idle", "全局队列  (empty)"} {
+		if !strings.Contains(plain, want) {
+			t.Errorf("画面中应该有 %q:\n%s", want, plain)
+		}
+	}
+
+	for !v.done {
+		v.step()
+	}
+	colored := (&renderer{color: true}).render(v.frame("running"))
+	if !strings.Contains(colored, ansiYellow+"done"+ansiReset) {
+		t.Errorf("结束后状态应该是 done:\n%s", colored)
+	}
+	if !strings.Contains(colored, "stole") {
+		t.Errorf("调度事件中应该有窃取:\n%s", colored)
+	}
+}
+
+func TestFindWorkload(t *testing.T) {
+	if _, err := findWorkload("nope"); err == nil {
+		t.Error("未知的场景应该返回错误")
+	}
+}
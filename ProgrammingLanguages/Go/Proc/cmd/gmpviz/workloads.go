@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"go-rem/gmp"
+	gmpsync "go-rem/gmp/sync"
+)
+
+// workload 是一个可以在 gmpviz 中观察的场景，来自 examples 目录下的示例
+// 示例直接打印到标准输出，这里改为写入 out，显示在输出面板中
+type workload struct {
+	name  string
+	desc  string
+	procs int
+	// start 创建初始的 G
+	start func(out *output)
+	// spawn 创建按 g 键新增的第 n 个 G
+	spawn func(out *output, n int)
+}
+
+var workloads = []workload{
+	{
+		name:  "basic",
+		desc:  "examples/basic：三个独立的 G",
+		procs: 1,
+		start: func(out *output) {
+			gmp.Go(func() {
+				out.printf("Goroutine 1: Hello from G1!")
+			})
+			gmp.Go(func() {
+				out.printf("Goroutine 2: Hello from G2!")
+			})
+			gmp.Go(func() {
+				sum := 0
+				for i := 1; i <= 10; i++ {
+					sum += i
+				}
+				out.printf("Goroutine 3: Sum of 1-10 = %d", sum)
+			})
+		},
+		spawn: task,
+	},
+	{
+		name:  "producer-consumer",
+		desc:  "examples/producer-consumer：容量为 2 的缓冲区，生产者和消费者在 Cond 上 park",
+		procs: 2,
+		start: producerConsumer,
+		spawn: task,
+	},
+	{
+		name:  "work-stealing",
+		desc:  "examples/work-stealing：10 个 G 都在 P0 上创建，P1 从 P0 窃取一半",
+		procs: 2,
+		start: func(out *output) {
+			for i := 1; i <= 10; i++ {
+				taskID := i
+				gmp.Go(func() {
+					out.printf("Task %d: %d * %d = %d", taskID, taskID, taskID, taskID*taskID)
+				})
+			}
+		},
+		spawn: task,
+	},
+	{
+		name:  "timers",
+		desc:  "G 在 Sleep 中 park，定时器到期后经全局队列回到 P 上",
+		procs: 2,
+		start: func(out *output) {
+			for i := 1; i <= 4; i++ {
+				id := i
+				gmp.Go(func() {
+					for j := 0; j < 2; j++ {
+						gmp.Sleep(time.Duration(id) * time.Millisecond)
+						out.printf("sleeper %d: woke up at %v", id, gmp.Since(epoch))
+					}
+				})
+			}
+		},
+		spawn: task,
+	},
+}
+
+// task 是按 g 键新增的 G：先 Sleep 一下，让它在队列和定时器之间走一圈
+func task(out *output, n int) {
+	gmp.Go(func() {
+		gmp.Sleep(time.Millisecond)
+		out.printf("spawned %d: done", n)
+	})
+}
+
+// producerConsumer 是 examples/producer-consumer 的阻塞版本
+func producerConsumer(out *output) {
+	const (
+		producers = 3
+		items     = 3
+		capacity  = 2
+	)
+	var (
+		mu       gmpsync.Mutex
+		cond     = gmpsync.NewCond(&mu)
+		buf      []int
+		consumed int
+	)
+	for i := 1; i <= producers; i++ {
+		producerID := i
+		gmp.Go(func() {
+			for j := 0; j < items; j++ {
+				value := producerID*10 + j
+				mu.Lock()
+				for len(buf) == capacity {
+					cond.Wait()
+				}
+				buf = append(buf, value)
+				cond.Broadcast()
+				mu.Unlock()
+				out.printf("生产者 %d: 生产了数据 %d", producerID, value)
+				gmp.Sleep(time.Millisecond)
+			}
+		})
+	}
+	for i := 1; i <= 2; i++ {
+		consumerID := i
+		gmp.Go(func() {
+			for {
+				mu.Lock()
+				for len(buf) == 0 && consumed < producers*items {
+					cond.Wait()
+				}
+				if consumed == producers*items {
+					mu.Unlock()
+					return
+				}
+				value := buf[0]
+				buf = buf[1:]
+				consumed++
+				cond.Broadcast()
+				mu.Unlock()
+				out.printf("消费者 %d: 消费了数据 %d", consumerID, value)
+			}
+		})
+	}
+}
+
+func findWorkload(name string) (workload, error) {
+	for _, w := range workloads {
+		if w.name == name {
+			return w, nil
+		}
+	}
+	return workload{}, fmt.Errorf("unknown workload %q", name)
+}
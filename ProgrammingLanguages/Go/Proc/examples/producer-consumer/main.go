@@ -1,21 +1,42 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"go-rem/gmp"
+	gmpsync "go-rem/gmp/sync"
+	"log"
 )
 
-var sharedData []int
+// sharedData 在所有生产者和消费者之间共享
+// 用 gmp.Var 包装后，每次读写都会报告给竞争检测器
+var sharedData gmp.Var[[]int]
 
 func main() {
-	gmp.Init()
-	fmt.Println("=== 生产者-消费者模式示例 ===\n")
+	lock := flag.Bool("mutex", false, "用 gmpsync.Mutex 保护 sharedData，消除数据竞争")
+	flag.Parse()
+
+	if err := gmp.InitWithConfig(gmp.Config{Race: true}); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print("=== 生产者-消费者模式示例 ===\n\n")
+
+	var mu gmpsync.Mutex
+	withLock := func(f func()) {
+		if *lock {
+			mu.Lock()
+			defer mu.Unlock()
+		}
+		f()
+	}
 
 	for i := 1; i <= 3; i++ {
 		producerID := i
 		gmp.Go(func() {
 			value := producerID * 10
-			sharedData = append(sharedData, value)
+			withLock(func() {
+				sharedData.Store(append(sharedData.Load(), value))
+			})
 			fmt.Printf("生产者 %d: 生产了数据 %d\n", producerID, value)
 		})
 	}
@@ -23,15 +44,18 @@ func main() {
 	for i := 1; i <= 2; i++ {
 		consumerID := i
 		gmp.Go(func() {
-			if len(sharedData) > 0 {
-				fmt.Printf("消费者 %d: 准备消费数据\n", consumerID)
-			}
+			withLock(func() {
+				if len(sharedData.Load()) > 0 {
+					fmt.Printf("消费者 %d: 准备消费数据\n", consumerID)
+				}
+			})
 		})
 	}
 
-	fmt.Println("开始调度...\n")
+	fmt.Print("开始调度...\n\n")
+	// 不加 -mutex 时，Run 在标准错误输出 WARNING: DATA RACE 报告
 	gmp.Run()
 
-	fmt.Printf("\n最终数据: %v\n", sharedData)
+	fmt.Printf("\n最终数据: %v\n", sharedData.Load())
 	fmt.Println("所有任务完成！")
 }
@@ -1,17 +1,33 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"go-rem/gmp"
+	"log"
 	"os"
 )
 
 func main() {
+	traceFile := flag.String("trace", "", "把执行追踪写入文件（Chrome Trace 格式，可用 Perfetto 打开）")
+	flag.Parse()
+
 	os.Setenv("GOMAXPROCS", "2")
 	gmp.Init()
 
-	fmt.Println("=== 工作窃取示例（GOMAXPROCS=2）===\n")
-	fmt.Println("创建 10 个 Goroutine，观察它们如何在 2 个 P 之间调度...\n")
+	if *traceFile != "" {
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		if err := gmp.StartTrace(f); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fmt.Print("=== 工作窃取示例（GOMAXPROCS=2）===\n\n")
+	fmt.Print("创建 10 个 Goroutine，观察它们如何在 2 个 P 之间调度...\n\n")
 
 	for i := 1; i <= 10; i++ {
 		taskID := i
@@ -22,9 +38,16 @@ func main() {
 	}
 
 	fmt.Printf("创建后队列中的 G 数量: %d\n\n", gmp.GetGCount())
-	fmt.Println("开始调度...\n")
+	fmt.Print("开始调度...\n\n")
 	gmp.Run()
 
+	if *traceFile != "" {
+		if err := gmp.StopTrace(); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("\n执行追踪已写入 %s，可以在 https://ui.perfetto.dev 中打开，P1 轨道上的 Steal 事件就是工作窃取\n", *traceFile)
+	}
+
 	fmt.Println("\n所有任务完成！")
 	fmt.Println("注意：由于工作窃取机制，任务执行顺序可能不同于创建顺序")
 }
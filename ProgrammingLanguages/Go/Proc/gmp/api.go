@@ -1,7 +1,13 @@
 package gmp
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"sync"
+	"time"
 )
 
 // 导出的 API，供外部使用
@@ -11,50 +17,217 @@ var (
 	initOnce    sync.Once
 )
 
+// Config 是调度器的配置，GMPDEBUG 环境变量中的配置项会覆盖它，见 config_rem.go
+type Config struct {
+	// Procs 是 P 的数量，0 表示读取 GOMAXPROCS 环境变量（默认 CPU 核数）
+	Procs int
+	// LocalQueueSize 是每个 P 的本地队列的长度，必须是 2 的幂，0 表示 256
+	LocalQueueSize int
+	// MaxThreads 是 M 的数量上限，不能小于 Procs，0 表示 10000
+	MaxThreads int
+	// TimeSlice 是从 runnext 接连运行的 G 共享的时间片，用完后 runnext 中的 G 排到本地队列尾部，
+	// 0 表示 10ms
+	TimeSlice time.Duration
+	// SpinLimit 是同时自旋（寻找工作）的 M 的数量上限，0 表示 1
+	SpinLimit int
+	// Policy 是可运行的 G 放入哪个队列的策略，见 PolicyDefault
+	Policy Policy
+	// Clock 是调度器的时间源，nil 表示真实时间
+	Clock Clock
+	// DumpOnSIGQUIT 为 true 时，进程收到 SIGQUIT 会把 Stack(true) 输出到标准错误
+	// 与 runtime 不同，输出后进程继续运行
+	DumpOnSIGQUIT bool
+	// FailOnLeak 为 true 时，如果 Run 返回时还有 G 处于等待或可运行状态，
+	// RunE 返回 *LeakError，Run 以它 panic
+	FailOnLeak bool
+	// Seed 不为 0 时，调度器在有多个选择的地方（下一个运行的 M、窃取的起点、
+	// 同时就绪的 G 的唤醒顺序）按以 Seed 为种子的伪随机数选择，
+	// 同一个 Seed 总是得到同一个交错顺序。0 表示总是选第一个
+	Seed int64
+	// Record 不为 nil 时，每个调度决定都写入 Record，用 Replay 可以重现完全相同的调度
+	Record io.Writer
+	// Race 为 true 时开启数据竞争检测，用 RaceRead/RaceWrite 或 Var 标注共享变量的访问。
+	// 发现竞争时 RunE 返回 *RaceError，Run 把报告输出到标准错误
+	Race bool
+
+	debug dbgvars // resolve 从 GMPDEBUG 读取的调试变量
+}
+
 // Init 初始化 GMP 调度器
-// 必须在使用 Go() 之前调用一次
+// 必须在使用 Go() 之前调用一次。环境变量中的配置不合法时以 *ConfigError panic
 func Init() {
-	initOnce.Do(func() {
-		schedinit()
-		initialized = true
+	defaultSched.do(func() {
+		initOnce.Do(func() {
+			sched.cfg = Config{}
+			schedinit()
+			initialized = true
+		})
 	})
 }
 
+// InitWithConfig 按 cfg 初始化 GMP 调度器
+// 与 Init 不同，它可以在两次 Run 之间重复调用，每次都会重建调度器
+func InitWithConfig(cfg Config) error {
+	if _, err := cfg.resolve(); err != nil {
+		return err
+	}
+	var err error
+	defaultSched.do(func() { err = initWithConfig(cfg) })
+	return err
+}
+
+func initWithConfig(cfg Config) error {
+	if sched.running {
+		return errors.New("gmp: InitWithConfig called while the scheduler is running")
+	}
+	initOnce.Do(func() {})
+
+	// 重新初始化之前的 G 不会再运行
+	if initialized {
+		gostopall()
+	}
+	sched.cfg = cfg
+	sched.allp = nil
+	sched.runq = nil
+	sched.pidle = nil
+	schedinit()
+	initialized = true
+
+	if cfg.DumpOnSIGQUIT {
+		installSigquit()
+	} else {
+		uninstallSigquit()
+	}
+	return nil
+}
+
 // Go 创建一个新的 Goroutine 来执行 fn
 // 类似于 go func() { ... }
+// 在 G 中调用时 G 属于运行它的调度器实例，否则属于默认实例
 func Go(fn func()) {
-	if !initialized {
-		panic("gmp.Init() must be called before gmp.Go()")
+	s, inside := curowned()
+	if err := s.gonew(inside, []func(){fn}, callerpc(), false, false); err != nil {
+		panic(err)
+	}
+}
+
+// GoBatch 为 fns 中的每个函数创建一个 Goroutine，一次放入队列并为它们启动空闲的 P，见 Scheduler.GoBatch
+func GoBatch(fns []func()) {
+	s, inside := curowned()
+	if err := s.gonew(inside, fns, callerpc(), false, true); err != nil {
+		panic(err)
 	}
-	newproc(fn)
+}
+
+// TryGo 与 Go 相同，但出错时返回 *SchedError 而不是 panic，见 Scheduler.TryGo
+func TryGo(fn func()) error {
+	s, inside := curowned()
+	return s.gonew(inside, []func(){fn}, callerpc(), true, false)
+}
+
+// GoContext 创建一个新的 Goroutine 来执行 fn(ctx)
+// 如果 G 开始运行时 ctx 已经被取消，fn 不会被调用；开始之后 GoContext 不再检查 ctx。
+// fn 要用 gmp/context 的 Wait、Sleep 等待 ctx（不能阻塞在 ctx.Done() 上），
+// 取消 ctx 时它们会唤醒 park 在 ctx 上的 G
+func GoContext(ctx context.Context, fn func(context.Context)) {
+	Go(func() {
+		if ctx.Err() != nil {
+			return
+		}
+		fn(ctx)
+	})
 }
 
 // Run 启动调度器并运行所有 Goroutine
-// 这个函数会阻塞直到所有 G 执行完毕
+// 这个函数会阻塞直到所有 G 执行完毕。
+// 如果剩下的 G 全部阻塞、再也不可能被唤醒，与 runtime 一样输出
+// "fatal error: all goroutines are asleep - deadlock!" 和 Goroutine 转储，并以状态码 2 退出。
+// 发现数据竞争时把报告输出到标准错误后返回
 func Run() {
-	if !initialized {
-		panic("gmp.Init() must be called before gmp.Run()")
+	if err := RunE(); err != nil {
+		runfatal(err)
 	}
-	schedule()
+}
+
+// runfatal 按 Run 的约定报告 RunE 返回的错误
+func runfatal(err error) {
+	var de *DeadlockError
+	if errors.As(err, &de) {
+		fmt.Fprintf(os.Stderr, "fatal error: %s\n\n%s", de.Error(), de.Dump)
+		os.Exit(2)
+	}
+	var re *RaceError
+	if errors.As(err, &re) {
+		// 与 runtime 不同，输出报告后程序继续运行
+		for _, r := range re.Races {
+			fmt.Fprintf(os.Stderr, "==================\n%s==================\n", r)
+		}
+		fmt.Fprintf(os.Stderr, "Found %d data race(s)\n", len(re.Races))
+		return
+	}
+	panic(err)
+}
+
+// RunE 与 Run 相同，但检测到死锁时返回 *DeadlockError 而不是退出进程，
+// 设置了 Config.FailOnLeak 时还可能返回 *LeakError，设置了 Config.Race 时还可能返回 *RaceError。
+// 没有初始化或者 M 的数量超过 Config.MaxThreads 时返回 *SchedError 而不是 panic。
+// 阻塞的 G 仍然保持 park 状态，直到下一次 InitWithConfig 重置调度器
+func RunE() error {
+	return defaultSched.RunE()
+}
+
+// rune 运行调度循环并检查结果，调用者必须已经装入调度器实例
+func rune() error {
+	if err := schedule(); err != nil {
+		return err
+	}
+	if sched.deadlock != nil {
+		// 阻塞的 G 再也不会被唤醒，结束它们的协程；G 的记录留给 Leaks 和 Stack
+		gostopall()
+	}
+
+	sched.lock.Lock()
+	defer sched.lock.Unlock()
+	if sched.fatal != nil {
+		return sched.fatal
+	}
+	if sched.deadlock != nil {
+		return sched.deadlock
+	}
+	if sched.decide.err != nil {
+		return sched.decide.err
+	}
+	if races := sched.race.races; len(races) > 0 {
+		sched.race.races = nil
+		return &RaceError{Races: races}
+	}
+	if sched.cfg.FailOnLeak {
+		return leakcheck()
+	}
+	return nil
 }
 
 // GetGCount 获取当前队列中 G 的数量（用于调试）
 func GetGCount() int {
-	if !initialized {
-		return 0
-	}
+	total := 0
+	current().do(func() {
+		if !initialized {
+			return
+		}
+		sched.lock.Lock()
+		defer sched.lock.Unlock()
 
-	total := len(sched.runq) // 全局队列
+		total = len(sched.runq) // 全局队列
 
-	// 加上所有 P 的本地队列
-	for _, pp := range sched.allp {
-		if pp != nil {
-			total += int(pp.runqtail - pp.runqhead)
-			if pp.runnext != nil {
-				total++
+		// 加上所有 P 的本地队列
+		for _, pp := range sched.allp {
+			if pp != nil {
+				total += int(pp.runqtail - pp.runqhead)
+				if pp.runnext != nil {
+					total++
+				}
 			}
 		}
-	}
-
+	})
 	return total
 }
@@ -0,0 +1,204 @@
+package gmp
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// ============ 配置 ============
+//
+// Config 中为 0 的字段使用默认值。GOMAXPROCS 环境变量与 runtime 一样提供 Procs 的默认值，
+// GMPDEBUG 中的配置项（procs、runqsize、maxthreads、timeslice、spinlimit、policy）
+// 覆盖 Config 中的值，方便在不改代码的情况下做参数扫描。GMPDEBUG 由 parsegmpdebug 统一解析：
+//
+//	GMPDEBUG=runqsize=64,timeslice=2ms,policy=fifo go test ./...
+
+const (
+	defaultLocalQueueSize = 256                   // runtime 中 p.runq 的长度
+	defaultMaxThreads     = 10000                 // runtime 的 sched.maxmcount
+	defaultTimeSlice      = 10 * time.Millisecond // runtime 的 forcePreemptNS
+	defaultSpinLimit      = 1                     // runtime 的 wakep 只在没有自旋的 M 时启动 M
+)
+
+// Policy 是把可运行的 G 放入哪个队列的策略
+type Policy int
+
+const (
+	// PolicyDefault 与 runtime 相同：新建和唤醒的 G 放入 runnext，本地队列满了才放入全局队列，
+	// 空闲的 P 从其他 P 窃取
+	PolicyDefault Policy = iota
+	// PolicyFIFO 不使用 runnext，新建和唤醒的 G 排在本地队列的尾部
+	PolicyFIFO
+	// PolicyGlobal 只使用一个全局队列，没有本地队列和工作窃取，相当于 Go 1.0 的 GM 模型
+	PolicyGlobal
+)
+
+var policyNames = [...]string{
+	PolicyDefault: "default",
+	PolicyFIFO:    "fifo",
+	PolicyGlobal:  "global",
+}
+
+func (pol Policy) String() string {
+	if pol < 0 || int(pol) >= len(policyNames) {
+		return "Policy(" + strconv.Itoa(int(pol)) + ")"
+	}
+	return policyNames[pol]
+}
+
+// ConfigError 表示 Config 的某个字段或覆盖它的环境变量不合法
+type ConfigError struct {
+	Field  string // 例如 "Config.LocalQueueSize"、"GOMAXPROCS"、"GMPDEBUG runqsize"
+	Value  string
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("gmp: invalid %s=%s: %s", e.Field, e.Value, e.Reason)
+}
+
+// resolve 应用环境变量、填入默认值并检查每个字段，返回最终使用的配置
+func (cfg Config) resolve() (Config, error) {
+	if cfg.Procs == 0 {
+		cfg.Procs = runtime.NumCPU()
+		if v := os.Getenv("GOMAXPROCS"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return cfg, &ConfigError{"GOMAXPROCS", v, "must be a positive integer"}
+			}
+			cfg.Procs = n
+		}
+	}
+	from, err := parsegmpdebug(os.Getenv("GMPDEBUG"), &cfg)
+	if err != nil {
+		return cfg, err
+	}
+
+	if cfg.LocalQueueSize == 0 {
+		cfg.LocalQueueSize = defaultLocalQueueSize
+	}
+	if cfg.MaxThreads == 0 {
+		cfg.MaxThreads = defaultMaxThreads
+	}
+	if cfg.TimeSlice == 0 {
+		cfg.TimeSlice = defaultTimeSlice
+	}
+	if cfg.SpinLimit == 0 {
+		cfg.SpinLimit = defaultSpinLimit
+	}
+	return cfg, cfg.validate(from)
+}
+
+// override 用 GMPDEBUG 中的一项配置覆盖 cfg，并立即检查这个字段，返回被覆盖的字段名
+// key 不是配置项时返回空字符串。值不合法时错误的字段名是 "GMPDEBUG key"
+func (cfg *Config) override(key, value string) (string, error) {
+	bad := func(reason string) error {
+		return &ConfigError{"GMPDEBUG " + key, value, reason}
+	}
+	var field string
+	var dst *int
+	switch key {
+	case "procs":
+		field, dst = "Procs", &cfg.Procs
+	case "runqsize":
+		field, dst = "LocalQueueSize", &cfg.LocalQueueSize
+	case "maxthreads":
+		field, dst = "MaxThreads", &cfg.MaxThreads
+	case "spinlimit":
+		field, dst = "SpinLimit", &cfg.SpinLimit
+	case "timeslice":
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return "", bad("must be a duration such as 10ms")
+		}
+		field, cfg.TimeSlice = "TimeSlice", d
+	case "policy":
+		pol, ok := parsepolicy(value)
+		if !ok {
+			return "", bad("must be one of default, fifo, global")
+		}
+		field, cfg.Policy = "Policy", pol
+	default:
+		return "", nil
+	}
+	if dst != nil {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return "", bad("must be an integer")
+		}
+		*dst = n
+	}
+	if _, reason := cfg.checkfield(field); reason != "" {
+		return "", bad(reason)
+	}
+	return field, nil
+}
+
+func parsepolicy(name string) (Policy, bool) {
+	for pol, s := range policyNames {
+		if s == name {
+			return Policy(pol), true
+		}
+	}
+	return 0, false
+}
+
+// configFields 是 validate 逐个检查的字段
+var configFields = []string{"Procs", "LocalQueueSize", "MaxThreads", "TimeSlice", "SpinLimit", "Policy"}
+
+// checkfield 检查 cfg 的一个字段自身的约束，不合法时返回它的值和原因，合法时原因为空
+// MaxThreads 不能小于 Procs 涉及两个字段，由 validate 检查
+func (cfg Config) checkfield(field string) (any, string) {
+	switch field {
+	case "Procs":
+		if cfg.Procs <= 0 {
+			return cfg.Procs, "must be positive"
+		}
+	case "LocalQueueSize":
+		if cfg.LocalQueueSize <= 0 || cfg.LocalQueueSize&(cfg.LocalQueueSize-1) != 0 {
+			// runqhead 和 runqtail 是回绕的 uint32，下标取模要求长度整除 2^32
+			return cfg.LocalQueueSize, "must be a power of two"
+		}
+	case "MaxThreads":
+		if cfg.MaxThreads <= 0 {
+			return cfg.MaxThreads, "must be positive"
+		}
+	case "TimeSlice":
+		if cfg.TimeSlice < 0 {
+			return cfg.TimeSlice, "must not be negative"
+		}
+	case "SpinLimit":
+		if cfg.SpinLimit < 0 {
+			return cfg.SpinLimit, "must not be negative"
+		}
+	case "Policy":
+		if cfg.Policy < 0 || int(cfg.Policy) >= len(policyNames) {
+			return cfg.Policy, "unknown policy"
+		}
+	}
+	return nil, ""
+}
+
+// validate 检查 resolve 之后的配置
+// from 记录哪些字段被 GMPDEBUG 覆盖，这些字段的错误以 "GMPDEBUG key" 报告
+func (cfg Config) validate(from map[string]string) error {
+	bad := func(field string, value any, reason string) error {
+		name := "Config." + field
+		if key, ok := from[field]; ok {
+			name = "GMPDEBUG " + key
+		}
+		return &ConfigError{name, fmt.Sprint(value), reason}
+	}
+	for _, field := range configFields {
+		if value, reason := cfg.checkfield(field); reason != "" {
+			return bad(field, value, reason)
+		}
+	}
+	if cfg.MaxThreads < cfg.Procs {
+		return bad("MaxThreads", cfg.MaxThreads, fmt.Sprintf("must be at least Procs (%d), every P needs an M", cfg.Procs))
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package gmp
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func configErr(t *testing.T, err error) *ConfigError {
+	t.Helper()
+	var ce *ConfigError
+	if !errors.As(err, &ce) {
+		t.Fatalf("应该返回 *ConfigError，实际为 %v", err)
+	}
+	return ce
+}
+
+func TestConfigInvalid(t *testing.T) {
+	tests := []struct {
+		cfg   Config
+		field string
+	}{
+		{Config{Procs: -1}, "Config.Procs"},
+		{Config{Procs: 2, LocalQueueSize: 100}, "Config.LocalQueueSize"},
+		{Config{Procs: 2, LocalQueueSize: -4}, "Config.LocalQueueSize"},
+		{Config{Procs: 4, MaxThreads: 2}, "Config.MaxThreads"},
+		{Config{Procs: 2, TimeSlice: -time.Millisecond}, "Config.TimeSlice"},
+		{Config{Procs: 2, SpinLimit: -1}, "Config.SpinLimit"},
+		{Config{Procs: 2, Policy: Policy(7)}, "Config.Policy"},
+	}
+	for _, tt := range tests {
+		ce := configErr(t, InitWithConfig(tt.cfg))
+		if ce.Field != tt.field {
+			t.Errorf("%+v: 错误的字段应该是 %s，实际为 %v", tt.cfg, tt.field, ce)
+		}
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	if err := InitWithConfig(Config{Procs: 2}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := sched.cfg
+	if cfg.LocalQueueSize != 256 || cfg.MaxThreads != 10000 || cfg.TimeSlice != 10*time.Millisecond || cfg.SpinLimit != 1 {
+		t.Errorf("默认值错误: %+v", cfg)
+	}
+	if got := len(sched.allp[0].runq); got != 256 {
+		t.Errorf("本地队列的长度应该是 256，实际为 %d", got)
+	}
+}
+
+func TestConfigEnv(t *testing.T) {
+	t.Setenv("GOMAXPROCS", "0")
+	if ce := configErr(t, InitWithConfig(Config{})); ce.Field != "GOMAXPROCS" {
+		t.Errorf("错误的字段应该是 GOMAXPROCS: %v", ce)
+	}
+	t.Setenv("GOMAXPROCS", "3")
+	if err := InitWithConfig(Config{}); err != nil || len(sched.allp) != 3 {
+		t.Fatalf("GOMAXPROCS 应该提供 Procs 的默认值: %v, %d", err, len(sched.allp))
+	}
+
+	// GMPDEBUG 中的配置项覆盖 Config
+	t.Setenv("GMPDEBUG", "procs=2,runqsize=8,timeslice=1ms,policy=fifo,schedtrace=0")
+	if err := InitWithConfig(Config{Procs: 4, LocalQueueSize: 64}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := sched.cfg; cfg.Procs != 2 || cfg.LocalQueueSize != 8 || cfg.TimeSlice != time.Millisecond || cfg.Policy != PolicyFIFO {
+		t.Errorf("GMPDEBUG 没有覆盖配置: %+v", cfg)
+	}
+	if len(sched.allp) != 2 || len(sched.allp[0].runq) != 8 {
+		t.Errorf("P 的数量和本地队列长度错误")
+	}
+
+	// 来自 GMPDEBUG 的值以 GMPDEBUG 中的名字报告
+	for v, field := range map[string]string{
+		"runqsize=x":    "GMPDEBUG runqsize",
+		"timeslice=10":  "GMPDEBUG timeslice",
+		"policy=lifo":   "GMPDEBUG policy",
+		"runqsize=12":   "GMPDEBUG runqsize",
+		"procs=0":       "GMPDEBUG procs",
+		"timeslice=-1s": "GMPDEBUG timeslice",
+		"maxthreads=1":  "GMPDEBUG maxthreads",
+		"procs":         "GMPDEBUG",
+	} {
+		t.Setenv("GMPDEBUG", v)
+		ce := configErr(t, InitWithConfig(Config{Procs: 2}))
+		if ce.Field != field {
+			t.Errorf("GMPDEBUG=%s: 错误的字段应该是 %s，实际为 %v", v, field, ce)
+		}
+	}
+}
+
+func TestLocalQueueSize(t *testing.T) {
+	s, err := New(Config{Procs: 1, LocalQueueSize: 4, Clock: NewVirtualClock(epoch)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	n := 0
+	for i := 0; i < 10; i++ {
+		s.Go(func() { n++ })
+	}
+	si := s.Snapshot()
+	if si.Procs[0].RunqCap != 4 || len(si.GlobalRunq) == 0 {
+		t.Errorf("本地队列满了之后应该放入全局队列: %+v", si)
+	}
+	s.Run()
+	if n != 10 {
+		t.Errorf("n = %d", n)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	// 同一段程序在三种策略下的运行顺序
+	order := func(pol Policy) []int {
+		s, err := New(Config{Procs: 1, Policy: pol, Clock: NewVirtualClock(epoch)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		var got []int
+		for i := 0; i < 3; i++ {
+			s.Go(func() { got = append(got, i) })
+		}
+		if si := s.Snapshot(); pol == PolicyGlobal && len(si.GlobalRunq) != 3 {
+			t.Errorf("PolicyGlobal 应该只使用全局队列: %+v", si)
+		}
+		s.Run()
+		return got
+	}
+	want := map[Policy][3]int{
+		PolicyDefault: {2, 0, 1}, // 最后创建的 G 在 runnext 中
+		PolicyFIFO:    {0, 1, 2},
+		PolicyGlobal:  {0, 1, 2},
+	}
+	for pol, w := range want {
+		if got := order(pol); len(got) != 3 || [3]int(got) != w {
+			t.Errorf("%v: 运行顺序应该是 %v，实际为 %v", pol, w, got)
+		}
+	}
+}
+
+func TestTimeSlice(t *testing.T) {
+	// 两个 G 通过信号量互相唤醒，每一轮推进 1ms。第三个 G 在 runnext 被占用后只能排队，
+	// 时间片用完之前一直轮不到它
+	starved := func(slice time.Duration) int {
+		clk := NewVirtualClock(epoch)
+		s, err := New(Config{Procs: 1, TimeSlice: slice, Clock: clk})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		var sa, sb uint32
+		rounds, ran := 0, -1
+		s.Go(func() {
+			Go(func() { ran = rounds })
+			Go(func() {
+				for i := 0; i < 20; i++ {
+					Semacquire(&sb)
+					Semrelease(&sa, false)
+				}
+			})
+			for i := 0; i < 20; i++ {
+				rounds++
+				clk.Advance(time.Millisecond)
+				Semrelease(&sb, false)
+				Semacquire(&sa)
+			}
+		})
+		if err := s.RunE(); err != nil {
+			t.Fatal(err)
+		}
+		return ran
+	}
+	if r := starved(time.Hour); r != 20 {
+		t.Errorf("时间片很长时第三个 G 应该等到最后，实际在第 %d 轮运行", r)
+	}
+	if r := starved(5 * time.Millisecond); r > 6 {
+		t.Errorf("5ms 的时间片用完后第三个 G 应该运行，实际在第 %d 轮运行", r)
+	}
+}
+
+func TestSpinLimit(t *testing.T) {
+	s, err := New(Config{Procs: 4, SpinLimit: 3, Clock: NewVirtualClock(epoch)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	maxspin := 0
+	s.Go(func() {
+		// 每次 Go 都会调用 wakep，直到自旋的 M 达到上限
+		for i := 0; i < 8; i++ {
+			Go(func() {})
+		}
+		sched.lock.Lock()
+		maxspin = int(sched.nmspinning)
+		sched.lock.Unlock()
+	})
+	s.Run()
+	if maxspin != 3 {
+		t.Errorf("同时自旋的 M 应该达到上限 3，实际为 %d", maxspin)
+	}
+}
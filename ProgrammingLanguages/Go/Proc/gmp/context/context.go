@@ -0,0 +1,273 @@
+// Package gmpcontext 为 gmp 调度器上的 Goroutine 提供可取消、带截止时间的 context
+//
+// 导入方式：
+//
+//	import gmpcontext "go-rem/gmp/context"
+//
+// 返回的 Context 实现了标准的 context.Context，可以和标准库的 WithValue 等混用。
+// gmp 的 G 不能阻塞在 channel 上（那会阻塞整个调度器），
+// 所以等待取消要用 Wait / Sleep：它们会 park 当前 G，取消时所有等待者都会被唤醒。
+// 截止时间使用调度器的定时器堆，在虚拟时钟下同样有效。
+//
+// 父 context 也可以是标准库的可取消 context（例如 HTTP 请求的 context）。
+// 它在调度器之外被取消，context.AfterFunc 把取消作为一个新的 G 交给创建子 context 时所在的调度器。
+// 在这样的 context 上等待的 G 像等待 I/O 一样进入系统调用（gmp.Syscall），
+// 等待期间调度器不会报告死锁。
+package gmpcontext
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go-rem/gmp"
+)
+
+// cancelCtxKey 用于从 context 链上找到最近的 *cancelCtx
+var cancelCtxKey int
+
+// cancelCtx 可以被取消，取消时同时取消它的所有子 context
+type cancelCtx struct {
+	context.Context // 父 context
+
+	mu       sync.Mutex
+	done     chan struct{} // 惰性创建，取消时关闭
+	children map[*cancelCtx]struct{}
+	err      error
+	cause    error
+
+	waiters gmp.NotifyList // park 在 Wait 上的 G
+
+	foreign bool        // 祖先中有标准库的可取消 context，取消可能来自调度器之外
+	stop    func() bool // 停止 context.AfterFunc 对父 context 的桥接
+
+	// 只有 WithDeadline 创建的 context 才有
+	timer    *gmp.Timer
+	deadline time.Time
+}
+
+func (c *cancelCtx) Value(key any) any {
+	if key == &cancelCtxKey {
+		return c
+	}
+	return c.Context.Value(key)
+}
+
+// Done 返回一个在取消时关闭的 channel，供调度器之外的代码使用
+// gmp 的 G 应该使用 Wait
+func (c *cancelCtx) Done() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done == nil {
+		c.done = make(chan struct{})
+		if c.err != nil {
+			close(c.done)
+		}
+	}
+	return c.done
+}
+
+func (c *cancelCtx) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *cancelCtx) Deadline() (time.Time, bool) {
+	if !c.deadline.IsZero() {
+		return c.deadline, true
+	}
+	return c.Context.Deadline()
+}
+
+// wait park 当前 G 直到 c 被取消
+func (c *cancelCtx) wait() {
+	if c.foreign {
+		// 取消可能来自调度器之外，在系统调用中等待 Done
+		gmp.Syscall(func() { <-c.Done() })
+		return
+	}
+	// 先领取票号再检查状态，这样检查之后的取消也能唤醒我们
+	t := c.waiters.Add()
+	if c.Err() != nil {
+		return
+	}
+	c.waiters.Wait(t)
+}
+
+// cancel 取消 c 及其所有子 context，并唤醒所有等待者
+func (c *cancelCtx) cancel(removeFromParent bool, err, cause error) {
+	if cause == nil {
+		cause = err
+	}
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return // 已经取消过
+	}
+	c.err = err
+	c.cause = cause
+	if c.done != nil {
+		close(c.done)
+	}
+	children := c.children
+	c.children = nil
+	timer := c.timer
+	c.timer = nil
+	stop := c.stop
+	c.stop = nil
+	c.mu.Unlock()
+
+	if timer != nil {
+		timer.Stop()
+	}
+	if stop != nil {
+		stop()
+	}
+	c.waiters.NotifyAll()
+	for child := range children {
+		child.cancel(false, err, cause)
+	}
+	if removeFromParent {
+		if p, ok := parentCancelCtx(c.Context); ok {
+			p.mu.Lock()
+			delete(p.children, c)
+			p.mu.Unlock()
+		}
+	}
+}
+
+// parentCancelCtx 返回 parent 链上最近的 *cancelCtx
+func parentCancelCtx(parent context.Context) (*cancelCtx, bool) {
+	p, ok := parent.Value(&cancelCtxKey).(*cancelCtx)
+	return p, ok
+}
+
+// propagateCancel 让 child 在 parent 取消时一起取消
+func propagateCancel(parent context.Context, child *cancelCtx) {
+	if p, ok := parentCancelCtx(parent); ok {
+		child.foreign = p.foreign
+		p.mu.Lock()
+		if p.err != nil {
+			err, cause := p.err, p.cause
+			p.mu.Unlock()
+			child.cancel(false, err, cause)
+			return
+		}
+		if p.children == nil {
+			p.children = make(map[*cancelCtx]struct{})
+		}
+		p.children[child] = struct{}{}
+		p.mu.Unlock()
+		return
+	}
+	if parent.Done() == nil {
+		return // Background、TODO 以及它们的 WithValue 永远不会被取消
+	}
+
+	// 标准库的可取消 context 在调度器之外取消，不能在那里唤醒被 park 的 G：
+	// 把取消交给 child 所属的调度器，在它的 G 中执行
+	child.foreign = true
+	s := gmp.Current()
+	stop := context.AfterFunc(parent, func() {
+		cancel := func() { child.cancel(false, parent.Err(), context.Cause(parent)) }
+		if err := s.TryGo(cancel); errors.Is(err, gmp.ErrQueueFull) {
+			s.Go(cancel)
+		}
+		// 其他错误说明调度器已经关闭，不会再有 G 等待 child
+	})
+	child.mu.Lock()
+	child.stop = stop
+	child.mu.Unlock()
+}
+
+func newCancelCtx(parent context.Context) *cancelCtx {
+	if parent == nil {
+		panic("gmpcontext: cannot create context from nil parent")
+	}
+	return &cancelCtx{Context: parent}
+}
+
+// WithCancel 返回一个可以取消的 context
+func WithCancel(parent context.Context) (context.Context, context.CancelFunc) {
+	c := newCancelCtx(parent)
+	propagateCancel(parent, c)
+	return c, func() { c.cancel(true, context.Canceled, nil) }
+}
+
+// WithCancelCause 与 WithCancel 相同，但取消时可以记录原因，通过 Cause 取回
+func WithCancelCause(parent context.Context) (context.Context, context.CancelCauseFunc) {
+	c := newCancelCtx(parent)
+	propagateCancel(parent, c)
+	return c, func(cause error) { c.cancel(true, context.Canceled, cause) }
+}
+
+// WithDeadline 返回一个在调度器时钟到达 d 时自动取消的 context
+func WithDeadline(parent context.Context, d time.Time) (context.Context, context.CancelFunc) {
+	if cur, ok := parent.Deadline(); ok && cur.Before(d) {
+		// 父 context 的截止时间更早
+		return WithCancel(parent)
+	}
+	c := newCancelCtx(parent)
+	c.deadline = d
+	propagateCancel(parent, c)
+
+	dur := d.Sub(gmp.Now())
+	if dur <= 0 {
+		c.cancel(true, context.DeadlineExceeded, nil)
+		return c, func() { c.cancel(false, context.Canceled, nil) }
+	}
+	c.mu.Lock()
+	if c.err == nil {
+		c.timer = gmp.AfterFunc(dur, func() {
+			c.cancel(true, context.DeadlineExceeded, nil)
+		})
+	}
+	c.mu.Unlock()
+	return c, func() { c.cancel(true, context.Canceled, nil) }
+}
+
+// WithTimeout 等价于 WithDeadline(parent, gmp.Now().Add(timeout))
+func WithTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return WithDeadline(parent, gmp.Now().Add(timeout))
+}
+
+// Cause 返回 ctx 被取消的原因
+func Cause(ctx context.Context) error {
+	if c, ok := parentCancelCtx(ctx); ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.cause
+	}
+	return context.Cause(ctx)
+}
+
+// Wait park 当前 G 直到 ctx 被取消，返回 ctx.Err()
+// 永远不会被取消的 ctx 会让当前 G 永远 park。
+// ctx 是标准库的可取消 context 时在系统调用中等待它的 Done
+func Wait(ctx context.Context) error {
+	c, ok := parentCancelCtx(ctx)
+	if !ok {
+		if done := ctx.Done(); done != nil {
+			gmp.Syscall(func() { <-done })
+			return ctx.Err()
+		}
+		// 永远不会被取消
+		c = newCancelCtx(ctx)
+	}
+	c.wait()
+	return ctx.Err()
+}
+
+// Sleep park 当前 G，直到经过 d 或 ctx 被取消
+// 睡满 d 时返回 nil，否则返回 ctx.Err()
+func Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	tctx, cancel := WithTimeout(ctx, d)
+	defer cancel()
+	Wait(tctx)
+	return ctx.Err()
+}
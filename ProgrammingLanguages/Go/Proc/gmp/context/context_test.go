@@ -0,0 +1,215 @@
+package gmpcontext
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-rem/gmp"
+	"go-rem/gmp/internal/schedtest"
+)
+
+func TestCancelWakesAllWaiters(t *testing.T) {
+	schedtest.Init(t, 2)
+
+	ctx, cancel := WithCancel(context.Background())
+	woken := 0
+	for i := 0; i < 10; i++ {
+		gmp.GoContext(ctx, func(ctx context.Context) {
+			if err := Wait(ctx); !errors.Is(err, context.Canceled) {
+				t.Errorf("Wait 应该返回 context.Canceled, 实际 %v", err)
+			}
+			woken++
+		})
+	}
+	gmp.Go(func() {
+		gmp.Sleep(time.Millisecond)
+		cancel()
+	})
+	gmp.Run()
+
+	if woken != 10 {
+		t.Errorf("取消后 10 个 G 都应该被唤醒, 实际 %d", woken)
+	}
+}
+
+func TestCancelTree(t *testing.T) {
+	schedtest.Init(t, 4)
+
+	root, cancel := WithCancel(context.Background())
+	var stopped []string
+	var spawn func(ctx context.Context, name string, depth int)
+	spawn = func(ctx context.Context, name string, depth int) {
+		gmp.GoContext(ctx, func(ctx context.Context) {
+			child, cancelChild := WithCancel(ctx)
+			defer cancelChild()
+			if depth > 0 {
+				spawn(child, name+"0", depth-1)
+				spawn(child, name+"1", depth-1)
+			}
+			Wait(child)
+			stopped = append(stopped, name)
+		})
+	}
+	spawn(root, "g", 2)
+	gmp.Go(func() {
+		gmp.Sleep(time.Second)
+		cancel()
+	})
+	gmp.Run()
+
+	if len(stopped) != 7 {
+		t.Errorf("取消根 context 应该停止整棵树的 7 个 G, 实际 %v", stopped)
+	}
+}
+
+func TestTimeoutVirtualClock(t *testing.T) {
+	schedtest.Init(t, 1)
+
+	var err error
+	var waited time.Duration
+	gmp.Go(func() {
+		ctx, cancel := WithTimeout(context.Background(), 250*time.Millisecond)
+		defer cancel()
+		start := gmp.Now()
+		err = Wait(ctx)
+		waited = gmp.Since(start)
+
+		if d, ok := ctx.Deadline(); !ok || !d.Equal(start.Add(250*time.Millisecond)) {
+			t.Errorf("Deadline 应该是开始后 250ms, 实际 %v", d)
+		}
+		select {
+		case <-ctx.Done():
+		default:
+			t.Error("超时后 Done channel 应该已关闭")
+		}
+	})
+	gmp.Run()
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("应该返回 DeadlineExceeded, 实际 %v", err)
+	}
+	if waited != 250*time.Millisecond {
+		t.Errorf("应该在虚拟时间 250ms 后超时, 实际 %v", waited)
+	}
+}
+
+func TestChildInheritsEarlierDeadline(t *testing.T) {
+	schedtest.Init(t, 1)
+
+	var waited time.Duration
+	gmp.Go(func() {
+		parent, cancel := WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		child, cancelChild := WithTimeout(parent, time.Hour)
+		defer cancelChild()
+
+		start := gmp.Now()
+		Wait(child)
+		waited = gmp.Since(start)
+	})
+	gmp.Run()
+
+	if waited != 10*time.Millisecond {
+		t.Errorf("子 context 应该随父 context 在 10ms 取消, 实际 %v", waited)
+	}
+}
+
+func TestSleepInterrupted(t *testing.T) {
+	schedtest.Init(t, 1)
+
+	ctx, cancel := WithCancelCause(context.Background())
+	reason := errors.New("shutdown")
+	var err error
+	var slept time.Duration
+	gmp.Go(func() {
+		start := gmp.Now()
+		err = Sleep(ctx, time.Minute)
+		slept = gmp.Since(start)
+	})
+	gmp.Go(func() {
+		gmp.Sleep(time.Second)
+		cancel(reason)
+	})
+	gmp.Run()
+
+	if !errors.Is(err, context.Canceled) || slept != time.Second {
+		t.Errorf("Sleep 应该在 1s 时被取消, 实际 %v 后返回 %v", slept, err)
+	}
+	if Cause(ctx) != reason {
+		t.Errorf("Cause 应该返回取消原因, 实际 %v", Cause(ctx))
+	}
+}
+
+func TestGoContextSkipsCanceled(t *testing.T) {
+	schedtest.Init(t, 1)
+
+	ctx, cancel := WithCancel(context.Background())
+	cancel()
+	ran := false
+	gmp.GoContext(ctx, func(context.Context) { ran = true })
+	gmp.Run()
+
+	if ran {
+		t.Error("ctx 已取消时 fn 不应该被调用")
+	}
+}
+
+func TestStdParentCanceledOutside(t *testing.T) {
+	schedtest.Init(t, 2)
+
+	// 标准库的 parent 在调度器之外被取消，取消通过新的 G 传给子 context 并唤醒等待者
+	parent, cancel := context.WithCancelCause(context.Background())
+	reason := errors.New("client gone")
+	woken := 0
+	var child context.Context
+	gmp.Go(func() {
+		var cancelChild context.CancelFunc
+		child, cancelChild = WithCancel(parent)
+		defer cancelChild()
+		grandchild, cancelGrandchild := WithCancel(child)
+		defer cancelGrandchild()
+		for _, ctx := range []context.Context{child, grandchild, parent} {
+			gmp.Go(func() {
+				if err := Wait(ctx); !errors.Is(err, context.Canceled) {
+					t.Errorf("Wait 应该返回 context.Canceled, 实际 %v", err)
+				}
+				woken++
+			})
+		}
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel(reason)
+		}()
+		Wait(child)
+	})
+	if err := gmp.RunE(); err != nil {
+		t.Fatal(err)
+	}
+
+	if woken != 3 {
+		t.Errorf("3 个等待者都应该被唤醒, 实际 %d", woken)
+	}
+	if Cause(child) != reason {
+		t.Errorf("子 context 应该记录父 context 的取消原因, 实际 %v", Cause(child))
+	}
+}
+
+func TestStdParentBridgeStopped(t *testing.T) {
+	schedtest.Init(t, 1)
+
+	// 子 context 先被取消时桥接被停止，之后取消 parent 不会再创建 G
+	parent, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gmp.Go(func() {
+		_, cancelChild := WithCancel(parent)
+		cancelChild()
+	})
+	gmp.Run()
+	cancel()
+	time.Sleep(10 * time.Millisecond) // 没有停止的桥接会在这期间提交 G
+	if n := gmp.GetGCount(); n != 0 {
+		t.Errorf("桥接停止后不应该再提交 G, 实际队列中有 %d 个", n)
+	}
+}
@@ -0,0 +1,163 @@
+package gmp
+
+import (
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============ 死锁检测 ============
+
+// GoroutineInfo 描述一个 G，用于死锁和泄漏报告
+type GoroutineInfo struct {
+	Goid       uint64        `json:"goid"`
+	Status     string        `json:"status"`               // "runnable"、"running"、"waiting" 等
+	WaitReason string        `json:"waitReason,omitempty"` // Status 为 "waiting" 时的等待原因，如 "sync.Mutex.Lock"
+	WaitTime   time.Duration `json:"waitTime,omitempty"`   // 已经等待的时长（按调度器时钟）
+	Func       string        `json:"func"`                 // 入口函数
+	ParentGoid uint64        `json:"parentGoid,omitempty"` // 创建者的 goid，0 表示由 gmp 之外的代码创建
+	CreatedBy  string        `json:"createdBy,omitempty"`  // 创建这个 G 的函数
+	File       string        `json:"file,omitempty"`       // 创建位置
+	Line       int           `json:"line,omitempty"`
+}
+
+// String 返回 "goroutine N [reason]: fn, created by ... at file:line"
+func (gi GoroutineInfo) String() string {
+	var b strings.Builder
+	state := gi.Status
+	if gi.WaitReason != "" {
+		state = gi.WaitReason
+	}
+	b.WriteString("goroutine ")
+	b.WriteString(strconv.FormatUint(gi.Goid, 10))
+	b.WriteString(" [" + state + "]: " + gi.Func)
+	if gi.CreatedBy != "" {
+		b.WriteString(", created by " + gi.CreatedBy)
+		if gi.ParentGoid != 0 {
+			b.WriteString(" in goroutine " + strconv.FormatUint(gi.ParentGoid, 10))
+		}
+		b.WriteString(" at " + gi.File + ":" + strconv.Itoa(gi.Line))
+	}
+	return b.String()
+}
+
+// DeadlockError 由 RunE 在所有 G 都阻塞时返回
+type DeadlockError struct {
+	// Blocked 是所有处于等待状态的 G，按 goid 排序
+	Blocked []GoroutineInfo
+	// Dump 是检测到死锁时的 Stack(true)
+	Dump string
+}
+
+func (e *DeadlockError) Error() string {
+	return "all goroutines are asleep - deadlock!"
+}
+
+// ginfo 生成 gp 的 GoroutineInfo，调用者必须持有 sched.lock
+func ginfo(gp *g) GoroutineInfo {
+	gi := GoroutineInfo{
+		Goid:       gp.goid,
+		ParentGoid: gp.parentGoid,
+	}
+	switch gp.status {
+	case _Gwaiting:
+		gi.Status = "waiting"
+		gi.WaitReason = gp.waitreason.String()
+		if !gp.waitsince.IsZero() {
+			gi.WaitTime = nanotime().Sub(gp.waitsince)
+		}
+	default:
+		gi.Status = gstatusString(gp)
+	}
+	gi.Func, _, _ = funcInfo(gp.fn)
+	if gp.gopc != 0 {
+		f, _ := runtime.CallersFrames([]uintptr{gp.gopc}).Next()
+		gi.CreatedBy, gi.File, gi.Line = f.Function, f.File, f.Line
+	}
+	return gi
+}
+
+// checkdead 在最后一个 M 休眠、并且没有可运行的 G 和待触发的定时器时调用
+// 如果还有 G 处于等待状态，它们再也不可能被唤醒：记录死锁
+// 调用者必须持有 sched.lock
+func checkdead() {
+	if sched.nsyscall > 0 {
+		// 系统调用返回后还会有工作
+		return
+	}
+	var blocked []*g
+	for _, gp := range sched.allgs {
+		if gp.status == _Gwaiting {
+			blocked = append(blocked, gp)
+		}
+	}
+	if len(blocked) == 0 {
+		return
+	}
+
+	sort.Slice(blocked, func(i, j int) bool { return blocked[i].goid < blocked[j].goid })
+	err := &DeadlockError{}
+	for _, gp := range blocked {
+		err.Blocked = append(err.Blocked, ginfo(gp))
+	}
+	var b strings.Builder
+	tracebackothers(&b, nil)
+	err.Dump = strings.TrimPrefix(b.String(), "\n")
+	sched.deadlock = err
+}
+
+// ============ 泄漏检测 ============
+
+// LeakError 由设置了 Config.FailOnLeak 的 RunE 返回
+type LeakError struct {
+	// Leaked 是 Run 返回时还没有结束的 G，按 goid 排序
+	Leaked []GoroutineInfo
+}
+
+func (e *LeakError) Error() string {
+	var b strings.Builder
+	b.WriteString("gmp: found " + strconv.Itoa(len(e.Leaked)) + " leaked goroutines")
+	for _, gi := range e.Leaked {
+		b.WriteString("\n\t" + gi.String())
+	}
+	return b.String()
+}
+
+// Leaks 返回所有还没有结束的 G，按 goid 排序
+// 在 Run 返回后调用，作用类似于 goleak 对真实 Goroutine 的检查：
+// 留下来的 G 要么永远 park 着，要么还在某个运行队列中没有被执行
+func Leaks() []GoroutineInfo {
+	var infos []GoroutineInfo
+	current().do(func() {
+		sched.lock.Lock()
+		defer sched.lock.Unlock()
+		infos = leaks()
+	})
+	return infos
+}
+
+// leaks 是 Leaks 的持锁版本
+func leaks() []GoroutineInfo {
+	gs := make([]*g, 0, len(sched.allgs))
+	for _, gp := range sched.allgs {
+		if gp.status != _Gdead {
+			gs = append(gs, gp)
+		}
+	}
+	sort.Slice(gs, func(i, j int) bool { return gs[i].goid < gs[j].goid })
+	var infos []GoroutineInfo
+	for _, gp := range gs {
+		infos = append(infos, ginfo(gp))
+	}
+	return infos
+}
+
+// leakcheck 在有泄漏的 G 时返回 *LeakError，调用者必须持有 sched.lock
+func leakcheck() error {
+	if l := leaks(); len(l) > 0 {
+		return &LeakError{Leaked: l}
+	}
+	return nil
+}
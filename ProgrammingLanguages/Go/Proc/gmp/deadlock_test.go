@@ -0,0 +1,149 @@
+package gmp
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func blockForever() {
+	var sema uint32
+	Semacquire(&sema)
+}
+
+func TestRunEDeadlock(t *testing.T) {
+	initVirtual(t, 2)
+
+	var mu uint32
+	Go(blockForever)
+	Go(func() {
+		Sleep(time.Millisecond) // 定时器触发后才会发生死锁
+		SemacquireMutex(&mu, false)
+	})
+	Go(func() {}) // 正常结束的 G 不算
+
+	err := RunE()
+	var de *DeadlockError
+	if !errors.As(err, &de) {
+		t.Fatalf("RunE 应该返回 *DeadlockError，实际为 %v", err)
+	}
+	if err.Error() != "all goroutines are asleep - deadlock!" {
+		t.Errorf("错误信息错误: %q", err.Error())
+	}
+	if len(de.Blocked) != 2 {
+		t.Fatalf("应该有 2 个阻塞的 G，实际为 %d: %v", len(de.Blocked), de.Blocked)
+	}
+
+	first, second := de.Blocked[0], de.Blocked[1]
+	if first.Goid >= second.Goid {
+		t.Errorf("阻塞的 G 应该按 goid 排序")
+	}
+	if first.WaitReason != "semacquire" || !strings.HasSuffix(first.Func, "blockForever") {
+		t.Errorf("第一个 G 信息错误: %+v", first)
+	}
+	if second.WaitReason != "sync.Mutex.Lock" {
+		t.Errorf("第二个 G 应该阻塞在 sync.Mutex.Lock，实际为 %q", second.WaitReason)
+	}
+	if !strings.HasSuffix(first.CreatedBy, "TestRunEDeadlock") || !strings.HasSuffix(first.File, "deadlock_test.go") {
+		t.Errorf("创建位置错误: %s", first)
+	}
+	if !strings.Contains(de.Dump, "[semacquire") || !strings.Contains(de.Dump, "[sync.Mutex.Lock") {
+		t.Errorf("转储应该包含所有阻塞的 G:\n%s", de.Dump)
+	}
+}
+
+func TestRunENoDeadlock(t *testing.T) {
+	initVirtual(t, 2)
+
+	var sema uint32
+	Go(func() { Semacquire(&sema) })
+	Go(func() {
+		Sleep(time.Second)
+		Semrelease(&sema, false)
+	})
+	if err := RunE(); err != nil {
+		t.Fatalf("有定时器可以唤醒等待者时不是死锁: %v", err)
+	}
+}
+
+func TestRunDeadlockFatal(t *testing.T) {
+	if os.Getenv("GMP_TEST_DEADLOCK") == "1" {
+		Init()
+		Go(blockForever)
+		Run()
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunDeadlockFatal$")
+	cmd.Env = append(os.Environ(), "GMP_TEST_DEADLOCK=1")
+	out, err := cmd.CombinedOutput()
+	var ee *exec.ExitError
+	if !errors.As(err, &ee) || ee.ExitCode() != 2 {
+		t.Fatalf("Run 应该以状态码 2 退出，实际为 %v\n%s", err, out)
+	}
+	for _, want := range []string{
+		"fatal error: all goroutines are asleep - deadlock!\n\ngoroutine ",
+		"[semacquire",
+		"go-rem/gmp.blockForever()",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("输出中应该包含 %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestLeaks(t *testing.T) {
+	initVirtual(t, 1)
+
+	Go(blockForever)
+	if err := RunE(); err == nil {
+		t.Fatal("应该检测到死锁")
+	}
+	Go(func() {}) // Run 已经返回，这个 G 留在运行队列中
+
+	l := Leaks()
+	if len(l) != 2 {
+		t.Fatalf("应该有 2 个泄漏的 G，实际为 %d: %v", len(l), l)
+	}
+	if l[0].Status != "waiting" || l[0].WaitReason != "semacquire" {
+		t.Errorf("第一个 G 应该 park 在 semacquire 上: %s", l[0])
+	}
+	if l[1].Status != "runnable" {
+		t.Errorf("第二个 G 应该是可运行的: %s", l[1])
+	}
+	for _, gi := range l {
+		if !strings.HasSuffix(gi.CreatedBy, "TestLeaks") || !strings.HasSuffix(gi.File, "deadlock_test.go") || gi.Line == 0 {
+			t.Errorf("缺少创建位置: %s", gi)
+		}
+	}
+
+	sched.lock.Lock()
+	err := leakcheck()
+	sched.lock.Unlock()
+	var le *LeakError
+	if !errors.As(err, &le) || len(le.Leaked) != 2 {
+		t.Fatalf("应该返回包含 2 个 G 的 *LeakError，实际为 %v", err)
+	}
+	if !strings.Contains(err.Error(), "2 leaked goroutines") || !strings.Contains(err.Error(), "created by go-rem/gmp.TestLeaks") {
+		t.Errorf("错误信息错误:\n%s", err)
+	}
+}
+
+func TestFailOnLeak(t *testing.T) {
+	if err := InitWithConfig(Config{Procs: 2, Clock: NewVirtualClock(epoch), FailOnLeak: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		Go(func() { Sleep(time.Millisecond) })
+	}
+	if err := RunE(); err != nil {
+		t.Fatalf("所有 G 都结束时不应该报告泄漏: %v", err)
+	}
+	if l := Leaks(); len(l) != 0 {
+		t.Fatalf("不应该有泄漏的 G: %v", l)
+	}
+}
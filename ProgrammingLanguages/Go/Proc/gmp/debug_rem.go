@@ -0,0 +1,194 @@
+package gmp
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============ GMPDEBUG ============
+//
+// 对应 runtime 的 GODEBUG=schedtrace=N,scheddetail=1：
+// 每 N 毫秒（按调度器时钟，虚拟时钟下也一样）输出一次调度器状态，
+// 格式与 runtime 的 schedtrace 一致，可以与真实程序的输出对照。
+
+// dbgvars 是 GMPDEBUG 中的调试变量
+type dbgvars struct {
+	schedtrace  int32 // 输出间隔（毫秒），0 表示关闭
+	scheddetail int32 // 为 1 时输出每个 P、M、G 的详细信息
+}
+
+// schedtraceOut 是 schedtrace 的输出目标，与 runtime 一样默认是标准错误
+var schedtraceOut io.Writer = os.Stderr
+
+// parsegmpdebug 解析 GMPDEBUG 环境变量（对应 runtime 的 parsedebugvars）
+// 格式为逗号分隔的 name=value，Config 的配置项（见 Config.override）写入 cfg，
+// 调试变量写入 cfg.debug。空项被跳过，未知的变量被忽略；没有 = 的项和不合法的值返回 *ConfigError。
+// 返回被覆盖的 Config 字段到变量名的映射，validate 用它报告错误的来源
+func parsegmpdebug(gmpdebug string, cfg *Config) (map[string]string, error) {
+	cfg.debug = dbgvars{}
+	from := make(map[string]string)
+	for _, field := range strings.Split(gmpdebug, ",") {
+		if field == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, &ConfigError{"GMPDEBUG", field, "must be a comma-separated list of name=value"}
+		}
+		var dst *int32
+		switch key {
+		case "schedtrace":
+			dst = &cfg.debug.schedtrace
+		case "scheddetail":
+			dst = &cfg.debug.scheddetail
+		}
+		if dst != nil {
+			n, err := strconv.ParseInt(value, 10, 32)
+			if err != nil || n < 0 {
+				return nil, &ConfigError{"GMPDEBUG " + key, value, "must be a non-negative integer"}
+			}
+			*dst = int32(n)
+			continue
+		}
+		f, err := cfg.override(key, value)
+		if err != nil {
+			return nil, err
+		}
+		if f != "" {
+			from[f] = key
+		}
+	}
+	return from, nil
+}
+
+// schedtraceInterval 返回 schedtrace 的输出间隔
+func schedtraceInterval() time.Duration {
+	return time.Duration(sched.debug.schedtrace) * time.Millisecond
+}
+
+// checkschedtrace 在到达输出时刻时输出一次 schedtrace，调用者必须持有 sched.lock
+// 对应 sysmon 中的 lasttrace 检查
+func checkschedtrace() {
+	if sched.debug.schedtrace <= 0 {
+		return
+	}
+	now := nanotime()
+	if now.Before(sched.nextschedtrace) {
+		return
+	}
+	schedtrace(sched.debug.scheddetail > 0)
+	sched.nextschedtrace = now.Add(schedtraceInterval())
+}
+
+// schedtrace 输出调度器状态，调用者必须持有 sched.lock
+func schedtrace(detailed bool) {
+	var b strings.Builder
+	ms := nanotime().Sub(sched.starttime).Milliseconds()
+
+	var nspinning, nidle int
+	for _, mp := range sched.allm {
+		if mp.spinning {
+			nspinning++
+		}
+	}
+	for mp := sched.midle; mp != nil; mp = mp.link {
+		nidle++
+	}
+
+	fmt.Fprintf(&b, "SCHED %dms: gomaxprocs=%d idleprocs=%d threads=%d spinningthreads=%d needspinning=0 idlethreads=%d runqueue=%d",
+		ms, gomaxprocs(), sched.npidle.Load(), len(sched.allm), nspinning, nidle, len(sched.runq))
+	if detailed {
+		fmt.Fprintf(&b, " gcwaiting=false nmidlelocked=0 stopwait=0 sysmonwait=false\n")
+	}
+
+	for i, pp := range sched.allp {
+		h, t := pp.runqhead, pp.runqtail
+		if detailed {
+			mid := int64(-1)
+			if pp.m != nil {
+				mid = pp.m.id
+			}
+			fmt.Fprintf(&b, "  P%d: status=%d schedtick=%d syscalltick=%d m=%d runqsize=%d gfreecnt=0 timerslen=%d\n",
+				pp.id, pp.status, pp.schedtick, pp.syscalltick, mid, t-h, ptimerslen(pp))
+		} else {
+			// 与 runtime 一样，只输出每个 P 本地队列的长度
+			if i == 0 {
+				b.WriteString(" [")
+			}
+			fmt.Fprintf(&b, "%d", t-h)
+			if i == len(sched.allp)-1 {
+				b.WriteString("]\n")
+			} else {
+				b.WriteString(" ")
+			}
+		}
+	}
+	if len(sched.allp) == 0 && !detailed {
+		b.WriteString(" []\n")
+	}
+
+	if !detailed {
+		io.WriteString(schedtraceOut, b.String())
+		return
+	}
+
+	for _, mp := range sched.allm {
+		pid, curg := int64(-1), int64(-1)
+		if mp.p != nil {
+			pid = mp.p.id
+		}
+		if gp := mp.curg; isuserg(gp) {
+			curg = int64(gp.goid)
+		}
+		fmt.Fprintf(&b, "  M%d: p=%d curg=%d mallocing=0 throwing=0 preemptoff= locks=0 dying=0 spinning=%v blocked=%v lockedg=-1\n",
+			mp.id, pid, curg, mp.spinning, mp.p == nil && curg < 0)
+	}
+
+	gs := append([]*g(nil), sched.allgs...)
+	sort.Slice(gs, func(i, j int) bool { return gs[i].goid < gs[j].goid })
+	for _, gp := range gs {
+		mid := int64(-1)
+		if gp.m != nil {
+			mid = gp.m.id
+		}
+		reason := ""
+		if gp.status == _Gwaiting {
+			reason = gp.waitreason.String()
+		}
+		fmt.Fprintf(&b, "  G%d: status=%d(%s) m=%d lockedm=-1\n", gp.goid, readgstatus(gp), reason, mid)
+	}
+	io.WriteString(schedtraceOut, b.String())
+}
+
+// ptimerslen 返回 P 上的定时器数量
+// 定时器保存在全局堆中而不是每个 P 上，因此全部算在 P0 上
+func ptimerslen(pp *p) int {
+	if pp.id == 0 {
+		return len(sched.timers)
+	}
+	return 0
+}
+
+// readgstatus 返回 runtime 中对应的状态值，便于与 GODEBUG 的输出对照
+func readgstatus(gp *g) int {
+	switch gp.status {
+	case _Gidle:
+		return 0
+	case _Grunnable:
+		return 1
+	case _Grunning:
+		return 2
+	case _Gsyscall:
+		return 3
+	case _Gwaiting:
+		return 4
+	case _Gdead:
+		return 6
+	}
+	return -1
+}
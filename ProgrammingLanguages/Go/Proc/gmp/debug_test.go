@@ -0,0 +1,114 @@
+package gmp
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsegmpdebug(t *testing.T) {
+	var cfg Config
+	if _, err := parsegmpdebug("gctrace=1,schedtrace=1000,scheddetail=1,,procs=2", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.debug.schedtrace != 1000 || cfg.debug.scheddetail != 1 || cfg.Procs != 2 {
+		t.Errorf("解析结果错误: %+v", cfg)
+	}
+
+	if _, err := parsegmpdebug("", &cfg); err != nil || cfg.debug != (dbgvars{}) {
+		t.Errorf("没有设置 GMPDEBUG 时应该全部关闭: %+v, %v", cfg.debug, err)
+	}
+
+	// 配置项和调试变量的格式错误一样报告
+	for v, field := range map[string]string{
+		"schedtrace=1000,bad": "GMPDEBUG",
+		"schedtrace=x":        "GMPDEBUG schedtrace",
+		"scheddetail=-1":      "GMPDEBUG scheddetail",
+		"runqsize":            "GMPDEBUG",
+		"runqsize=x":          "GMPDEBUG runqsize",
+	} {
+		_, err := parsegmpdebug(v, &cfg)
+		if ce := configErr(t, err); ce.Field != field {
+			t.Errorf("GMPDEBUG=%s: 错误的字段应该是 %s，实际为 %v", v, field, ce)
+		}
+	}
+}
+
+func captureSchedtrace(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	old := schedtraceOut
+	schedtraceOut = &buf
+	t.Cleanup(func() { schedtraceOut = old })
+	return &buf
+}
+
+func TestSchedtrace(t *testing.T) {
+	t.Setenv("GMPDEBUG", "schedtrace=10")
+	buf := captureSchedtrace(t)
+	initVirtual(t, 2)
+
+	Go(func() { Sleep(35 * time.Millisecond) })
+	Go(func() { Sleep(5 * time.Millisecond) })
+	Run()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("35ms 内应该输出 3 行，实际为 %d:\n%s", len(lines), buf.String())
+	}
+	re := regexp.MustCompile(`^SCHED (\d+)ms: gomaxprocs=2 idleprocs=\d+ threads=\d+ spinningthreads=\d+ needspinning=0 idlethreads=\d+ runqueue=\d+ \[\d+ \d+\]$`)
+	for i, line := range lines {
+		m := re.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("格式错误: %q", line)
+		}
+		if want := []string{"10", "20", "30"}[i]; m[1] != want {
+			t.Errorf("第 %d 行应该在 %sms 输出: %q", i, want, line)
+		}
+	}
+}
+
+func TestScheddetail(t *testing.T) {
+	t.Setenv("GMPDEBUG", "schedtrace=1,scheddetail=1")
+	buf := captureSchedtrace(t)
+	initVirtual(t, 2)
+
+	var sema uint32
+	Go(func() { Semacquire(&sema) })
+	Go(func() {
+		Sleep(time.Millisecond)
+		Semrelease(&sema, false)
+	})
+	Run()
+
+	out := buf.String()
+	t.Log("\n" + out)
+	for _, want := range []string{
+		"SCHED 1ms: gomaxprocs=2 ",
+		" gcwaiting=false nmidlelocked=0 stopwait=0 sysmonwait=false\n",
+		"  P0: status=",
+		"  P1: status=",
+		"  M0: p=",
+		"status=4(semacquire) m=-1 lockedm=-1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("输出中应该包含 %q", want)
+		}
+	}
+	if !regexp.MustCompile(`  P\d: status=\d schedtick=[1-9]\d* syscalltick=0 m=-?\d+ runqsize=\d+ gfreecnt=0 timerslen=\d+\n`).MatchString(out) {
+		t.Errorf("P 行格式错误")
+	}
+}
+
+func TestSchedtraceOff(t *testing.T) {
+	t.Setenv("GMPDEBUG", "")
+	buf := captureSchedtrace(t)
+	initVirtual(t, 1)
+
+	Go(func() { Sleep(time.Second) })
+	Run()
+	if buf.Len() != 0 {
+		t.Errorf("没有设置 schedtrace 时不应该有输出:\n%s", buf.String())
+	}
+}
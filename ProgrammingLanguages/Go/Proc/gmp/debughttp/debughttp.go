@@ -0,0 +1,130 @@
+// Package debughttp 通过 HTTP 暴露 gmp 调度器的运行状态，类似 net/http/pprof
+//
+//	/metrics                Prometheus 文本格式的计数器和仪表，按 P 打标签
+//	/debug/gmp/goroutines   Goroutine 转储（gmp.Stack(true)）
+//	/debug/gmp/state        gmp.Snapshot() 的 JSON：每个 P 的 runq、runnext、状态和绑定的 M，以及所有 M 和 G
+//
+// 处理函数可以在调度器运行时从任意 goroutine 访问：
+//
+//	go http.ListenAndServe("localhost:6060", debughttp.Handler())
+//	gmp.Run()
+package debughttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"go-rem/gmp"
+)
+
+// Handler 返回一个注册了所有调试路径的 http.Handler
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", Metrics)
+	mux.HandleFunc("/debug/gmp/goroutines", Goroutines)
+	mux.HandleFunc("/debug/gmp/state", State)
+	return mux
+}
+
+// Metrics 以 Prometheus 文本格式输出调度器指标
+func Metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w)
+}
+
+// Goroutines 输出所有 G 的转储
+func Goroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, gmp.Stack(true))
+}
+
+// State 以 JSON 输出调度器的快照
+func State(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(gmp.Snapshot())
+}
+
+// metric 是一组同名的样本
+type metric struct {
+	name, help, typ string
+	samples         []sample
+}
+
+type sample struct {
+	labels string // 已经格式化的标签，如 `p="0"`
+	value  uint64
+}
+
+func writeMetrics(w io.Writer) {
+	samples := []gmp.Sample{
+		{Name: "/sched/goroutines:goroutines"},
+		{Name: "/sched/gomaxprocs:threads"},
+	}
+	gmp.ReadMetrics(samples)
+	procs := gmp.ReadProcs()
+
+	metrics := []metric{
+		{name: "gmp_goroutines", help: "Number of goroutines that have not exited.", typ: "gauge",
+			samples: []sample{{value: samples[0].Value.Uint64()}}},
+		{name: "gmp_gomaxprocs", help: "Number of Ps.", typ: "gauge",
+			samples: []sample{{value: samples[1].Value.Uint64()}}},
+	}
+
+	perP := []struct {
+		name, help, typ string
+		value           func(gmp.PInfo) uint64
+	}{
+		{"gmp_p_runq_length", "Number of goroutines in the P's local run queue, including runnext.", "gauge",
+			func(pi gmp.PInfo) uint64 {
+				n := uint64(len(pi.Runq))
+				if pi.Runnext != 0 {
+					n++
+				}
+				return n
+			}},
+		{"gmp_p_running", "Whether the P is held by an M (1) or idle (0).", "gauge",
+			func(pi gmp.PInfo) uint64 { return boolValue(pi.M >= 0) }},
+		{"gmp_p_schedticks_total", "Number of goroutines scheduled on the P.", "counter",
+			func(pi gmp.PInfo) uint64 { return uint64(pi.SchedTick) }},
+		{"gmp_p_syscallticks_total", "Number of system calls made on the P.", "counter",
+			func(pi gmp.PInfo) uint64 { return uint64(pi.SyscallTick) }},
+		{"gmp_p_steals_total", "Number of successful work steals by the P.", "counter",
+			func(pi gmp.PInfo) uint64 { return pi.Steals }},
+		{"gmp_p_global_queue_gets_total", "Number of times the P took goroutines from the global run queue.", "counter",
+			func(pi gmp.PInfo) uint64 { return pi.GlobalGets }},
+		{"gmp_p_runnext_hits_total", "Number of goroutines the P took from runnext.", "counter",
+			func(pi gmp.PInfo) uint64 { return pi.RunnextHits }},
+	}
+	for _, pm := range perP {
+		m := metric{name: pm.name, help: pm.help, typ: pm.typ}
+		for _, pi := range procs {
+			m.samples = append(m.samples, sample{labels: fmt.Sprintf(`p="%d"`, pi.ID), value: pm.value(pi)})
+		}
+		metrics = append(metrics, m)
+	}
+
+	var b strings.Builder
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for _, s := range m.samples {
+			if s.labels != "" {
+				fmt.Fprintf(&b, "%s{%s} %d\n", m.name, s.labels, s.value)
+			} else {
+				fmt.Fprintf(&b, "%s %d\n", m.name, s.value)
+			}
+		}
+	}
+	io.WriteString(w, b.String())
+}
+
+func boolValue(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,105 @@
+package debughttp
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-rem/gmp"
+)
+
+func get(t *testing.T, path string) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	if rec.Code != 200 {
+		t.Fatalf("GET %s 返回 %d", path, rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func worker() {}
+
+func TestHandlerBeforeRun(t *testing.T) {
+	if err := gmp.InitWithConfig(gmp.Config{Procs: 2, Clock: gmp.NewVirtualClock(time.Unix(0, 0))}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		gmp.Go(worker)
+	}
+
+	metrics := get(t, "/metrics")
+	for _, want := range []string{
+		"# TYPE gmp_goroutines gauge\ngmp_goroutines 3\n",
+		"gmp_gomaxprocs 2\n",
+		`gmp_p_runq_length{p="0"} 3`,
+		`gmp_p_runq_length{p="1"} 0`,
+		"# TYPE gmp_p_steals_total counter\n",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("/metrics 中应该包含 %q:\n%s", want, metrics)
+		}
+	}
+
+	var state gmp.SchedInfo
+	if err := json.Unmarshal([]byte(get(t, "/debug/gmp/state")), &state); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Procs) != 2 {
+		t.Fatalf("应该有 2 个 P，实际为 %d", len(state.Procs))
+	}
+	p0 := state.Procs[0]
+	if p0.Status != "running" || p0.M != 0 || p0.Runnext == 0 || len(p0.Runq) != 2 || p0.Runq[0] >= p0.Runq[1] {
+		t.Errorf("P0 的状态错误: %+v", p0)
+	}
+	if p1 := state.Procs[1]; p1.Status != "idle" || p1.M != -1 {
+		t.Errorf("P1 的状态错误: %+v", p1)
+	}
+	if len(state.Gs) != 3 || state.Gs[0].Location != "P0 runq" {
+		t.Errorf("快照中的 G 错误: %+v", state.Gs)
+	}
+
+	dump := get(t, "/debug/gmp/goroutines")
+	if strings.Count(dump, "go-rem/gmp/debughttp.worker()") != 3 {
+		t.Errorf("转储中应该有 3 个 G:\n%s", dump)
+	}
+
+	gmp.Run()
+	if !strings.Contains(get(t, "/metrics"), `gmp_p_schedticks_total{p="0"}`) {
+		t.Error("Run 之后应该有调度计数")
+	}
+}
+
+func TestHandlerWhileRunning(t *testing.T) {
+	if err := gmp.InitWithConfig(gmp.Config{Procs: 4}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 8; i++ {
+		gmp.Go(func() {
+			for j := 0; j < 20; j++ {
+				gmp.Sleep(time.Millisecond)
+			}
+		})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		gmp.Run()
+		close(done)
+	}()
+
+	// 调度器运行时从其他 goroutine 抓取
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		get(t, "/metrics")
+		get(t, "/debug/gmp/state")
+		get(t, "/debug/gmp/goroutines")
+		time.Sleep(time.Millisecond)
+	}
+}
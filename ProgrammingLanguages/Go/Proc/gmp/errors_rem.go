@@ -0,0 +1,46 @@
+package gmp
+
+import (
+	"errors"
+	"strings"
+)
+
+// ============ 错误 ============
+//
+// 调用方式不对（没有初始化、已经关闭）和调度器的致命错误（线程耗尽）用这里的哨兵错误表示，
+// 由 *SchedError 包装并附上出错的操作，可以用 errors.Is / errors.As 判断。
+// 返回 error 的变体（TryGo、RunE）返回它们；Go、Run 以同样的值 panic。
+
+var (
+	// ErrNotInitialized 表示在 Init 或 InitWithConfig 之前使用了调度器
+	ErrNotInitialized = errors.New("gmp: scheduler not initialized, call gmp.Init first")
+	// ErrShutdown 表示调度器已经关闭，不再接受新的 G
+	ErrShutdown = errors.New("gmp: scheduler is shut down")
+	// ErrThreadLimit 表示需要新的 M 时 M 的数量已经达到 Config.MaxThreads，
+	// 对应 runtime 的 "thread exhaustion"
+	ErrThreadLimit = errors.New("gmp: thread limit exceeded")
+	// ErrQueueFull 表示 TryGo 时当前 P 的本地队列已满
+	ErrQueueFull = errors.New("gmp: run queue is full")
+)
+
+// SchedError 记录出错的操作和原因
+type SchedError struct {
+	Op  string // 出错的操作，例如 "Go"、"Run"、"newm"
+	Err error  // 原因，通常是上面的哨兵错误之一
+}
+
+func (e *SchedError) Error() string {
+	return "gmp: " + e.Op + ": " + strings.TrimPrefix(e.Err.Error(), "gmp: ")
+}
+
+func (e *SchedError) Unwrap() error {
+	return e.Err
+}
+
+// schedfatal 记录一个致命错误，调度循环在下一步停止，RunE 返回它
+// 调用者必须持有 sched.lock
+func schedfatal(op string, err error) {
+	if sched.fatal == nil {
+		sched.fatal = &SchedError{Op: op, Err: err}
+	}
+}
@@ -0,0 +1,106 @@
+package gmp
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSchedErrorIs(t *testing.T) {
+	var err error = &SchedError{Op: "Go", Err: ErrShutdown}
+	if !errors.Is(err, ErrShutdown) || errors.Is(err, ErrNotInitialized) {
+		t.Errorf("errors.Is 结果错误: %v", err)
+	}
+	var se *SchedError
+	if !errors.As(err, &se) || se.Op != "Go" {
+		t.Errorf("errors.As 结果错误: %v", err)
+	}
+	if got := err.Error(); got != "gmp: Go: scheduler is shut down" {
+		t.Errorf("错误信息为 %q", got)
+	}
+}
+
+func TestTryGoNotInitialized(t *testing.T) {
+	s := &Scheduler{}
+	if err := s.TryGo(func() {}); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("初始化之前 TryGo 应该返回 ErrNotInitialized，实际为 %v", err)
+	}
+	if err := s.RunE(); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("初始化之前 RunE 应该返回 ErrNotInitialized，实际为 %v", err)
+	}
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrNotInitialized) {
+			t.Errorf("初始化之前 Go 应该以 ErrNotInitialized panic，实际为 %v", err)
+		}
+	}()
+	s.Go(func() {})
+}
+
+func TestTryGoShutdown(t *testing.T) {
+	s := newVirtual(t, 1)
+	s.Close()
+	if err := s.TryGo(func() {}); !errors.Is(err, ErrShutdown) {
+		t.Errorf("Close 之后 TryGo 应该返回 ErrShutdown，实际为 %v", err)
+	}
+	if err := s.RunE(); !errors.Is(err, ErrShutdown) {
+		t.Errorf("Close 之后 RunE 应该返回 ErrShutdown，实际为 %v", err)
+	}
+}
+
+func TestTryGoQueueFull(t *testing.T) {
+	s, err := New(Config{Procs: 1, LocalQueueSize: 2, Clock: NewVirtualClock(epoch)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// runnext 和长度为 2 的本地队列一共能放 3 个 G
+	n := 0
+	for i := 0; i < 3; i++ {
+		if err := s.TryGo(func() { n++ }); err != nil {
+			t.Fatalf("第 %d 个 TryGo 返回 %v", i, err)
+		}
+	}
+	if err := s.TryGo(func() { n++ }); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("本地队列满了之后 TryGo 应该返回 ErrQueueFull，实际为 %v", err)
+	}
+	// Go 把一半的 G 移到全局队列
+	s.Go(func() { n++ })
+	if si := s.Snapshot(); len(si.GlobalRunq) == 0 {
+		t.Errorf("Go 应该使用全局队列: %+v", si)
+	}
+	s.Run()
+	if n != 4 {
+		t.Errorf("n = %d", n)
+	}
+}
+
+func TestThreadLimit(t *testing.T) {
+	s, err := New(Config{Procs: 1, MaxThreads: 1, Clock: NewVirtualClock(epoch)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// 唯一的 M 进入系统调用后需要新的 M 来运行 P 上的 G
+	release := make(chan struct{})
+	n := 0
+	s.Go(func() {
+		Syscall(func() { <-release })
+		n++
+	})
+	s.Go(func() { n++ })
+	err = s.RunE()
+	var se *SchedError
+	if !errors.As(err, &se) || !errors.Is(err, ErrThreadLimit) || se.Op != "newm" {
+		t.Fatalf("RunE 应该返回 ErrThreadLimit，实际为 %v", err)
+	}
+
+	// 系统调用返回后 M 回到空闲链表，调度器可以继续运行
+	close(release)
+	if err := s.RunE(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("n = %d", n)
+	}
+}
@@ -0,0 +1,376 @@
+package gmp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// ============ 系统地探索交错顺序 ============
+//
+// 调度器控制着每一次上下文切换，所有的交错顺序都来自 choose 做出的决定
+// （见 replay_rem.go）。Explore 像 CHESS/Loom 一样反复运行同一段代码，
+// 每次强制一个不同的决定前缀，用深度优先的方式枚举所有的决定序列：
+//
+//   - 每次运行记录每个决定有几个选择，以及每个 M 运行的片段（segment）：
+//     从被 nextm 选中到 G park/让出/结束（或者 M 没有找到 G 而休眠）。
+//   - 下一次运行回到最深的一个还有未探索选择的决定，换一个选择，之后都选第一个。
+//   - 非默认选择（选择不是第一个）的次数不超过 PreemptionBound，
+//     与 CHESS 的抢占上界一样，大多数并发 bug 只需要很少几次"意外"的切换。
+//   - DPOR 式剪枝：nextm 处改选 M_b 只有在 M_b 接下来运行的片段与中间的片段相关时才有必要，
+//     否则交换两者得到的是等价的执行，已经被探索过了。
+//
+// 两个片段相关（不能交换顺序）是指：访问了同一个同步对象（信号量、NotifyList、
+// PollDesc，以及通过 Touch 报告的对象），一个创建或唤醒了另一个运行的 G，
+// 或者一个修改了另一个读取或修改的队列（P 的本地队列、全局队列、netpoll、
+// 空闲链表、定时器堆）。这要求 G 之间只通过同步原语共享数据，即程序没有数据竞争；
+// 有数据竞争的代码应该设置 ExploreOptions.NoPrune。
+
+// 片段访问的队列：P 的本地队列用 P 的 id 表示
+const (
+	qGlobal  int64 = -1
+	qNetpoll int64 = -2
+	qIdle    int64 = -3 // 空闲 P 和 M 链表
+	qTimers  int64 = -4
+)
+
+// exploring 为 true 时 Touch 需要记录访问，原子变量使 Touch 在不探索时不必加锁
+var exploring atomic.Bool
+
+// segment 是一个 M 在两次调度决定之间做的事
+type segment struct {
+	m       int64
+	p       int64
+	g       uint64 // 运行的 G，0 表示 M 没有找到 G 而休眠
+	src     string // G 的来源，见 Event.Source
+	writes  map[int64]bool
+	objs    map[uintptr]bool
+	readied map[uint64]bool // 创建或唤醒的 G
+}
+
+// exploreDecision 是一次运行中的一个决定
+type exploreDecision struct {
+	decision
+	cands []int64 // nextm 的候选 M，按选择的下标排列
+	seg   int     // nextm 选中的 M 接下来运行的片段
+}
+
+// exploreState 记录一次运行，由 sched.lock 保护
+type exploreState struct {
+	decisions []exploreDecision
+	segs      []segment
+	cur       *segment
+}
+
+func (x *exploreState) begin(mp *m) {
+	x.segs = append(x.segs, segment{
+		m:       mp.id,
+		p:       mp.p.id,
+		writes:  make(map[int64]bool),
+		objs:    make(map[uintptr]bool),
+		readied: make(map[uint64]bool),
+	})
+	x.cur = &x.segs[len(x.segs)-1]
+}
+
+func (x *exploreState) end(gp *g, src string) {
+	if x.cur == nil {
+		return
+	}
+	if gp != nil {
+		x.cur.g = gp.goid
+	}
+	x.cur.src = src
+	x.cur = nil
+}
+
+// 以下函数在不探索时什么都不做，调用者必须持有 sched.lock
+
+func explorewrite(q int64) {
+	if x := sched.explore; x != nil && x.cur != nil {
+		x.cur.writes[q] = true
+	}
+}
+
+func exploreready(gp *g) {
+	if x := sched.explore; x != nil && x.cur != nil {
+		x.cur.readied[gp.goid] = true
+	}
+}
+
+func exploretouch(addr unsafe.Pointer) {
+	if x := sched.explore; x != nil && x.cur != nil {
+		x.cur.objs[uintptr(addr)] = true
+	}
+}
+
+// Touch 报告当前 G 访问了 addr 处的共享对象
+// Explore 据此判断两段执行能否交换顺序；gmp/sync 中的同步原语都会调用它，
+// 在 G 之间通过其他方式共享数据时也可以手动调用。不在探索时什么都不做
+func Touch(addr unsafe.Pointer) {
+	if !exploring.Load() {
+		return
+	}
+	current().do(func() {
+		sched.lock.Lock()
+		exploretouch(addr)
+		sched.lock.Unlock()
+	})
+}
+
+// reads 返回片段读取的队列，all 为 true 表示读取了所有队列
+// findrunnable 按 本地队列、全局队列、netpoll、窃取 的顺序查找，
+// 从后面的来源拿到 G 说明前面的都是空的
+func (s *segment) reads() (qs []int64, all bool) {
+	switch s.src {
+	case "runnext", "runq":
+		return []int64{s.p}, false
+	case "global":
+		return []int64{s.p, qGlobal}, false
+	case "netpoll":
+		return []int64{s.p, qGlobal, qNetpoll}, false
+	}
+	return nil, true // 窃取或休眠
+}
+
+// conflicts 报告 a 写的队列是否被 b 读或写
+func conflicts(a, b *segment) bool {
+	if len(a.writes) == 0 {
+		return false
+	}
+	qs, all := b.reads()
+	if all {
+		return true
+	}
+	for _, q := range qs {
+		if a.writes[q] {
+			return true
+		}
+	}
+	for q := range b.writes {
+		if a.writes[q] {
+			return true
+		}
+	}
+	return false
+}
+
+// dependent 报告两个片段是否相关，即交换它们的顺序可能得到不同的结果
+func dependent(a, b *segment) bool {
+	if a.g != 0 && (a.g == b.g || b.readied[a.g]) || b.g != 0 && a.readied[b.g] {
+		return true
+	}
+	for o := range a.objs {
+		if b.objs[o] {
+			return true
+		}
+	}
+	return conflicts(a, b) || conflicts(b, a)
+}
+
+// alternatives 返回决定 i 处还需要探索的其他选择
+func (x *exploreState) alternatives(i int, prune bool) []int {
+	d := &x.decisions[i]
+	var alts []int
+	for c := 0; c < d.n; c++ {
+		if c == d.choice {
+			continue
+		}
+		if !prune || d.kind != decNextm || x.needed(d, d.cands[c]) {
+			alts = append(alts, c)
+		}
+	}
+	return alts
+}
+
+// needed 报告在决定 d 处改选 M mid 是否可能得到新的执行
+func (x *exploreState) needed(d *exploreDecision, mid int64) bool {
+	j := -1
+	for k := d.seg + 1; k < len(x.segs); k++ {
+		if x.segs[k].m == mid {
+			j = k
+			break
+		}
+	}
+	if j < 0 {
+		// mid 之后再也没有运行，不知道它会做什么
+		return true
+	}
+	for k := d.seg; k < j; k++ {
+		if dependent(&x.segs[k], &x.segs[j]) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExploreOptions 是 Explore 的选项
+type ExploreOptions struct {
+	// Procs 是 P 的数量，0 表示 2
+	Procs int
+	// PreemptionBound 是每个调度中非默认选择的最大次数，0 表示 2，负数表示不限制
+	PreemptionBound int
+	// MaxSchedules 是最多运行的调度数，0 表示 10000
+	MaxSchedules int
+	// NoPrune 为 true 时不做 DPOR 式剪枝，枚举上界内的所有调度
+	NoPrune bool
+}
+
+// ExploreResult 是 Explore 的结果
+type ExploreResult struct {
+	Schedules int  // 运行的调度数
+	Complete  bool // 是否探索完了上界内的所有调度（没有因为 MaxSchedules 停止）
+	// Err 是第一个失败的调度的错误，Replay 是它的录制文件，可以交给 Replay 重现
+	Err    error
+	Replay []byte
+}
+
+// exploreEpoch 是探索时虚拟时钟的起点
+var exploreEpoch = time.Unix(0, 0)
+
+// exploreNode 是深度优先搜索路径上的一个决定
+type exploreNode struct {
+	decision
+	done []bool // 已经探索过的选择
+	todo []bool // 需要探索的选择
+}
+
+// Explore 反复调用 run，每次在不同的调度下运行，直到 run 返回错误（或 panic），
+// 或者探索完所有调度。每次调用 run 之前调度器都会用虚拟时钟重新初始化，
+// run 应该创建 G、调用 RunE 并检查结果，例如：
+//
+//	gmp.Explore(opts, func() error {
+//		gmp.Go(body)
+//		return gmp.RunE() // 死锁时返回 *DeadlockError
+//	})
+//
+// run 中的代码必须是确定的：同样的调度决定要得到同样的执行，因此不能使用 Syscall 和真实时间
+func Explore(opts ExploreOptions, run func() error) ExploreResult {
+	if opts.Procs == 0 {
+		opts.Procs = 2
+	}
+	if opts.PreemptionBound == 0 {
+		opts.PreemptionBound = 2
+	}
+	if opts.MaxSchedules == 0 {
+		opts.MaxSchedules = 10000
+	}
+
+	var res ExploreResult
+	var path []*exploreNode
+	for {
+		if res.Schedules >= opts.MaxSchedules {
+			return res
+		}
+		prefix := make([]decision, len(path))
+		for i, node := range path {
+			prefix[i] = node.decision
+		}
+		x, err := exploreOnce(opts.Procs, prefix, run)
+		res.Schedules++
+		if err != nil {
+			var re *ReplayError
+			if errors.As(err, &re) {
+				err = fmt.Errorf("gmp: explore: run is not deterministic: %w", err)
+			}
+			res.Err = err
+			res.Replay = replayFile(opts.Procs, x.decisions)
+			return res
+		}
+
+		for _, d := range x.decisions[len(path):] {
+			node := &exploreNode{decision: d.decision, done: make([]bool, d.n), todo: make([]bool, d.n)}
+			node.done[d.choice] = true
+			path = append(path, node)
+		}
+
+		// 在路径上每个决定处加入需要探索的选择
+		preempts := 0
+		for i, node := range path {
+			for _, c := range x.alternatives(i, !opts.NoPrune) {
+				n := preempts
+				if c != 0 {
+					n++
+				}
+				if opts.PreemptionBound < 0 || n <= opts.PreemptionBound {
+					node.todo[c] = true
+				}
+			}
+			if node.choice != 0 {
+				preempts++
+			}
+		}
+
+		// 回到最深的还有未探索选择的决定
+		next := -1
+		for i := len(path) - 1; i >= 0 && next < 0; i-- {
+			for c, todo := range path[i].todo {
+				if todo && !path[i].done[c] {
+					path[i].choice = c
+					path[i].done[c] = true
+					next = i
+					break
+				}
+			}
+		}
+		if next < 0 {
+			res.Complete = true
+			return res
+		}
+		path = path[:next+1]
+	}
+}
+
+// exploreOnce 在强制 prefix 的调度下运行一次 run
+func exploreOnce(procs int, prefix []decision, run func() error) (x *exploreState, err error) {
+	if err := InitWithConfig(Config{Procs: procs, Clock: NewVirtualClock(exploreEpoch)}); err != nil {
+		return &exploreState{}, err
+	}
+	x = &exploreState{}
+	defaultSched.do(func() {
+		sched.lock.Lock()
+		sched.decide.replay = prefix
+		sched.explore = x
+		sched.lock.Unlock()
+	})
+	exploring.Store(true)
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		exploring.Store(false)
+		defaultSched.do(func() {
+			sched.lock.Lock()
+			sched.explore = nil
+			if err == nil && sched.decide.err != nil {
+				err = sched.decide.err
+			}
+			sched.lock.Unlock()
+		})
+	}()
+	return x, run()
+}
+
+// recordexplore 记录 choose 做出的决定，调用者必须持有 sched.lock
+func recordexplore(kind string, choice, n int) {
+	if x := sched.explore; x != nil {
+		x.decisions = append(x.decisions, exploreDecision{
+			decision: decision{kind: kind, choice: choice, n: n},
+			seg:      len(x.segs),
+		})
+	}
+}
+
+// replayFile 把决定写成 Replay 可以读取的录制文件
+func replayFile(procs int, decisions []exploreDecision) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s seed=0 procs=%d\n", replayHeader, procs)
+	for _, d := range decisions {
+		fmt.Fprintf(&b, "%s %d/%d\n", d.kind, d.choice, d.n)
+	}
+	return b.Bytes()
+}
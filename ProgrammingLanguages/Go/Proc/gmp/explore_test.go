@@ -0,0 +1,155 @@
+package gmp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"unsafe"
+)
+
+// yield 让出当前 G
+func yield() {
+	sched.lock.Lock()
+	goyield()
+}
+
+// lostUpdate 中两个 G 先读计数器，让出之后再写回，某些交错下会丢失一次更新
+// 第二个 G 先让出两次，默认的调度下两个 G 不会交错
+func lostUpdate(lock bool) func() error {
+	return func() error {
+		counter := 0
+		sema := uint32(1)
+		for i := 0; i < 2; i++ {
+			delay := 2 * i
+			Go(func() {
+				for j := 0; j < delay; j++ {
+					yield()
+				}
+				if lock {
+					Semacquire(&sema)
+				}
+				Touch(unsafe.Pointer(&counter))
+				v := counter
+				yield()
+				Touch(unsafe.Pointer(&counter))
+				counter = v + 1
+				if lock {
+					Semrelease(&sema, false)
+				}
+			})
+		}
+		if err := RunE(); err != nil {
+			return err
+		}
+		if counter != 2 {
+			return fmt.Errorf("counter = %d", counter)
+		}
+		return nil
+	}
+}
+
+func TestExploreFindsBug(t *testing.T) {
+	res := Explore(ExploreOptions{}, lostUpdate(false))
+	if res.Err == nil {
+		t.Fatalf("应该找到丢失更新，运行了 %d 个调度", res.Schedules)
+	}
+	if res.Schedules == 1 {
+		t.Errorf("默认的调度不应该失败: %v", res.Err)
+	}
+	if !bytes.HasPrefix(res.Replay, []byte("gmp-replay v1 seed=0 procs=2\n")) {
+		t.Fatalf("录制文件错误:\n%s", res.Replay)
+	}
+
+	// 用录制文件重现失败的调度
+	initVirtual(t, 2)
+	if err := Replay(bytes.NewReader(res.Replay)); err != nil {
+		t.Fatal(err)
+	}
+	if err := lostUpdate(false)(); err == nil || err.Error() != res.Err.Error() {
+		t.Errorf("回放应该得到同样的错误 %v，实际为 %v", res.Err, err)
+	}
+}
+
+func TestExploreComplete(t *testing.T) {
+	res := Explore(ExploreOptions{}, lostUpdate(true))
+	if res.Err != nil {
+		t.Fatalf("加锁后不应该失败: %v\n%s", res.Err, res.Replay)
+	}
+	if !res.Complete || res.Schedules < 2 {
+		t.Errorf("应该探索完所有调度: %+v", res)
+	}
+}
+
+func TestExploreDeadlock(t *testing.T) {
+	// 两个 G 以相反的顺序获取两个信号量
+	res := Explore(ExploreOptions{}, func() error {
+		a, b := uint32(1), uint32(1)
+		Go(func() {
+			Semacquire(&a)
+			yield()
+			Semacquire(&b)
+			Semrelease(&b, false)
+			Semrelease(&a, false)
+		})
+		Go(func() {
+			Semacquire(&b)
+			yield()
+			Semacquire(&a)
+			Semrelease(&a, false)
+			Semrelease(&b, false)
+		})
+		return RunE()
+	})
+	var de *DeadlockError
+	if !errors.As(res.Err, &de) {
+		t.Fatalf("应该找到死锁，实际为 %v", res.Err)
+	}
+}
+
+func TestExplorePanic(t *testing.T) {
+	res := Explore(ExploreOptions{}, func() error {
+		Go(func() { panic("boom") })
+		return RunE()
+	})
+	if res.Err == nil || res.Schedules != 1 {
+		t.Fatalf("panic 应该在第一个调度中被报告: %+v", res)
+	}
+}
+
+func TestExplorePrune(t *testing.T) {
+	// 互不相关的 G：所有交错都是等价的
+	independent := func() error {
+		for i := 0; i < 3; i++ {
+			Go(func() {
+				x := 0
+				for j := 0; j < 3; j++ {
+					Touch(unsafe.Pointer(&x))
+					yield()
+				}
+			})
+		}
+		return RunE()
+	}
+	pruned := Explore(ExploreOptions{}, independent)
+	full := Explore(ExploreOptions{NoPrune: true}, independent)
+	if pruned.Err != nil || full.Err != nil {
+		t.Fatal(pruned.Err, full.Err)
+	}
+	if !pruned.Complete || !full.Complete {
+		t.Fatalf("应该探索完所有调度: %+v %+v", pruned, full)
+	}
+	if pruned.Schedules >= full.Schedules {
+		t.Errorf("剪枝后的调度数 %d 应该少于 %d", pruned.Schedules, full.Schedules)
+	}
+
+	bounded := Explore(ExploreOptions{NoPrune: true, PreemptionBound: 1}, independent)
+	if bounded.Schedules >= full.Schedules {
+		t.Errorf("抢占上界为 1 时的调度数 %d 应该少于 %d", bounded.Schedules, full.Schedules)
+	}
+
+	limited := Explore(ExploreOptions{NoPrune: true, MaxSchedules: 2}, independent)
+	if limited.Schedules != 2 || limited.Complete {
+		t.Errorf("MaxSchedules 应该限制调度数: %+v", limited)
+	}
+}
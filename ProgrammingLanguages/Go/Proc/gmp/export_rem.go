@@ -0,0 +1,232 @@
+package gmp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ============ 导出为图 ============
+//
+// 把 Snapshot 得到的 G-M-P 绑定关系画成 Mermaid 或 Graphviz 的图：
+// M 和它持有的 P 相连，P 后面依次是 runnext 和本地队列中的 G，
+// 另外画出全局队列和空闲 P、M 链表。文档中手画的 GMP 图可以用真实的运行状态重新生成。
+// ExportMermaidTrace 把 StopTrace 写出的执行追踪转换成 Mermaid 时序图。
+
+// ExportMermaid 把当前的 G-M-P 绑定关系写成 Mermaid 流程图（graph LR）
+func ExportMermaid(w io.Writer) error {
+	return exportMermaid(w, Snapshot())
+}
+
+// ExportDOT 把当前的 G-M-P 绑定关系写成 Graphviz 的 DOT 格式
+func ExportDOT(w io.Writer) error {
+	return exportDOT(w, Snapshot())
+}
+
+func exportMermaid(w io.Writer, si SchedInfo) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "graph LR")
+
+	for _, mi := range si.Ms {
+		label := fmt.Sprintf("M%d", mi.ID)
+		switch {
+		case mi.Spinning:
+			label += "<br/>spinning"
+		case mi.Idle:
+			label += "<br/>idle"
+		}
+		fmt.Fprintf(bw, "    M%d([\"%s\"])\n", mi.ID, label)
+		if mi.P >= 0 {
+			fmt.Fprintf(bw, "    M%d === P%d\n", mi.ID, mi.P)
+		}
+		if mi.Curg != 0 {
+			fmt.Fprintf(bw, "    M%d -->|curg| G%d((\"G%d\"))\n", mi.ID, mi.Curg, mi.Curg)
+		}
+	}
+
+	for _, pi := range si.Procs {
+		fmt.Fprintf(bw, "    P%d[\"P%d<br/>%s\"]\n", pi.ID, pi.ID, pi.Status)
+		if pi.Runnext != 0 {
+			fmt.Fprintf(bw, "    P%d -->|runnext| G%d((\"G%d\"))\n", pi.ID, pi.Runnext, pi.Runnext)
+		}
+		prev, label := fmt.Sprintf("P%d", pi.ID), "|runq| "
+		for _, id := range pi.Runq {
+			fmt.Fprintf(bw, "    %s --> %sG%d((\"G%d\"))\n", prev, label, id, id)
+			prev, label = fmt.Sprintf("G%d", id), ""
+		}
+	}
+
+	if len(si.GlobalRunq) > 0 {
+		fmt.Fprintln(bw, "    runq[[\"全局队列\"]]")
+		prev := "runq"
+		for _, id := range si.GlobalRunq {
+			fmt.Fprintf(bw, "    %s --> G%d((\"G%d\"))\n", prev, id, id)
+			prev = fmt.Sprintf("G%d", id)
+		}
+	}
+	if len(si.IdleProcs) > 0 {
+		fmt.Fprintln(bw, "    pidle[[\"空闲 P\"]]")
+		prev := "pidle"
+		for _, id := range si.IdleProcs {
+			fmt.Fprintf(bw, "    %s -.-> P%d\n", prev, id)
+			prev = fmt.Sprintf("P%d", id)
+		}
+	}
+	if len(si.IdleMs) > 0 {
+		fmt.Fprintln(bw, "    midle[[\"空闲 M\"]]")
+		prev := "midle"
+		for _, id := range si.IdleMs {
+			fmt.Fprintf(bw, "    %s -.-> M%d\n", prev, id)
+			prev = fmt.Sprintf("M%d", id)
+		}
+	}
+	return bw.Flush()
+}
+
+func exportDOT(w io.Writer, si SchedInfo) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph gmp {")
+	fmt.Fprintln(bw, "    rankdir=LR;")
+	fmt.Fprintln(bw, "    node [fontname=\"Helvetica\"];")
+
+	for _, mi := range si.Ms {
+		label := fmt.Sprintf("M%d", mi.ID)
+		switch {
+		case mi.Spinning:
+			label += "\\nspinning"
+		case mi.Idle:
+			label += "\\nidle"
+		}
+		fmt.Fprintf(bw, "    M%d [shape=box, style=rounded, label=\"%s\"];\n", mi.ID, label)
+		if mi.P >= 0 {
+			fmt.Fprintf(bw, "    M%d -> P%d [dir=none, penwidth=2];\n", mi.ID, mi.P)
+		}
+		if mi.Curg != 0 {
+			fmt.Fprintf(bw, "    G%d [shape=circle];\n", mi.Curg)
+			fmt.Fprintf(bw, "    M%d -> G%d [label=\"curg\"];\n", mi.ID, mi.Curg)
+		}
+	}
+
+	for _, pi := range si.Procs {
+		fmt.Fprintf(bw, "    P%d [shape=box, label=\"P%d\\n%s\"];\n", pi.ID, pi.ID, pi.Status)
+		if pi.Runnext != 0 {
+			fmt.Fprintf(bw, "    G%d [shape=circle];\n", pi.Runnext)
+			fmt.Fprintf(bw, "    P%d -> G%d [label=\"runnext\"];\n", pi.ID, pi.Runnext)
+		}
+		prev, label := fmt.Sprintf("P%d", pi.ID), " [label=\"runq\"]"
+		for _, id := range pi.Runq {
+			fmt.Fprintf(bw, "    G%d [shape=circle];\n", id)
+			fmt.Fprintf(bw, "    %s -> G%d%s;\n", prev, id, label)
+			prev, label = fmt.Sprintf("G%d", id), ""
+		}
+	}
+
+	if len(si.GlobalRunq) > 0 {
+		fmt.Fprintln(bw, "    runq [shape=cylinder, label=\"全局队列\"];")
+		prev := "runq"
+		for _, id := range si.GlobalRunq {
+			fmt.Fprintf(bw, "    G%d [shape=circle];\n", id)
+			fmt.Fprintf(bw, "    %s -> G%d;\n", prev, id)
+			prev = fmt.Sprintf("G%d", id)
+		}
+	}
+	if len(si.IdleProcs) > 0 {
+		fmt.Fprintln(bw, "    pidle [shape=cylinder, label=\"空闲 P\"];")
+		prev := "pidle"
+		for _, id := range si.IdleProcs {
+			fmt.Fprintf(bw, "    %s -> P%d [style=dashed];\n", prev, id)
+			prev = fmt.Sprintf("P%d", id)
+		}
+	}
+	if len(si.IdleMs) > 0 {
+		fmt.Fprintln(bw, "    midle [shape=cylinder, label=\"空闲 M\"];")
+		prev := "midle"
+		for _, id := range si.IdleMs {
+			fmt.Fprintf(bw, "    %s -> M%d [style=dashed];\n", prev, id)
+			prev = fmt.Sprintf("M%d", id)
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// ExportMermaidTrace 读取 StopTrace 写出的执行追踪，把其中 G 的创建、窃取、
+// 从全局队列获取、开始运行、park 和结束写成 Mermaid 时序图（sequenceDiagram）
+// 每个 P 是一个参与者，全局队列是第一个参与者
+func ExportMermaidTrace(w io.Writer, r io.Reader) error {
+	var trace struct {
+		TraceEvents []chromeEvent `json:"traceEvents"`
+	}
+	if err := json.NewDecoder(r).Decode(&trace); err != nil {
+		return fmt.Errorf("gmp: reading trace: %w", err)
+	}
+
+	// thread_name 元数据给出每条轨道的名字：tid 0 是 Sched，其余是 P
+	names := make(map[int64]string)
+	for _, ce := range trace.TraceEvents {
+		if ce.Ph == "M" && ce.Name == "thread_name" && ce.Tid != traceSchedTid {
+			if name, ok := ce.Args["name"].(string); ok {
+				names[ce.Tid] = name
+			}
+		}
+	}
+	tids := make([]int64, 0, len(names))
+	for tid := range names {
+		tids = append(tids, tid)
+	}
+	sort.Slice(tids, func(i, j int) bool { return tids[i] < tids[j] })
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "sequenceDiagram")
+	fmt.Fprintln(bw, "    participant runq as 全局队列")
+	for _, tid := range tids {
+		fmt.Fprintf(bw, "    participant %s\n", names[tid])
+	}
+
+	for _, ce := range trace.TraceEvents {
+		p, ok := names[ce.Tid]
+		if !ok || ce.Ph == "M" || ce.Ph == "E" {
+			continue
+		}
+		g := argInt(ce.Args, "g")
+		switch {
+		case ce.Ph == "B" && strings.HasPrefix(ce.Name, "G"):
+			fmt.Fprintf(bw, "    Note over %s: run %s\n", p, mermaidText(ce.Name))
+		case ce.Name == "GoCreate":
+			if parent := argInt(ce.Args, "parent"); parent != 0 {
+				fmt.Fprintf(bw, "    %s->>%s: G%d 创建 G%d\n", p, p, parent, argInt(ce.Args, "newg"))
+			} else {
+				fmt.Fprintf(bw, "    %s->>%s: 创建 G%d\n", p, p, argInt(ce.Args, "newg"))
+			}
+		case ce.Name == "Steal":
+			victim, _ := ce.Args["victim"].(string)
+			fmt.Fprintf(bw, "    %s->>%s: 窃取 %d 个 G\n", victim, p, argInt(ce.Args, "count"))
+		case ce.Name == "GlobalGet":
+			fmt.Fprintf(bw, "    runq->>%s: 获取 %d 个 G\n", p, argInt(ce.Args, "count"))
+		case ce.Name == "GoPark":
+			reason, _ := ce.Args["reason"].(string)
+			fmt.Fprintf(bw, "    Note over %s: G%d park (%s)\n", p, g, mermaidText(reason))
+		case ce.Name == "GoSched":
+			fmt.Fprintf(bw, "    Note over %s: G%d yield\n", p, g)
+		case ce.Name == "GoEnd":
+			fmt.Fprintf(bw, "    Note over %s: G%d exit\n", p, g)
+		case ce.Name == "SyscallEnter":
+			fmt.Fprintf(bw, "    Note over %s: G%d syscall\n", p, g)
+		}
+	}
+	return bw.Flush()
+}
+
+// argInt 读取追踪事件中的整数参数，JSON 解码后数字都是 float64
+func argInt(args map[string]any, key string) int64 {
+	f, _ := args[key].(float64)
+	return int64(f)
+}
+
+// mermaidText 去掉会破坏 Mermaid 语法的字符
+func mermaidText(s string) string {
+	return strings.NewReplacer(";", ",", "#", "", ":", " ").Replace(s)
+}
@@ -0,0 +1,115 @@
+package gmp
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// exportState 构造一个有 runnext、本地队列、全局队列和空闲 P 的状态
+func exportState(t *testing.T) (runnext, runq, global uint64) {
+	initVirtual(t, 2)
+	a := newproc1(func() {}, nil, 0)
+	b := newproc1(func() {}, nil, 0)
+	c := newG(func() {})
+	c.status = _Grunnable
+	allgadd(c)
+	globrunqput(c)
+	return b.goid, a.goid, c.goid
+}
+
+func TestExportMermaid(t *testing.T) {
+	ownengine(t)
+	runnext, runq, global := exportState(t)
+
+	var buf bytes.Buffer
+	if err := ExportMermaid(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"graph LR\n",
+		"M0 === P0",
+		fmt.Sprintf("P0 -->|runnext| G%d((\"G%d\"))", runnext, runnext),
+		fmt.Sprintf("P0 --> |runq| G%d", runq),
+		fmt.Sprintf("runq --> G%d", global),
+		"pidle -.-> P1",
+		`P1["P1<br/>idle"]`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("输出中应该有 %q:\n%s", want, out)
+		}
+	}
+	Run()
+}
+
+func TestExportDOT(t *testing.T) {
+	ownengine(t)
+	runnext, runq, global := exportState(t)
+
+	var buf bytes.Buffer
+	if err := ExportDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "digraph gmp {\n") || !strings.HasSuffix(out, "}\n") {
+		t.Errorf("DOT 格式错误:\n%s", out)
+	}
+	for _, want := range []string{
+		"M0 -> P0 [dir=none",
+		fmt.Sprintf("P0 -> G%d [label=\"runnext\"];", runnext),
+		fmt.Sprintf("P0 -> G%d [label=\"runq\"];", runq),
+		fmt.Sprintf("runq -> G%d;", global),
+		"pidle -> P1 [style=dashed];",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("输出中应该有 %q:\n%s", want, out)
+		}
+	}
+	Run()
+}
+
+func TestExportMermaidTrace(t *testing.T) {
+	initVirtual(t, 2)
+
+	var trace bytes.Buffer
+	if err := StartTrace(&trace); err != nil {
+		t.Fatal(err)
+	}
+	var parent uint64
+	Go(func() {
+		parent = getg().goid
+		for i := 0; i < 4; i++ {
+			Go(func() {})
+		}
+	})
+	Run()
+	if err := StopTrace(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := ExportMermaidTrace(&buf, &trace); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"sequenceDiagram\n",
+		"participant runq as 全局队列",
+		"participant P0\n",
+		"participant P1\n",
+		fmt.Sprintf("P0->>P0: G%d 创建 G%d", parent, parent+1),
+		"P0->>P1: 窃取",
+		fmt.Sprintf("Note over P0: run G%d ", parent),
+		fmt.Sprintf("Note over P0: G%d exit", parent),
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("输出中应该有 %q:\n%s", want, out)
+		}
+	}
+
+	if err := ExportMermaidTrace(&buf, strings.NewReader("not json")); err == nil {
+		t.Error("不合法的追踪应该返回错误")
+	}
+}
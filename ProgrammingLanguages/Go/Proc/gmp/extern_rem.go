@@ -0,0 +1,73 @@
+package gmp
+
+// ============ 调度器之外的调用者 ============
+//
+// runtime 用 TLS 区分调用者：cgo 回调所在的外部线程上 getg() 为 nil，needm 先借一个 extra M。
+// 这里用调用者所在 goroutine 的标识（gtoken）代替 TLS：装入实例的 goroutine（runengine 的调用者）
+// 把自己的标识记在 owner 中，切换到 G 的协程时由协程换成它自己的，协程切回后再换回来。
+// 所以 owner 总是正在执行装入的实例的那个 goroutine，和它不同的调用者都是外部的，
+// 即使它调用时调度器恰好在运行某个 G。
+//
+// 调度器用 Start 在后台运行时，外部的 Go 不获取 enginemu，而是把 fn 放入实例自己的
+// 注入队列（extq，由 extmu 保护）并唤醒调度循环，调度循环在每一步之前把它们放入全局队列
+// 并唤醒空闲的 P（extinject）。成千上万个 goroutine 同时提交时只竞争 extmu，不会和调度循环
+// 抢 enginemu。没有在后台运行时外部的 Go 获取 enginemu 后直接创建 G。
+
+// extg 是一个外部提交的、还没有创建 G 的函数
+type extg struct {
+	fn func()
+	pc uintptr
+}
+
+// inject 把 fns 放入 s 的注入队列并唤醒调度循环
+// Shutdown 之后不用等 enginemu 就返回 ErrShutdown。
+// s 没有在后台运行时返回 false，由调用者走 enginemu 的路径
+func (s *Scheduler) inject(fns []func(), pc uintptr) (bool, error) {
+	s.extmu.Lock()
+	defer s.extmu.Unlock()
+	if s.extshut {
+		return true, &SchedError{Op: "Go", Err: ErrShutdown}
+	}
+	if !s.extopen {
+		return false, nil
+	}
+	for _, fn := range fns {
+		s.extq = append(s.extq, extg{fn, pc})
+	}
+	s.extpending.Store(true)
+	select {
+	case s.extwake <- struct{}{}:
+	default:
+	}
+	return true, nil
+}
+
+// setextopen 打开或关闭 s 的注入队列，调用者必须已经装入 s
+// 关闭时把剩下的函数创建为 G，保证 inject 成功的提交不会丢失。shutdown 为 true 时之后的提交被拒绝
+func (s *Scheduler) setextopen(open, shutdown bool) {
+	s.extmu.Lock()
+	s.extopen, s.extshut = open, shutdown
+	s.extwake = sched.wakeup
+	s.extmu.Unlock()
+	if !open {
+		sched.lock.Lock()
+		extinject()
+		sched.lock.Unlock()
+	}
+}
+
+// extinject 把当前实例注入队列中的函数创建为 G，放入全局队列并唤醒空闲的 P
+// 对应 runtime 的 injectglist。调用者必须持有 sched.lock
+func extinject() {
+	s := cursched
+	if !s.extpending.Load() {
+		return
+	}
+	s.extmu.Lock()
+	q := s.extq
+	s.extq = nil
+	s.extpending.Store(false)
+	s.extmu.Unlock()
+
+	newprocext(q)
+}
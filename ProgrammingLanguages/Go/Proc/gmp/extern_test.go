@@ -0,0 +1,106 @@
+package gmp
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestExternalSubmitters(t *testing.T) {
+	s := newVirtual(t, 4)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 几千个 goroutine 同时提交，每个 G 再创建一个子 G
+	const n = 2000
+	count := 0
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn := func() {
+				count++
+				Go(func() { count++ })
+			}
+			switch i % 3 {
+			case 0:
+				s.Go(fn)
+			case 1:
+				s.GoBatch([]func(){fn})
+			case 2:
+				if err := s.TryGo(fn); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2*n {
+		t.Errorf("count = %d，应该是 %d", count, 2*n)
+	}
+}
+
+func TestExternalWhileGRunning(t *testing.T) {
+	initVirtual(t, 1)
+	s := newVirtual(t, 2)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// s 的 G 正在运行时，s.Go 不需要等这个 G 让出 enginemu；
+	// 另一个 goroutine 调用的包级 Go 属于默认实例，要等 enginemu
+	ran := false
+	var wg sync.WaitGroup
+	finished := make(chan struct{})
+	s.Go(func() {
+		defer close(finished)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				Go(func() {})
+			}()
+			s.Go(func() { ran = true })
+		}()
+		<-done
+	})
+	<-finished
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if !ran {
+		t.Error("外部提交的 G 应该运行")
+	}
+	if si := Snapshot(); len(si.Gs) != 1 {
+		t.Errorf("包级 Go 应该在默认实例上创建 G: %+v", si)
+	}
+}
+
+func TestGoFromDeepStack(t *testing.T) {
+	// 栈很深时 G 也要被当作正在执行实例的调用者，而不是外部的调用者
+	initVirtual(t, 1)
+	ran := false
+	var deep func(n int)
+	deep = func(n int) {
+		if n > 0 {
+			deep(n - 1)
+			return
+		}
+		Go(func() { ran = true })
+	}
+	Go(func() { deep(200) })
+	Run()
+	if !ran {
+		t.Error("深栈中创建的 G 应该运行")
+	}
+}
@@ -0,0 +1,439 @@
+// Package fakenet 是一个没有文件描述符的内存网络，由 gmp 调度器驱动
+//
+// Listen/Dial 返回标准的 net.Listener 和 net.Conn。读写在数据未就绪时
+// 通过 gmp.PollDesc park 当前 G，数据到达时由网络轮询器唤醒；
+// 传输延迟和带宽都以调度器的时钟计算，配合 gmp.VirtualClock 可以在
+// 单元测试中确定地模拟整个客户端/服务器系统。
+//
+// 所有阻塞操作（Accept、Dial、Read、Write）只能在 gmp 创建的 Goroutine 中调用
+package fakenet
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"go-rem/gmp"
+)
+
+// Config 是网络的传输参数
+type Config struct {
+	// Latency 是单向传输延迟
+	Latency time.Duration
+	// Bandwidth 是每个连接每个方向的带宽（字节/秒），0 表示不限
+	Bandwidth int64
+}
+
+// Network 是一个独立的内存网络，拥有自己的地址空间
+type Network struct {
+	cfg Config
+
+	mu        sync.Mutex
+	listeners map[string]*listener
+	nextPort  int
+}
+
+// New 创建一个新的内存网络
+func New(cfg Config) *Network {
+	return &Network{
+		cfg:       cfg,
+		listeners: make(map[string]*listener),
+		nextPort:  49152,
+	}
+}
+
+var defaultNetwork = New(Config{})
+
+// Default 返回 Listen/Dial 使用的默认网络
+func Default() *Network {
+	return defaultNetwork
+}
+
+// Listen 在默认网络上监听 address
+func Listen(network, address string) (net.Listener, error) {
+	return defaultNetwork.Listen(network, address)
+}
+
+// Dial 在默认网络上连接 address
+func Dial(network, address string) (net.Conn, error) {
+	return defaultNetwork.Dial(network, address)
+}
+
+// SetConfig 修改网络的传输参数，只影响之后建立的连接
+func (n *Network) SetConfig(cfg Config) {
+	n.mu.Lock()
+	n.cfg = cfg
+	n.mu.Unlock()
+}
+
+// Addr 是 fakenet 的地址
+type Addr struct {
+	Net  string
+	Host string
+	Port int
+}
+
+func (a Addr) Network() string { return a.Net }
+func (a Addr) String() string  { return net.JoinHostPort(a.Host, strconv.Itoa(a.Port)) }
+
+// Listen 在 address（host:port）上监听，port 为 0 时自动分配
+func (n *Network) Listen(network, address string) (net.Listener, error) {
+	host, port, err := n.parseAddr(network, address)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: network, Err: err}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if port == 0 {
+		port = n.nextPort
+		n.nextPort++
+	}
+	addr := Addr{Net: network, Host: host, Port: port}
+	if _, ok := n.listeners[addr.String()]; ok {
+		return nil, &net.OpError{Op: "listen", Net: network, Addr: addr, Err: syscall.EADDRINUSE}
+	}
+	l := &listener{
+		n:    n,
+		addr: addr,
+		pd:   gmp.NewPollDesc(),
+	}
+	n.listeners[addr.String()] = l
+	return l, nil
+}
+
+// Dial 连接到 address 上的监听者
+// 连接在一个往返延迟后建立，服务端在单向延迟后才能 Accept 到它
+func (n *Network) Dial(network, address string) (net.Conn, error) {
+	host, port, err := n.parseAddr(network, address)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+	raddr := Addr{Net: network, Host: host, Port: port}
+
+	n.mu.Lock()
+	l := n.listeners[raddr.String()]
+	cfg := n.cfg
+	laddr := Addr{Net: network, Host: "127.0.0.1", Port: n.nextPort}
+	n.nextPort++
+	n.mu.Unlock()
+
+	if l == nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Addr: raddr, Err: syscall.ECONNREFUSED}
+	}
+
+	client, server := newConnPair(cfg, laddr, raddr)
+	gmp.AfterFunc(cfg.Latency, func() {
+		l.enqueue(server)
+	})
+	gmp.Sleep(2 * cfg.Latency)
+	return client, nil
+}
+
+func (n *Network) parseAddr(network, address string) (string, int, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return "", 0, net.UnknownNetworkError(network)
+	}
+	host, ps, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, err
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	port, err := strconv.Atoi(ps)
+	if err != nil || port < 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port %q", ps)
+	}
+	return host, port, nil
+}
+
+// ============ Listener ============
+
+type listener struct {
+	n    *Network
+	addr Addr
+	pd   *gmp.PollDesc
+
+	mu      sync.Mutex
+	backlog []*conn
+	closed  bool
+}
+
+// enqueue 把一个已建立的连接放入 backlog 并唤醒 Accept
+func (l *listener) enqueue(c *conn) {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		c.Close()
+		return
+	}
+	l.backlog = append(l.backlog, c)
+	l.mu.Unlock()
+	l.pd.ReadyRead()
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	for {
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			return nil, &net.OpError{Op: "accept", Net: l.addr.Net, Addr: l.addr, Err: net.ErrClosed}
+		}
+		if len(l.backlog) > 0 {
+			c := l.backlog[0]
+			l.backlog = l.backlog[1:]
+			l.mu.Unlock()
+			return c, nil
+		}
+		l.mu.Unlock()
+
+		if err := l.pd.WaitRead(); err != nil {
+			return nil, &net.OpError{Op: "accept", Net: l.addr.Net, Addr: l.addr, Err: err}
+		}
+	}
+}
+
+func (l *listener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return &net.OpError{Op: "close", Net: l.addr.Net, Addr: l.addr, Err: net.ErrClosed}
+	}
+	l.closed = true
+	pending := l.backlog
+	l.backlog = nil
+	l.mu.Unlock()
+
+	l.n.mu.Lock()
+	delete(l.n.listeners, l.addr.String())
+	l.n.mu.Unlock()
+
+	l.pd.Close()
+	for _, c := range pending {
+		c.Close()
+	}
+	return nil
+}
+
+func (l *listener) Addr() net.Addr { return l.addr }
+
+// ============ Conn ============
+
+// pipe 是连接的一个方向
+type pipe struct {
+	cfg Config
+
+	mu        sync.Mutex
+	buf       []byte
+	eof       bool      // 写端已关闭，并且 FIN 已经到达
+	busyUntil time.Time // 带宽被占用到何时
+	pd        *gmp.PollDesc
+}
+
+// deliver 在数据到达接收端时调用
+func (p *pipe) deliver(b []byte, eof bool) {
+	p.mu.Lock()
+	p.buf = append(p.buf, b...)
+	if eof {
+		p.eof = true
+	}
+	p.mu.Unlock()
+	p.pd.ReadyRead()
+}
+
+// segment 是一次 send 安排的投递
+type segment struct {
+	b           []byte
+	eof         bool
+	start, done time.Time  // 按带宽开始和完成发送的时间
+	timer       *gmp.Timer // 到达接收端时投递，nil 表示已经投递
+}
+
+// send 按带宽和延迟安排 b 的投递，segment 的 done 是发送端完成发送的时间
+func (p *pipe) send(b []byte, eof bool) *segment {
+	now := gmp.Now()
+
+	p.mu.Lock()
+	start := p.busyUntil
+	if start.Before(now) {
+		start = now
+	}
+	done := start
+	if p.cfg.Bandwidth > 0 {
+		done = start.Add(time.Duration(int64(len(b)) * int64(time.Second) / p.cfg.Bandwidth))
+	}
+	p.busyUntil = done
+	p.mu.Unlock()
+
+	seg := &segment{b: b, eof: eof, start: start, done: done}
+	p.schedule(seg, now)
+	return seg
+}
+
+// schedule 在 seg 到达接收端时投递它
+func (p *pipe) schedule(seg *segment, now time.Time) {
+	arrival := seg.done.Add(p.cfg.Latency)
+	if !arrival.After(now) {
+		p.deliver(seg.b, seg.eof)
+		return
+	}
+	seg.timer = gmp.AfterFunc(arrival.Sub(now), func() {
+		p.deliver(seg.b, seg.eof)
+	})
+}
+
+// truncate 在 seg 发送完之前中止它：只投递 now 之前按带宽发送出去的部分，返回它的长度
+func (p *pipe) truncate(seg *segment, now time.Time) int {
+	if seg.timer == nil || !seg.timer.Stop() {
+		return len(seg.b) // 已经投递
+	}
+	n := len(seg.b)
+	if p.cfg.Bandwidth > 0 && now.Before(seg.done) {
+		n = 0
+		if now.After(seg.start) {
+			n = int(int64(now.Sub(seg.start)) * p.cfg.Bandwidth / int64(time.Second))
+		}
+		old := seg.done
+		seg.b = seg.b[:n]
+		seg.done = seg.start.Add(time.Duration(int64(n) * int64(time.Second) / p.cfg.Bandwidth))
+		p.mu.Lock()
+		if p.busyUntil.Equal(old) {
+			// 后面没有别的发送，没发出去的部分不再占用带宽
+			p.busyUntil = seg.done
+		}
+		p.mu.Unlock()
+	}
+	p.schedule(seg, now)
+	return n
+}
+
+type conn struct {
+	local, remote Addr
+	rx, tx        *pipe
+	wpd           *gmp.PollDesc // Write 在这里等待数据按带宽发送完毕，写截止时间也设置在它上面
+
+	mu     sync.Mutex
+	closed bool
+	wd     time.Time
+}
+
+func newConnPair(cfg Config, caddr, saddr Addr) (client, server *conn) {
+	c2s := &pipe{cfg: cfg, pd: gmp.NewPollDesc()}
+	s2c := &pipe{cfg: cfg, pd: gmp.NewPollDesc()}
+	client = &conn{local: caddr, remote: saddr, rx: s2c, tx: c2s, wpd: gmp.NewPollDesc()}
+	server = &conn{local: saddr, remote: caddr, rx: c2s, tx: s2c, wpd: gmp.NewPollDesc()}
+	return client, server
+}
+
+func (c *conn) opError(op string, err error) error {
+	return &net.OpError{Op: op, Net: c.local.Net, Source: c.local, Addr: c.remote, Err: err}
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		closed := c.closed
+		c.mu.Unlock()
+		if closed {
+			return 0, c.opError("read", net.ErrClosed)
+		}
+
+		c.rx.mu.Lock()
+		if len(c.rx.buf) > 0 {
+			n := copy(b, c.rx.buf)
+			c.rx.buf = c.rx.buf[n:]
+			c.rx.mu.Unlock()
+			return n, nil
+		}
+		eof := c.rx.eof
+		c.rx.mu.Unlock()
+		if eof {
+			return 0, io.EOF
+		}
+
+		if err := c.rx.pd.WaitRead(); err != nil {
+			return 0, c.opError("read", err)
+		}
+	}
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	closed, wd := c.closed, c.wd
+	c.mu.Unlock()
+	if closed {
+		return 0, c.opError("write", net.ErrClosed)
+	}
+	if !wd.IsZero() && !wd.After(gmp.Now()) {
+		return 0, c.opError("write", os.ErrDeadlineExceeded)
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	seg := c.tx.send(append([]byte(nil), b...), false)
+
+	// 发送端要等数据按带宽发送完毕。和 Read 一样 park 在 PollDesc 上，
+	// 写截止时间先到或者连接被关闭时只发送了一部分
+	for {
+		d := seg.done.Sub(gmp.Now())
+		if d <= 0 {
+			return len(b), nil
+		}
+		t := gmp.AfterFunc(d, c.wpd.ReadyWrite)
+		err := c.wpd.WaitWrite()
+		t.Stop()
+		if err != nil {
+			if n := c.tx.truncate(seg, gmp.Now()); n < len(b) {
+				return n, c.opError("write", err)
+			}
+			return len(b), nil
+		}
+		// 就绪通知可能来自之前的一次 Write，回到循环开头重新检查
+	}
+}
+
+// Close 关闭连接：本端的读立即返回错误，对端在传输延迟后读到 EOF
+func (c *conn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return c.opError("close", net.ErrClosed)
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	c.rx.pd.Close()
+	c.wpd.Close()
+	c.tx.send(nil, true)
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr  { return c.local }
+func (c *conn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.rx.pd.SetReadDeadline(t)
+	return nil
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.wd = t
+	c.mu.Unlock()
+	c.wpd.SetWriteDeadline(t)
+	return nil
+}
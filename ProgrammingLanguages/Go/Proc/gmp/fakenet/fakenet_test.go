@@ -0,0 +1,272 @@
+package fakenet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"go-rem/gmp"
+	"go-rem/gmp/internal/schedtest"
+)
+
+// echo 把收到的数据原样写回，直到对端关闭
+func echo(c net.Conn) {
+	defer c.Close()
+	buf := make([]byte, 512)
+	for {
+		n, err := c.Read(buf)
+		if err != nil {
+			return
+		}
+		if _, err := c.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+}
+
+func serve(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		gmp.Go(func() { echo(c) })
+	}
+}
+
+func TestEchoLatency(t *testing.T) {
+	schedtest.Init(t, 2)
+	n := New(Config{Latency: 10 * time.Millisecond})
+
+	l, err := n.Listen("tcp", "127.0.0.1:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gmp.Go(func() { serve(l) })
+
+	var got string
+	var dialTime, rtt time.Duration
+	gmp.Go(func() {
+		defer l.Close()
+
+		start := gmp.Now()
+		c, err := n.Dial("tcp", "127.0.0.1:80")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer c.Close()
+		dialTime = gmp.Since(start)
+
+		start = gmp.Now()
+		c.Write([]byte("hello"))
+		buf := make([]byte, 16)
+		k, err := c.Read(buf)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		rtt = gmp.Since(start)
+		got = string(buf[:k])
+	})
+	gmp.Run()
+
+	if got != "hello" {
+		t.Errorf("期望收到 hello, 实际 %q", got)
+	}
+	if dialTime != 20*time.Millisecond {
+		t.Errorf("建立连接应该需要一个往返 20ms, 实际 %v", dialTime)
+	}
+	if rtt != 20*time.Millisecond {
+		t.Errorf("回显应该需要一个往返 20ms, 实际 %v", rtt)
+	}
+}
+
+func TestBandwidth(t *testing.T) {
+	schedtest.Init(t, 1)
+	n := New(Config{Bandwidth: 1000}) // 1000 字节/秒
+
+	l, _ := n.Listen("tcp", ":9000")
+	var received int
+	var elapsed time.Duration
+	gmp.Go(func() {
+		c, err := l.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		start := gmp.Now()
+		b, _ := io.ReadAll(c)
+		received = len(b)
+		elapsed = gmp.Since(start)
+		l.Close()
+	})
+	gmp.Go(func() {
+		c, err := n.Dial("tcp", ":9000")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		c.Write(make([]byte, 500))
+		c.Write(make([]byte, 500))
+		c.Close()
+	})
+	gmp.Run()
+
+	if received != 1000 {
+		t.Errorf("应该收到 1000 字节, 实际 %d", received)
+	}
+	if elapsed != time.Second {
+		t.Errorf("1000 字节在 1000B/s 下应该传输 1s, 实际 %v", elapsed)
+	}
+}
+
+func TestReadDeadline(t *testing.T) {
+	schedtest.Init(t, 1)
+	n := New(Config{})
+
+	l, _ := n.Listen("tcp", ":9001")
+	var err error
+	gmp.Go(func() {
+		c, _ := l.Accept()
+		defer c.Close()
+		defer l.Close()
+		c.SetReadDeadline(gmp.Now().Add(time.Second))
+		_, err = c.Read(make([]byte, 1))
+	})
+	gmp.Go(func() {
+		c, _ := n.Dial("tcp", ":9001")
+		gmp.Sleep(2 * time.Second)
+		c.Close()
+	})
+	gmp.Run()
+
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("读超时应该返回超时错误, 实际 %v", err)
+	}
+}
+
+func TestWriteDeadline(t *testing.T) {
+	schedtest.Init(t, 1)
+	n := New(Config{Bandwidth: 1000}) // 1000 字节/秒
+
+	l, _ := n.Listen("tcp", ":9002")
+	var received int
+	gmp.Go(func() {
+		c, _ := l.Accept()
+		defer l.Close()
+		b, _ := io.ReadAll(c)
+		received = len(b)
+	})
+	var written int
+	var err error
+	var elapsed time.Duration
+	gmp.Go(func() {
+		c, _ := n.Dial("tcp", ":9002")
+		defer c.Close()
+		// 1000 字节要发送 1s，截止时间在 300ms 时唤醒被 park 的 Write
+		start := gmp.Now()
+		c.SetWriteDeadline(start.Add(300 * time.Millisecond))
+		written, err = c.Write(make([]byte, 1000))
+		elapsed = gmp.Since(start)
+	})
+	gmp.Run()
+
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("写超时应该返回超时错误, 实际 %v", err)
+	}
+	if elapsed != 300*time.Millisecond || written != 300 {
+		t.Errorf("Write 应该在 300ms 时返回已发送的 300 字节, 实际 %v 后返回 %d", elapsed, written)
+	}
+	if received != written {
+		t.Errorf("对端应该只收到已发送的 %d 字节, 实际 %d", written, received)
+	}
+}
+
+func TestDialRefused(t *testing.T) {
+	schedtest.Init(t, 1)
+	n := New(Config{})
+
+	var err error
+	gmp.Go(func() {
+		_, err = n.Dial("tcp", "10.0.0.1:80")
+	})
+	gmp.Run()
+
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("没有监听者时应该返回 ECONNREFUSED, 实际 %v", err)
+	}
+}
+
+func TestAcceptAfterClose(t *testing.T) {
+	schedtest.Init(t, 1)
+	n := New(Config{})
+
+	l, _ := n.Listen("tcp", ":0")
+	var err error
+	gmp.Go(func() {
+		_, err = l.Accept()
+	})
+	gmp.Go(func() {
+		l.Close()
+	})
+	gmp.Run()
+
+	if !errors.Is(err, net.ErrClosed) {
+		t.Errorf("关闭监听后 Accept 应该返回 net.ErrClosed, 实际 %v", err)
+	}
+}
+
+// TestThousandConnections 在 4 个 P 上模拟 1000 个客户端连接同一个服务端
+func TestThousandConnections(t *testing.T) {
+	schedtest.Init(t, 4)
+	n := New(Config{Latency: 5 * time.Millisecond, Bandwidth: 1 << 20})
+
+	l, err := n.Listen("tcp", ":8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gmp.Go(func() { serve(l) })
+
+	const conns = 1000
+	ok := 0
+	done := 0
+	for i := 0; i < conns; i++ {
+		id := i
+		gmp.Go(func() {
+			defer func() {
+				done++
+				if done == conns {
+					l.Close()
+				}
+			}()
+			c, err := n.Dial("tcp", ":8080")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer c.Close()
+
+			msg := fmt.Sprintf("request-%d", id)
+			c.Write([]byte(msg))
+			buf := make([]byte, 64)
+			k, err := io.ReadAtLeast(c, buf, len(msg))
+			if err != nil || string(buf[:k]) != msg {
+				t.Errorf("连接 %d 回显错误: %q, %v", id, buf[:k], err)
+				return
+			}
+			ok++
+		})
+	}
+	gmp.Run()
+
+	if ok != conns {
+		t.Errorf("期望 %d 个连接成功, 实际 %d", conns, ok)
+	}
+}
@@ -0,0 +1,89 @@
+// Package gmptest 提供在 gmp 调度器上测试并发代码的工具
+//
+// 导入方式：
+//
+//	import "go-rem/gmp/gmptest"
+//
+// Explore 在所有（上界内的）调度下运行测试代码，找到失败的调度后把它写成录制文件，
+// 用 Replay 可以在同一个调度下重新运行，配合调试器或 trace 定位问题。
+package gmptest
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"go-rem/gmp"
+)
+
+// epoch 是虚拟时钟的起点，与 gmp.Explore 相同
+var epoch = time.Unix(0, 0)
+
+// Explore 把 body 作为一个 G，在不同的调度下反复运行，直到某个调度失败或探索完所有调度
+// 以下情况算作失败：body 中调用了 t.Error/t.Errorf、G panic、死锁。
+// 失败时把调度写入临时目录下的录制文件并报告它的路径。
+//
+// body 只能通过 gmp 和 gmp/sync 的原语与其他 G 同步，不能调用 t.Fatal（它会退出 G 所在的 goroutine），
+// 也不能使用 gmp.Syscall 和真实时间，见 gmp.Explore
+func Explore(t testing.TB, body func(), opts gmp.ExploreOptions) gmp.ExploreResult {
+	t.Helper()
+	failed := t.Failed()
+	res := gmp.Explore(opts, func() error {
+		gmp.Go(body)
+		err := gmp.RunE()
+		if err == nil && !failed && t.Failed() {
+			err = errors.New("test failed")
+		}
+		return err
+	})
+	if res.Err == nil {
+		t.Logf("gmptest: explored %d schedules (complete: %v)", res.Schedules, res.Complete)
+		return res
+	}
+
+	f, err := os.CreateTemp("", "gmp-explore-*.replay")
+	if err == nil {
+		_, err = f.Write(res.Replay)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		t.Errorf("gmptest: schedule %d failed: %v\n%s", res.Schedules, res.Err, res.Replay)
+		return res
+	}
+	t.Errorf("gmptest: schedule %d failed: %v\nreplay with gmptest.Replay(t, %q, body, opts)", res.Schedules, res.Err, f.Name())
+	return res
+}
+
+// Replay 在 Explore 报告的录制文件 path 描述的调度下运行一次 body，opts 应该与 Explore 时相同
+// G panic 或死锁时报告错误
+func Replay(t testing.TB, path string, body func(), opts gmp.ExploreOptions) {
+	t.Helper()
+	file, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	procs := opts.Procs
+	if procs == 0 {
+		procs = 2
+	}
+	if err := gmp.InitWithConfig(gmp.Config{Procs: procs, Clock: gmp.NewVirtualClock(epoch)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gmp.Replay(bytes.NewReader(file)); err != nil {
+		t.Fatal(err)
+	}
+	gmp.Go(body)
+
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("gmptest: panic: %v", r)
+		}
+	}()
+	if err := gmp.RunE(); err != nil {
+		t.Error(err)
+	}
+}
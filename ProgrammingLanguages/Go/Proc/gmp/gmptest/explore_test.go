@@ -0,0 +1,130 @@
+package gmptest
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go-rem/gmp"
+	gmpsync "go-rem/gmp/sync"
+)
+
+// recorder 记录失败而不让外层测试失败
+type recorder struct {
+	testing.TB
+	failed bool
+	msgs   []string
+}
+
+func (r *recorder) Helper()      {}
+func (r *recorder) Failed() bool { return r.failed }
+
+func (r *recorder) Error(args ...any) {
+	r.failed = true
+	r.msgs = append(r.msgs, fmt.Sprint(args...))
+}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.failed = true
+	r.msgs = append(r.msgs, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Logf(format string, args ...any) {
+	r.msgs = append(r.msgs, fmt.Sprintf(format, args...))
+}
+
+// withdraw 返回从余额为 1 的账户中取两次钱的测试
+// atomic 为 false 时检查余额和扣款不在同一个临界区中
+func withdraw(t testing.TB, atomic bool) func() {
+	return func() {
+		var mu gmpsync.Mutex
+		var wg gmpsync.WaitGroup
+		balance := 1
+		for i := 0; i < 2; i++ {
+			wg.Go(func() {
+				mu.Lock()
+				ok := balance > 0
+				if !atomic {
+					mu.Unlock()
+					gmp.Sleep(time.Millisecond)
+					mu.Lock()
+				} else {
+					gmp.Sleep(time.Millisecond)
+				}
+				if ok {
+					balance--
+				}
+				mu.Unlock()
+			})
+		}
+		wg.Wait()
+		if balance < 0 {
+			t.Errorf("balance = %d", balance)
+		}
+	}
+}
+
+func TestExplore(t *testing.T) {
+	r := &recorder{TB: t}
+	res := Explore(r, withdraw(r, true), gmp.ExploreOptions{})
+	if r.failed || res.Err != nil || !res.Complete {
+		t.Fatalf("正确的代码不应该失败: %+v %v", res, r.msgs)
+	}
+	if len(r.msgs) != 1 || !strings.Contains(r.msgs[0], "complete: true") {
+		t.Errorf("应该报告探索的调度数: %v", r.msgs)
+	}
+}
+
+func TestExploreReportsReplay(t *testing.T) {
+	r := &recorder{TB: t}
+	res := Explore(r, withdraw(r, false), gmp.ExploreOptions{})
+	if res.Err == nil {
+		t.Fatalf("应该找到余额为负的调度，运行了 %d 个调度", res.Schedules)
+	}
+	last := r.msgs[len(r.msgs)-1]
+	if r.msgs[0] != "balance = -1" || !strings.Contains(last, "test failed") {
+		t.Errorf("应该报告失败: %v", r.msgs)
+	}
+	_, rest, ok := strings.Cut(last, "gmptest.Replay(t, \"")
+	path, _, _ := strings.Cut(rest, "\"")
+	if !ok {
+		t.Fatalf("应该报告录制文件的路径: %s", last)
+	}
+	defer os.Remove(path)
+
+	// 在录制的调度下重现失败
+	r2 := &recorder{TB: t}
+	Replay(r2, path, withdraw(r2, false), gmp.ExploreOptions{})
+	if !r2.failed || r2.msgs[0] != "balance = -1" {
+		t.Errorf("回放应该重现失败: %v", r2.msgs)
+	}
+}
+
+func TestExploreDeadlock(t *testing.T) {
+	r := &recorder{TB: t}
+	res := Explore(r, func() {
+		var a, b gmpsync.Mutex
+		var wg gmpsync.WaitGroup
+		wg.Go(func() {
+			a.Lock()
+			gmp.Sleep(time.Millisecond)
+			b.Lock()
+			b.Unlock()
+			a.Unlock()
+		})
+		b.Lock()
+		gmp.Sleep(time.Millisecond)
+		a.Lock()
+		a.Unlock()
+		b.Unlock()
+		wg.Wait()
+	}, gmp.ExploreOptions{})
+	if res.Err == nil || !strings.Contains(res.Err.Error(), "deadlock") {
+		t.Fatalf("应该找到死锁: %v", res.Err)
+	}
+	if !r.failed {
+		t.Error("死锁应该报告为失败")
+	}
+}
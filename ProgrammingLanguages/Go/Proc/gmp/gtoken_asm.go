@@ -0,0 +1,8 @@
+//go:build amd64 || arm64
+
+package gmp
+
+// gtoken 返回调用者所在 goroutine 的标识：runtime 中当前 g 的地址，从 TLS（amd64）
+// 或 g 寄存器（arm64）读出，相当于 runtime 的 getg。
+// goroutine 结束后它的 g 会被复用，所以标识只在 goroutine 存活时唯一
+func gtoken() uintptr
@@ -0,0 +1,20 @@
+//go:build !amd64 && !arm64
+
+package gmp
+
+import "runtime"
+
+// gtoken 返回调用者所在 goroutine 的标识
+// 没有汇编实现的平台上从 runtime.Stack 的第一行 "goroutine N [...]" 读出 N，goroutine 的 id 从 1 开始
+func gtoken() uintptr {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	var id uintptr
+	for _, c := range b[len("goroutine "):] {
+		if c < '0' || c > '9' {
+			break
+		}
+		id = id*10 + uintptr(c-'0')
+	}
+	return id
+}
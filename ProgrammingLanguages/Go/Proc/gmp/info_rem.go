@@ -0,0 +1,218 @@
+package gmp
+
+import (
+	"sort"
+	"time"
+)
+
+// ============ 导出的调度器状态 ============
+//
+// types.go 中的结构都是未导出的，这里把它们转换成带 JSON 标签的导出结构，
+// 供 gmp 包之外的工具（例如 gmp/debughttp、可视化工具、golden 文件测试）使用。
+
+// SchedInfo 是调度器在某一时刻的完整状态
+type SchedInfo struct {
+	Time       time.Time `json:"time"` // 调度器时钟
+	Running    bool      `json:"running"`
+	Gomaxprocs int       `json:"gomaxprocs"`
+
+	Procs []PInfo `json:"procs"`
+	Ms    []MInfo `json:"ms"`
+	Gs    []GInfo `json:"gs"` // 所有还没有结束的 G，按 goid 排序
+
+	GlobalRunq []uint64 `json:"globalRunq"` // 全局队列中 G 的 goid，按出队顺序
+	Netpoll    []uint64 `json:"netpoll"`    // 已就绪、等待 findrunnable 取走的 G
+	IdleProcs  []int64  `json:"idleProcs"`  // 空闲 P 链表，按 pidleget 的顺序
+	IdleMs     []int64  `json:"idleMs"`     // 空闲 M 链表，按 mget 的顺序
+
+	NumSpinning int `json:"nmspinning"`
+	NumSyscall  int `json:"nsyscall"`
+	NumTimers   int `json:"ntimers"`
+}
+
+// PInfo 是一个 P 的状态
+type PInfo struct {
+	ID      int64    `json:"id"`
+	Status  string   `json:"status"`            // "idle"、"running"、"syscall"、"gcstop"
+	M       int64    `json:"m"`                 // 绑定的 M，-1 表示没有
+	Runnext uint64   `json:"runnext,omitempty"` // runnext 中 G 的 goid，0 表示没有
+	Runq    []uint64 `json:"runq"`              // 本地队列中 G 的 goid，按出队顺序
+
+	// 本地队列是环形缓冲区，Runq 对应下标 [RunqHead, RunqTail) 对 RunqCap 取模的槽位
+	RunqHead uint32 `json:"runqhead"`
+	RunqTail uint32 `json:"runqtail"`
+	RunqCap  int    `json:"runqcap"`
+
+	SchedTick   uint32 `json:"schedtick"`
+	SyscallTick uint32 `json:"syscalltick"`
+	Steals      uint64 `json:"steals"`
+	GlobalGets  uint64 `json:"globalGets"`
+	RunnextHits uint64 `json:"runnextHits"`
+}
+
+// MInfo 是一个 M 的状态
+type MInfo struct {
+	ID       int64  `json:"id"`
+	P        int64  `json:"p"`              // 持有的 P，-1 表示没有
+	Curg     uint64 `json:"curg,omitempty"` // 正在运行（或在系统调用中）的 G
+	Spinning bool   `json:"spinning"`
+	Idle     bool   `json:"idle"` // 在空闲 M 链表中
+}
+
+// GInfo 是一个 G 的状态
+type GInfo struct {
+	GoroutineInfo
+	M        int64  `json:"m"`                  // 运行它的 M，-1 表示没有
+	Location string `json:"location,omitempty"` // 可运行的 G 所在的队列，如 "P0 runnext"
+}
+
+// ReadProcs 返回每个 P 的状态和计数器
+// 只持有调度器锁读取，不会停止其他 M，适合频繁调用（例如每次 Prometheus 抓取）。
+// 与 Snapshot 一样，在 G 中调用时读取运行它的实例
+func ReadProcs() []PInfo {
+	var procs []PInfo
+	current().do(func() {
+		sched.lock.Lock()
+		defer sched.lock.Unlock()
+
+		procs = make([]PInfo, 0, len(sched.allp))
+		for _, pp := range sched.allp {
+			if pp.status == _Pdead {
+				continue
+			}
+			procs = append(procs, pinfo(pp))
+		}
+	})
+	return procs
+}
+
+// pinfo 调用者必须持有 sched.lock
+func pinfo(pp *p) PInfo {
+	pi := PInfo{
+		ID:          pp.id,
+		Status:      pstatusString(pp.status),
+		M:           -1,
+		Runq:        []uint64{},
+		RunqHead:    pp.runqhead,
+		RunqTail:    pp.runqtail,
+		RunqCap:     len(pp.runq),
+		SchedTick:   pp.schedtick,
+		SyscallTick: pp.syscalltick,
+		Steals:      pp.stats.steals,
+		GlobalGets:  pp.stats.globalgets,
+		RunnextHits: pp.stats.runnexthits,
+	}
+	if pp.m != nil {
+		pi.M = pp.m.id
+	}
+	if pp.runnext != nil {
+		pi.Runnext = pp.runnext.goid
+	}
+	for i := pp.runqhead; i != pp.runqtail; i++ {
+		pi.Runq = append(pi.Runq, pp.runq[i%uint32(len(pp.runq))].goid)
+	}
+	return pi
+}
+
+func pstatusString(status uint32) string {
+	switch status {
+	case _Pidle:
+		return "idle"
+	case _Prunning:
+		return "running"
+	case _Psyscall:
+		return "syscall"
+	case _Pgcstop:
+		return "gcstop"
+	case _Pdead:
+		return "dead"
+	}
+	return "???"
+}
+
+// Snapshot 短暂地停止整个世界，返回调度器状态的一致视图
+// 可以在 gmp 的 G 中或调度器之外的任意 goroutine 中调用，在 G 中调用时返回运行它的实例的状态
+func Snapshot() SchedInfo {
+	return current().Snapshot()
+}
+
+func snapshot() SchedInfo {
+	stopTheWorld("snapshot")
+	defer startTheWorld()
+
+	si := SchedInfo{
+		Running:     sched.running,
+		Gomaxprocs:  gomaxprocs(),
+		Procs:       []PInfo{},
+		Ms:          []MInfo{},
+		Gs:          []GInfo{},
+		GlobalRunq:  goids(sched.runq),
+		Netpoll:     goids(sched.netpollq),
+		IdleProcs:   []int64{},
+		IdleMs:      []int64{},
+		NumSpinning: int(sched.nmspinning),
+		NumSyscall:  int(sched.nsyscall),
+		NumTimers:   len(sched.timers),
+	}
+	if sched.clock != nil {
+		si.Time = nanotime()
+	}
+	for _, pp := range sched.allp {
+		if pp.status != _Pdead {
+			si.Procs = append(si.Procs, pinfo(pp))
+		}
+	}
+	idle := make(map[*m]bool)
+	for mp := sched.midle; mp != nil; mp = mp.link {
+		si.IdleMs = append(si.IdleMs, mp.id)
+		idle[mp] = true
+	}
+	for pp := sched.pidle; pp != nil; pp = pp.link {
+		si.IdleProcs = append(si.IdleProcs, pp.id)
+	}
+	for _, mp := range sched.allm {
+		mi := MInfo{ID: mp.id, P: -1, Spinning: mp.spinning, Idle: idle[mp]}
+		if mp.p != nil {
+			mi.P = mp.p.id
+		}
+		if isuserg(mp.curg) {
+			mi.Curg = mp.curg.goid
+		}
+		si.Ms = append(si.Ms, mi)
+	}
+
+	loc := glocations()
+	for _, gp := range sched.allgs {
+		gi := GInfo{GoroutineInfo: ginfo(gp), M: -1, Location: loc[gp]}
+		if gp.m != nil {
+			gi.M = gp.m.id
+		}
+		si.Gs = append(si.Gs, gi)
+	}
+	sort.Slice(si.Gs, func(i, j int) bool { return si.Gs[i].Goid < si.Gs[j].Goid })
+	return si
+}
+
+// stopTheWorld 停止所有 M（对应 runtime 的 stopTheWorld）
+// M 只在持有 sched.lock 时做调度决定，拿到锁时其他 M 都停在调度点上，
+// 正在运行的 G 下一次进入调度器时也会停下；系统调用中的 G 要拿到同一把锁才能返回。
+// 因此持有锁就是停止了整个世界，startTheWorld 释放它
+func stopTheWorld(reason string) {
+	sched.lock.Lock()
+	traceSTWStart(reason)
+}
+
+// startTheWorld 恢复 stopTheWorld 停止的 M
+func startTheWorld() {
+	traceSTWDone()
+	sched.lock.Unlock()
+}
+
+// goids 返回 gs 的 goid，调用者必须持有 sched.lock
+func goids(gs []*g) []uint64 {
+	ids := make([]uint64, 0, len(gs))
+	for _, gp := range gs {
+		ids = append(ids, gp.goid)
+	}
+	return ids
+}
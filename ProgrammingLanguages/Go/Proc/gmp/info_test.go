@@ -0,0 +1,136 @@
+package gmp
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadProcs(t *testing.T) {
+	ownengine(t)
+	initVirtual(t, 3)
+	procresize(2) // P2 被废弃，不应该出现在结果中
+
+	var ids []uint64
+	for i := 0; i < 3; i++ {
+		gp := newproc1(func() {}, nil, 0)
+		ids = append(ids, gp.goid)
+	}
+
+	procs := ReadProcs()
+	if len(procs) != 2 {
+		t.Fatalf("应该有 2 个 P，实际为 %d", len(procs))
+	}
+	p0 := procs[0]
+	if p0.ID != 0 || p0.Status != "running" || p0.M != 0 {
+		t.Errorf("P0 的状态错误: %+v", p0)
+	}
+	// 最后创建的 G 在 runnext 中，之前被挤出的按顺序在队列中
+	if p0.Runnext != ids[2] || len(p0.Runq) != 2 || p0.Runq[0] != ids[0] || p0.Runq[1] != ids[1] {
+		t.Errorf("P0 的队列错误: runnext=%d runq=%v，创建顺序 %v", p0.Runnext, p0.Runq, ids)
+	}
+	if p0.RunqTail-p0.RunqHead != 2 || p0.RunqCap != 256 {
+		t.Errorf("P0 的环形缓冲区错误: head=%d tail=%d cap=%d", p0.RunqHead, p0.RunqTail, p0.RunqCap)
+	}
+	if p1 := procs[1]; p1.Status != "idle" || p1.M != -1 || p1.Runq == nil {
+		t.Errorf("P1 的状态错误: %+v", p1)
+	}
+
+	Run()
+	var ticks uint32
+	for _, pi := range ReadProcs() {
+		ticks += pi.SchedTick
+	}
+	if ticks != 3 {
+		t.Errorf("所有 P 的 schedtick 之和应该为 3，实际为 %d", ticks)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	initVirtual(t, 2)
+
+	var si SchedInfo
+	var sema uint32
+	var parked, runner uint64
+	Go(func() {
+		parked = getg().goid
+		Semacquire(&sema)
+	})
+	Go(func() {
+		runner = getg().goid
+		Sleep(time.Millisecond) // 让另一个 G 先运行并 park
+		Go(func() {})           // 留在 runnext 中
+		si = Snapshot()
+		Semrelease(&sema, false)
+	})
+	Run()
+
+	if !si.Running || si.Gomaxprocs != 2 || !si.Time.Equal(epoch.Add(time.Millisecond)) {
+		t.Errorf("快照头部错误: running=%v gomaxprocs=%d time=%v", si.Running, si.Gomaxprocs, si.Time)
+	}
+	if len(si.Gs) != 3 {
+		t.Fatalf("应该有 3 个 G，实际为 %d: %+v", len(si.Gs), si.Gs)
+	}
+	byID := make(map[uint64]GInfo)
+	for i, gi := range si.Gs {
+		byID[gi.Goid] = gi
+		if i > 0 && si.Gs[i-1].Goid >= gi.Goid {
+			t.Error("G 应该按 goid 排序")
+		}
+	}
+	if gi := byID[parked]; gi.Status != "waiting" || gi.WaitReason != "semacquire" || gi.WaitTime != time.Millisecond || gi.M != -1 {
+		t.Errorf("park 的 G 状态错误: %+v", gi)
+	}
+	me := byID[runner]
+	if me.Status != "running" || me.M < 0 {
+		t.Errorf("正在运行的 G 状态错误: %+v", me)
+	}
+
+	var mine PInfo
+	for _, pi := range si.Procs {
+		if pi.M == me.M {
+			mine = pi
+		}
+	}
+	if mine.Status != "running" || mine.Runnext == 0 || byID[mine.Runnext].Location != "P"+strconv.FormatInt(mine.ID, 10)+" runnext" {
+		t.Errorf("当前 P 的状态错误: %+v", mine)
+	}
+	var found bool
+	for _, mi := range si.Ms {
+		if mi.ID == me.M {
+			found = true
+			if mi.Curg != runner || mi.P != mine.ID || mi.Idle {
+				t.Errorf("当前 M 的状态错误: %+v", mi)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("快照中缺少 M%d", me.M)
+	}
+	if si.GlobalRunq == nil || si.IdleProcs == nil || si.IdleMs == nil {
+		t.Error("空列表应该序列化为 []，而不是 null")
+	}
+
+	b, err := json.Marshal(si)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"gomaxprocs":2`, `"waitReason":"semacquire"`, `"location":"P`, `"globalRunq":[]`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("JSON 中应该包含 %s:\n%s", want, b)
+		}
+	}
+}
+
+func TestSnapshotOutsideScheduler(t *testing.T) {
+	initVirtual(t, 1)
+	Go(func() {})
+
+	si := Snapshot()
+	if si.Running || len(si.Gs) != 1 || si.Gs[0].Location != "P0 runnext" || si.Procs[0].Runnext != si.Gs[0].Goid {
+		t.Errorf("快照错误: %+v", si)
+	}
+	Run()
+}
@@ -0,0 +1,292 @@
+package gmp
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ============ 调度器实例 ============
+//
+// 调度代码通过包级变量 sched、g0、m0、initialized 访问当前的调度器。
+// 每个 Scheduler 保存一份这样的状态，在它上面执行之前先用 switchto 把它装入包级变量，
+// 就像操作系统在同一个 CPU 上切换进程的上下文。
+// enginemu 保证同一时刻只有一个实例装入，没有人持有它时装入的总是默认实例。
+// 调度循环在空闲等待时释放 enginemu，有其他 goroutine 在等待时也在每一步之间释放，
+// 所以多个实例可以在不同的 goroutine 中同时 Run，它们的调度步骤交替执行。
+// G 的代码总是在调度循环持有 enginemu 时运行，
+// 所以 G 中调用的 Go、Sleep、Semacquire 等函数看到的就是运行它的调度器。
+
+var (
+	enginemu   sync.Mutex
+	cursched   = defaultSched            // 装入包级变量的实例，只在持有 enginemu 时修改
+	executing  atomic.Pointer[Scheduler] // 正在执行调度的实例，它的 G 可能正在运行
+	owner      atomic.Uintptr            // 正在执行 executing 的 goroutine 的 gtoken，见 extern_rem.go
+	enginewait atomic.Int32              // 正在等待 enginemu 的 goroutine 数量
+
+	defaultSched = &Scheduler{}
+)
+
+// Scheduler 是一个独立的调度器实例，有自己的 G、M、P、队列和时钟
+// 包级的 Init、Go、Run 等函数使用默认实例。
+// 在一个实例的 G 中不能使用另一个实例；在调度器之外的 goroutine 中调用的包级函数总是使用默认实例
+type Scheduler struct {
+	sched       Schedt
+	g0          *g
+	m0          *m
+	initialized bool
+	closed      bool
+
+	done  chan struct{} // Start 启动的调度循环结束时关闭
+	bgerr error         // Start 启动的调度循环的结果，done 关闭之后才能读取
+
+	// 调度器之外提交的 G，见 extern_rem.go
+	extmu      sync.Mutex
+	extq       []extg
+	extopen    bool          // Start 之后、Shutdown 之前，外部提交进入 extq
+	extshut    bool          // Shutdown 之后、下一次 Start 之前，外部提交被拒绝
+	extwake    chan struct{} // s.sched.wakeup 的副本，不持有 enginemu 也可以读取
+	extpending atomic.Bool   // extq 不为空
+}
+
+// New 按 cfg 创建一个新的调度器实例
+// cfg.DumpOnSIGQUIT 只对默认实例有效
+func New(cfg Config) (*Scheduler, error) {
+	if _, err := cfg.resolve(); err != nil {
+		return nil, err
+	}
+	s := &Scheduler{}
+	s.do(func() {
+		sched.cfg = cfg
+		schedinit()
+		initialized = true
+	})
+	return s, nil
+}
+
+// Go 在 s 上创建一个新的 Goroutine 来执行 fn
+// 出错时以 TryGo 会返回的 *SchedError panic，但不会因为本地队列已满而失败
+func (s *Scheduler) Go(fn func()) {
+	if err := s.gonew(s.owned(), []func(){fn}, callerpc(), false, false); err != nil {
+		panic(err)
+	}
+}
+
+// TryGo 与 Go 相同，但出错时返回 *SchedError 而不是 panic：
+// 没有初始化时原因是 ErrNotInitialized，Close 或 Shutdown 之后是 ErrShutdown，
+// 当前 P 的本地队列已满时是 ErrQueueFull（Go 会把一半的 G 移到全局队列）
+func (s *Scheduler) TryGo(fn func()) error {
+	return s.gonew(s.owned(), []func(){fn}, callerpc(), true, false)
+}
+
+// GoBatch 在 s 上为 fns 中的每个函数创建一个 Goroutine
+// 与逐个调用 Go 不同，这批 G 像 injectglist 一样一次放入队列：先填满当前 P 的本地队列，
+// 放不下的放入全局队列，再为这批 G 启动空闲的 P（最多 len(fns) 个）。出错时与 Go 一样 panic
+func (s *Scheduler) GoBatch(fns []func()) {
+	if err := s.gonew(s.owned(), fns, callerpc(), false, true); err != nil {
+		panic(err)
+	}
+}
+
+// gonew 为 fns 创建 G。Go 和 TryGo 与 newproc 一样使用 runnext，
+// batch 为 true 时（GoBatch）即使只有一个函数也像 injectglist 一样放入队列。
+// inside 是 s.owned() 的结果，由调用者传入，避免再比较一次 owner。
+// try 为 true 时本地队列已满返回 ErrQueueFull
+func (s *Scheduler) gonew(inside bool, fns []func(), pc uintptr, try, batch bool) error {
+	if !inside {
+		if ok, err := s.inject(fns, pc); ok {
+			return err
+		}
+	}
+	var err error
+	f := func() {
+		if err = s.check("Go"); err != nil {
+			return
+		}
+		sched.lock.Lock()
+		defer sched.lock.Unlock()
+		if !inside && sched.shutdown {
+			err = &SchedError{Op: "Go", Err: ErrShutdown}
+			return
+		}
+		if !inside && sched.running {
+			// 调度循环正在另一个 goroutine 上运行，调用者不在任何 M 上
+			q := make([]extg, len(fns))
+			for i, fn := range fns {
+				q[i] = extg{fn, pc}
+			}
+			newprocext(q)
+			notewakeup()
+			return
+		}
+		if try && runqfull(getg()) {
+			err = &SchedError{Op: "Go", Err: ErrQueueFull}
+			return
+		}
+		if batch {
+			newprocbatch(fns, getg(), pc)
+		} else {
+			newproc1(fns[0], getg(), pc)
+		}
+	}
+	if inside {
+		f()
+	} else {
+		runengine(s, f)
+	}
+	return err
+}
+
+// check 检查 s 是否可以使用，调用者必须已经装入 s
+func (s *Scheduler) check(op string) error {
+	if s.closed {
+		return &SchedError{Op: op, Err: ErrShutdown}
+	}
+	if !initialized {
+		return &SchedError{Op: op, Err: ErrNotInitialized}
+	}
+	return nil
+}
+
+// Run 运行 s 上的所有 Goroutine 直到它们执行完毕，与包级的 Run 相同
+func (s *Scheduler) Run() {
+	if err := s.RunE(); err != nil {
+		runfatal(err)
+	}
+}
+
+// RunE 与 Run 相同，但返回错误而不是退出进程或 panic，与包级的 RunE 相同
+func (s *Scheduler) RunE() error {
+	var err error
+	s.do(func() {
+		if err = s.check("Run"); err != nil {
+			return
+		}
+		if sched.background {
+			err = errors.New("gmp: Run called while the scheduler is started")
+			return
+		}
+		err = rune()
+	})
+	return err
+}
+
+// Snapshot 返回 s 的调度器状态的一致视图
+func (s *Scheduler) Snapshot() SchedInfo {
+	var si SchedInfo
+	s.do(func() { si = snapshot() })
+	return si
+}
+
+// Close 释放 s 的全部状态，之后不能再使用 s
+// 阻塞的 G 不会再被唤醒。调度器正在运行时返回错误
+func (s *Scheduler) Close() error {
+	var err error
+	s.do(func() {
+		if sched.running {
+			err = errors.New("gmp: Scheduler.Close called while the scheduler is running")
+			return
+		}
+		s.closed = true
+		gostopall()
+		*sched = Schedt{}
+		g0, m0, initialized = nil, nil, false
+	})
+	return err
+}
+
+// do 在 s 上执行 f
+// 在 s 的 G 中（或者在已经装入 s 的 goroutine 中）调用时直接执行；否则先装入 s
+func (s *Scheduler) do(f func()) {
+	if s.owned() {
+		f()
+		return
+	}
+	runengine(s, f)
+}
+
+// runengine 装入 s 执行 f，之后装回默认实例
+func runengine(s *Scheduler, f func()) {
+	acquireengine(s)
+	defer releaseengine()
+	f()
+}
+
+// owned 报告调用者是否就是正在执行 s 的 goroutine
+// 只比较 executing 不够：s 的 G 运行时，其他 goroutine 看到的 executing 也是 s
+func (s *Scheduler) owned() bool {
+	return executing.Load() == s && owner.Load() == gtoken()
+}
+
+// Current 返回当前的调度器实例：在 G 中是运行这个 G 的实例，否则是默认实例
+// 调度器之外的回调（例如 context.AfterFunc）可以用它把工作交回创建回调时所在的实例
+func Current() *Scheduler {
+	return current()
+}
+
+// current 返回当前的调度器：在 G 中是运行这个 G 的实例，否则是默认实例
+func current() *Scheduler {
+	s, _ := curowned()
+	return s
+}
+
+// curowned 与 current 相同，另外报告调用者是否正在执行返回的实例（s.owned()）
+func curowned() (*Scheduler, bool) {
+	// owner 是调用者自己时，executing 只有调用者能修改，先读哪个都一样
+	if s := executing.Load(); s != nil && owner.Load() == gtoken() {
+		return s, true
+	}
+	return defaultSched, false
+}
+
+// acquireengine 获取 enginemu 并装入 s
+func acquireengine(s *Scheduler) {
+	enginewait.Add(1)
+	enginemu.Lock()
+	enginewait.Add(-1)
+	switchto(s)
+	executing.Store(s)
+	owner.Store(gtoken())
+}
+
+// releaseengine 装回默认实例并释放 enginemu
+func releaseengine() {
+	owner.Store(0)
+	executing.Store(nil)
+	switchto(defaultSched)
+	enginemu.Unlock()
+}
+
+// unlockengine 释放 sched.lock 和 enginemu，返回当前实例，之后用 lockengine 重新获取
+// 调度器在等待（空闲、两步之间）时调用，使其他实例和从系统调用返回的 M 可以执行
+func unlockengine() *Scheduler {
+	s := cursched
+	sched.lock.Unlock()
+	releaseengine()
+	return s
+}
+
+// yieldengine 在有其他 goroutine 等待 enginemu 时释放并重新获取它，调用者必须持有 sched.lock
+// 没有人等待时什么都不做，调度循环不必在每一步之间都切换一次实例
+func yieldengine() {
+	if enginewait.Load() > 0 {
+		lockengine(unlockengine())
+	}
+}
+
+// lockengine 重新装入 s 并获取它的 sched.lock
+func lockengine(s *Scheduler) {
+	acquireengine(s)
+	sched.lock.Lock()
+}
+
+// switchto 把当前实例的状态存回它自己，再把 s 装入包级变量，调用者必须持有 enginemu
+func switchto(s *Scheduler) {
+	if cursched == s {
+		return
+	}
+	cursched.g0, cursched.m0, cursched.initialized = g0, m0, initialized
+	sched, g0, m0, initialized = &s.sched, s.g0, s.m0, s.initialized
+	cursched = s
+	raceenabled.Store(sched.cfg.Race)
+}
@@ -0,0 +1,235 @@
+package gmp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newVirtual(t *testing.T, procs int) *Scheduler {
+	t.Helper()
+	s, err := New(Config{Procs: procs, Clock: NewVirtualClock(epoch)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// ownengine 让测试的 goroutine 装入默认实例并成为 owner，直到测试结束
+// 在调度器之外直接调用内部函数（procresize、runqput、getg 等）的测试需要它，就像 runtime 的主线程就是 m0
+func ownengine(t *testing.T) {
+	t.Helper()
+	acquireengine(defaultSched)
+	t.Cleanup(releaseengine)
+}
+
+func TestSchedulerIsolated(t *testing.T) {
+	initVirtual(t, 2)
+	s1 := newVirtual(t, 1)
+	s2 := newVirtual(t, 4)
+
+	var n1, n2, n0 int
+	s1.Go(func() {
+		// G 中的包级 Go 和 Sleep 使用运行这个 G 的实例
+		Go(func() { n1++ })
+		Sleep(time.Hour)
+		n1++
+	})
+	s2.Go(func() { n2++ })
+	Go(func() { n0++ })
+
+	if si := s1.Snapshot(); si.Gomaxprocs != 1 || len(si.Gs) != 1 {
+		t.Errorf("s1 应该有 1 个 P 和 1 个 G: %+v", si)
+	}
+	if si := s2.Snapshot(); si.Gomaxprocs != 4 || len(si.Gs) != 1 {
+		t.Errorf("s2 应该有 4 个 P 和 1 个 G: %+v", si)
+	}
+	if si := Snapshot(); si.Gomaxprocs != 2 || len(si.Gs) != 1 {
+		t.Errorf("默认实例应该有 2 个 P 和 1 个 G: %+v", si)
+	}
+
+	if err := s1.RunE(); err != nil {
+		t.Fatal(err)
+	}
+	if n1 != 2 || n2 != 0 || n0 != 0 {
+		t.Fatalf("s1 只应该运行自己的 G: n1=%d n2=%d n0=%d", n1, n2, n0)
+	}
+	if d := s1.Snapshot().Time.Sub(epoch); d != time.Hour {
+		t.Errorf("s1 的时钟应该前进 1h，实际为 %v", d)
+	}
+	if !s2.Snapshot().Time.Equal(epoch) {
+		t.Error("s2 的时钟不应该前进")
+	}
+
+	s2.Run()
+	Run()
+	if n2 != 1 || n0 != 1 {
+		t.Errorf("n2=%d n0=%d", n2, n0)
+	}
+}
+
+func TestSchedulerParallel(t *testing.T) {
+	// 两个实例在不同的 goroutine 中同时运行：a 的系统调用等待 b 中的 G
+	a := newVirtual(t, 2)
+	b := newVirtual(t, 2)
+	ready := make(chan struct{})
+
+	var sumA, sumB int
+	a.Go(func() {
+		Syscall(func() { <-ready })
+		sumA += 100
+	})
+	for i := 0; i < 10; i++ {
+		a.Go(func() { sumA++ })
+		b.Go(func() {
+			sched.lock.Lock()
+			goyield()
+			sumB++
+			if sumB == 10 {
+				close(ready)
+			}
+		})
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, s := range []*Scheduler{a, b} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.RunE()
+		}()
+	}
+	wg.Wait()
+
+	if errs[0] != nil || errs[1] != nil {
+		t.Fatal(errs)
+	}
+	if sumA != 110 || sumB != 10 {
+		t.Errorf("sumA=%d sumB=%d", sumA, sumB)
+	}
+}
+
+func TestSchedulerClose(t *testing.T) {
+	s := newVirtual(t, 1)
+	var err error
+	s.Go(func() { err = s.Close() })
+	s.Run()
+	if err == nil {
+		t.Error("运行中 Close 应该返回错误")
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Close 之后 Go 应该 panic")
+		}
+	}()
+	s.Go(func() {})
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	if _, err := New(Config{Procs: -1}); err == nil {
+		t.Error("非法的配置应该返回错误")
+	}
+}
+
+func TestReadersWhileOtherRuns(t *testing.T) {
+	// 另一个实例在运行时，调度器之外调用的包级读取函数读取默认实例，不与它竞争
+	initVirtual(t, 2)
+	Go(func() {})
+	s := newVirtual(t, 4)
+	for i := 0; i < 100; i++ {
+		s.Go(func() {
+			for j := 0; j < 10; j++ {
+				Sleep(time.Millisecond)
+			}
+		})
+	}
+
+	done := make(chan error)
+	go func() { done <- s.RunE() }()
+	for running := true; running; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			running = false
+		default:
+		}
+		samples := []Sample{{Name: "/sched/gomaxprocs:threads"}}
+		ReadMetrics(samples)
+		if n := samples[0].Value.Uint64(); n != 2 {
+			t.Fatalf("ReadMetrics 应该读取默认实例的 2 个 P，实际为 %d", n)
+		}
+		if n := len(ReadProcs()); n != 2 {
+			t.Fatalf("ReadProcs 应该返回默认实例的 2 个 P，实际为 %d", n)
+		}
+		if n := GetGCount(); n != 1 {
+			t.Fatalf("GetGCount 应该是默认实例的 1，实际为 %d", n)
+		}
+		if n := len(Leaks()); n != 1 {
+			t.Fatalf("Leaks 应该返回默认实例的 1 个 G，实际为 %d", n)
+		}
+		Stack(true)
+	}
+	Run()
+}
+
+func TestSemaPerInstance(t *testing.T) {
+	// 两个实例在同一个地址上的信号量互不影响
+	var sema uint32
+	a := newVirtual(t, 1)
+	b := newVirtual(t, 1)
+
+	a.Go(func() { Semacquire(&sema) })
+	var de *DeadlockError
+	if err := a.RunE(); !errors.As(err, &de) {
+		t.Fatalf("a 中的 G 应该一直等待信号量: %v", err)
+	}
+
+	b.Go(func() { Semrelease(&sema, false) })
+	if err := b.RunE(); err != nil {
+		t.Fatal(err)
+	}
+	if si := b.Snapshot(); len(si.Gs) != 0 {
+		t.Errorf("b 的 Semrelease 不应该唤醒 a 中的 G: %+v", si.Gs)
+	}
+	if sema != 1 {
+		t.Errorf("sema = %d，应该是 1", sema)
+	}
+}
+
+func TestPollDescFromOutside(t *testing.T) {
+	// 在调度器之外通知就绪：交给创建 PollDesc 的实例，而不是默认实例
+	initVirtual(t, 1)
+	s := newVirtual(t, 2)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	created := make(chan *PollDesc)
+	var err error
+	s.Go(func() {
+		pd := NewPollDesc()
+		created <- pd
+		err = pd.WaitRead()
+	})
+	pd := <-created
+	pd.ReadyRead()
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err != nil {
+		t.Errorf("WaitRead 应该返回 nil，实际为 %v", err)
+	}
+	if si := Snapshot(); len(si.Gs) != 0 {
+		t.Errorf("默认实例不应该有 G: %+v", si.Gs)
+	}
+}
@@ -0,0 +1,29 @@
+// Package schedtest 是 gmp 各个子包的测试共用的调度器夹具
+package schedtest
+
+import (
+	"testing"
+	"time"
+
+	"go-rem/gmp"
+)
+
+// Epoch 是测试中虚拟时钟的起点
+var Epoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Init 用 procs 个 P 和从 Epoch 开始的虚拟时钟重新初始化默认调度器
+func Init(t testing.TB, procs int) {
+	t.Helper()
+	InitConfig(t, gmp.Config{Procs: procs})
+}
+
+// InitConfig 按 cfg 重新初始化默认调度器，cfg.Clock 为 nil 时使用从 Epoch 开始的虚拟时钟
+func InitConfig(t testing.TB, cfg gmp.Config) {
+	t.Helper()
+	if cfg.Clock == nil {
+		cfg.Clock = gmp.NewVirtualClock(Epoch)
+	}
+	if err := gmp.InitWithConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,200 @@
+package gmp
+
+import (
+	"math"
+	"time"
+)
+
+// ============ 指标 ============
+//
+// 仿照 runtime/metrics：每个指标有一个固定的名字，格式为 "/路径:单位"。
+// 计数器保存在每个 P 上（与 runtime 的 p 中的统计一样，更新时不需要额外的同步），
+// ReadMetrics 读取时把所有 P 的值加起来。
+
+// ValueKind 是指标值的类型
+type ValueKind int
+
+const (
+	KindBad ValueKind = iota // 不支持的指标
+	KindUint64
+	KindFloat64
+	KindFloat64Histogram
+)
+
+// Float64Histogram 是一个直方图
+// Counts[i] 是落在 [Buckets[i], Buckets[i+1]) 中的样本数，因此 len(Buckets) == len(Counts)+1。
+// Buckets 在多次读取之间共享，不能修改
+type Float64Histogram struct {
+	Counts  []uint64
+	Buckets []float64
+}
+
+// MetricValue 是一个指标的值
+type MetricValue struct {
+	kind   ValueKind
+	scalar uint64
+	hist   *Float64Histogram
+}
+
+// Kind 返回值的类型
+func (v MetricValue) Kind() ValueKind { return v.kind }
+
+// Uint64 返回 KindUint64 类型的值，其他类型会 panic
+func (v MetricValue) Uint64() uint64 {
+	if v.kind != KindUint64 {
+		panic("gmp: called Uint64 on non-uint64 metric value")
+	}
+	return v.scalar
+}
+
+// Float64 返回 KindFloat64 类型的值，其他类型会 panic
+func (v MetricValue) Float64() float64 {
+	if v.kind != KindFloat64 {
+		panic("gmp: called Float64 on non-float64 metric value")
+	}
+	return math.Float64frombits(v.scalar)
+}
+
+// Float64Histogram 返回 KindFloat64Histogram 类型的值，其他类型会 panic
+func (v MetricValue) Float64Histogram() *Float64Histogram {
+	if v.kind != KindFloat64Histogram {
+		panic("gmp: called Float64Histogram on non-histogram metric value")
+	}
+	return v.hist
+}
+
+// Sample 是 ReadMetrics 的参数：调用者填写 Name，ReadMetrics 填写 Value
+type Sample struct {
+	Name  string
+	Value MetricValue
+}
+
+// MetricDescription 描述一个指标
+type MetricDescription struct {
+	Name        string
+	Description string
+	Kind        ValueKind
+	// Cumulative 为 true 表示指标只增不减（计数器），否则是瞬时值
+	Cumulative bool
+}
+
+var metricDescriptions = []MetricDescription{
+	{
+		Name:        "/sched/goroutines:goroutines",
+		Description: "还没有结束的 G 的数量，包括正在运行的 G",
+		Kind:        KindUint64,
+	},
+	{
+		Name:        "/sched/gomaxprocs:threads",
+		Description: "P 的数量",
+		Kind:        KindUint64,
+	},
+	{
+		Name:        "/sched/steals:events",
+		Description: "成功从其他 P 窃取 G 的次数",
+		Kind:        KindUint64,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/global-queue-gets:events",
+		Description: "从全局队列获取 G 的次数",
+		Kind:        KindUint64,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/runnext-hits:events",
+		Description: "从 runnext 获取 G 的次数",
+		Kind:        KindUint64,
+		Cumulative:  true,
+	},
+	{
+		Name:        "/sched/latencies:seconds",
+		Description: "G 从可运行（_Grunnable）到开始运行（_Grunning）经过的时间",
+		Kind:        KindFloat64Histogram,
+		Cumulative:  true,
+	},
+}
+
+// AllMetrics 返回所有支持的指标
+func AllMetrics() []MetricDescription {
+	return append([]MetricDescription(nil), metricDescriptions...)
+}
+
+// 调度延迟直方图的桶：[0, 1µs), [1µs, 2µs), ... 按 2 倍增长，最后一个桶没有上界
+const latencyBuckets = 26
+
+var latencyBounds = func() []float64 {
+	b := make([]float64, latencyBuckets+1)
+	b[0] = 0
+	for i := 1; i < latencyBuckets; i++ {
+		b[i] = float64(time.Microsecond<<(i-1)) / float64(time.Second)
+	}
+	b[latencyBuckets] = math.Inf(1)
+	return b
+}()
+
+// pstats 是每个 P 的统计，由 sched.lock 保护
+type pstats struct {
+	steals      uint64
+	globalgets  uint64
+	runnexthits uint64
+	latency     [latencyBuckets]uint64
+}
+
+// recordLatency 记录 gp 从可运行到开始运行的延迟，调用者必须持有 sched.lock
+func recordLatency(pp *p, gp *g) {
+	if gp.runnableat.IsZero() {
+		return
+	}
+	d := nanotime().Sub(gp.runnableat)
+	gp.runnableat = time.Time{}
+	i := 0
+	for i < latencyBuckets-1 && d >= time.Microsecond<<i {
+		i++
+	}
+	pp.stats.latency[i]++
+}
+
+// ReadMetrics 读取 samples 中每个指标的当前值
+// 不支持的指标的 Value.Kind() 为 KindBad。在 G 中调用时读取运行它的实例
+func ReadMetrics(samples []Sample) {
+	current().do(func() { readmetrics(samples) })
+}
+
+func readmetrics(samples []Sample) {
+	sched.lock.Lock()
+	defer sched.lock.Unlock()
+
+	var total pstats
+	for _, pp := range sched.allp {
+		total.steals += pp.stats.steals
+		total.globalgets += pp.stats.globalgets
+		total.runnexthits += pp.stats.runnexthits
+		for i, n := range pp.stats.latency {
+			total.latency[i] += n
+		}
+	}
+
+	for i := range samples {
+		s := &samples[i]
+		switch s.Name {
+		case "/sched/goroutines:goroutines":
+			s.Value = MetricValue{kind: KindUint64, scalar: uint64(len(sched.allgs))}
+		case "/sched/gomaxprocs:threads":
+			s.Value = MetricValue{kind: KindUint64, scalar: uint64(gomaxprocs())}
+		case "/sched/steals:events":
+			s.Value = MetricValue{kind: KindUint64, scalar: total.steals}
+		case "/sched/global-queue-gets:events":
+			s.Value = MetricValue{kind: KindUint64, scalar: total.globalgets}
+		case "/sched/runnext-hits:events":
+			s.Value = MetricValue{kind: KindUint64, scalar: total.runnexthits}
+		case "/sched/latencies:seconds":
+			s.Value = MetricValue{kind: KindFloat64Histogram, hist: &Float64Histogram{
+				Counts:  append([]uint64(nil), total.latency[:]...),
+				Buckets: latencyBounds,
+			}}
+		default:
+			s.Value = MetricValue{}
+		}
+	}
+}
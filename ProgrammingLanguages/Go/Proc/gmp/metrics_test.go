@@ -0,0 +1,90 @@
+package gmp
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func readMetrics(names ...string) map[string]MetricValue {
+	samples := make([]Sample, len(names))
+	for i, name := range names {
+		samples[i].Name = name
+	}
+	ReadMetrics(samples)
+	m := make(map[string]MetricValue)
+	for _, s := range samples {
+		m[s.Name] = s.Value
+	}
+	return m
+}
+
+func TestReadMetrics(t *testing.T) {
+	initVirtual(t, 2)
+
+	for i := 0; i < 20; i++ {
+		Go(func() { Sleep(time.Millisecond) })
+	}
+	var running uint64
+	Go(func() {
+		running = readMetrics("/sched/goroutines:goroutines")["/sched/goroutines:goroutines"].Uint64()
+	})
+	Run()
+
+	// 最后创建的 G 在 runnext 中，最先运行，此时其他 20 个 G 都还没有结束
+	if running != 21 {
+		t.Errorf("/sched/goroutines:goroutines 应该包含正在运行的 G，期望 21，实际为 %d", running)
+	}
+
+	var names []string
+	for _, d := range AllMetrics() {
+		names = append(names, d.Name)
+	}
+	m := readMetrics(append(names, "/sched/unknown:events")...)
+
+	if v := m["/sched/goroutines:goroutines"].Uint64(); v != 0 {
+		t.Errorf("Run 结束后不应该还有 G，实际为 %d", v)
+	}
+	if v := m["/sched/gomaxprocs:threads"].Uint64(); v != 2 {
+		t.Errorf("/sched/gomaxprocs:threads 应该为 2，实际为 %d", v)
+	}
+	for _, name := range []string{"/sched/steals:events", "/sched/global-queue-gets:events", "/sched/runnext-hits:events"} {
+		if m[name].Uint64() == 0 {
+			t.Errorf("%s 不应该为 0", name)
+		}
+	}
+	if m["/sched/unknown:events"].Kind() != KindBad {
+		t.Error("不支持的指标应该是 KindBad")
+	}
+
+	h := m["/sched/latencies:seconds"].Float64Histogram()
+	if len(h.Buckets) != len(h.Counts)+1 || h.Buckets[0] != 0 || !math.IsInf(h.Buckets[len(h.Buckets)-1], 1) {
+		t.Fatalf("直方图的桶错误: %v", h.Buckets)
+	}
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	// 每个 G 运行两次：创建后一次，Sleep 醒来后一次（最后一个 G 只运行一次）
+	if total != 41 {
+		t.Errorf("直方图应该有 41 个样本，实际为 %d", total)
+	}
+}
+
+func TestRecordLatencyBuckets(t *testing.T) {
+	clock := initVirtual(t, 1)
+
+	pp := sched.allp[0]
+	for _, d := range []time.Duration{0, 500 * time.Nanosecond, time.Microsecond, 3 * time.Microsecond, time.Hour} {
+		gp := &g{runnableat: nanotime()}
+		clock.Advance(d)
+		recordLatency(pp, gp)
+	}
+
+	want := map[int]uint64{0: 2, 1: 1, 2: 1, latencyBuckets - 1: 1}
+	for i, c := range pp.stats.latency {
+		if c != want[i] {
+			t.Errorf("桶 %d [%v, %v) 应该有 %d 个样本，实际为 %d", i, latencyBounds[i], latencyBounds[i+1], want[i], c)
+		}
+	}
+}
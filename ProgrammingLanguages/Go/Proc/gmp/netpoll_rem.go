@@ -0,0 +1,206 @@
+package gmp
+
+import (
+	"net"
+	"os"
+	"time"
+	"unsafe"
+)
+
+// ============ 网络轮询器 ============
+
+// 等待结果，对应 runtime netpollblock 的返回值
+const (
+	pollNoError    = iota // 被 I/O 就绪唤醒
+	pollErrClosing        // 描述符已关闭
+	pollErrTimeout        // 截止时间已过
+)
+
+// PollDesc 对应 runtime 的 pollDesc：一个 I/O 对象的读写就绪状态，
+// 以及阻塞在它上面的 G。它是调度器提供给 I/O 实现（例如 fakenet）的钩子：
+// 读写方在数据未就绪时通过 WaitRead/WaitWrite park，
+// 数据到达时通过 ReadyRead/ReadyWrite 交给网络轮询器唤醒
+type PollDesc struct {
+	closing bool
+
+	rg, wg         *g   // 阻塞在读/写上的 G
+	rready, wready bool // 没有 G 在等待时到达的就绪通知（对应 pdReady）
+	rerr, werr     int  // 唤醒 rg/wg 的原因
+
+	rd, wd time.Time // 读/写截止时间，零值表示没有
+	rt, wt *timer    // 截止时间定时器
+
+	s *Scheduler // 创建它的实例，就绪通知和截止时间都交给这个实例
+}
+
+// NewPollDesc 在当前实例上创建一个新的 PollDesc（对应 netpollopen）
+func NewPollDesc() *PollDesc {
+	return &PollDesc{s: current()}
+}
+
+// WaitRead 阻塞当前 G，直到可读、截止时间已过或描述符关闭
+// 可读时返回 nil，否则返回 os.ErrDeadlineExceeded 或 net.ErrClosed
+func (pd *PollDesc) WaitRead() error {
+	return pd.wait('r')
+}
+
+// WaitWrite 阻塞当前 G，直到可写、截止时间已过或描述符关闭
+func (pd *PollDesc) WaitWrite() error {
+	return pd.wait('w')
+}
+
+// ReadyRead 通知读就绪，唤醒阻塞在读上的 G
+func (pd *PollDesc) ReadyRead() {
+	pd.locked(func() { pd.ready('r', pollNoError) })
+}
+
+// ReadyWrite 通知写就绪，唤醒阻塞在写上的 G
+func (pd *PollDesc) ReadyWrite() {
+	pd.locked(func() { pd.ready('w', pollNoError) })
+}
+
+// SetReadDeadline 设置读截止时间，零值表示取消
+func (pd *PollDesc) SetReadDeadline(t time.Time) {
+	pd.locked(func() { pd.setDeadline('r', t) })
+}
+
+// SetWriteDeadline 设置写截止时间，零值表示取消
+func (pd *PollDesc) SetWriteDeadline(t time.Time) {
+	pd.locked(func() { pd.setDeadline('w', t) })
+}
+
+// Close 关闭描述符，唤醒所有阻塞在它上面的 G（对应 netpollclose）
+func (pd *PollDesc) Close() {
+	pd.locked(func() {
+		pd.closing = true
+		pd.setDeadline('r', time.Time{})
+		pd.setDeadline('w', time.Time{})
+		pd.ready('r', pollErrClosing)
+		pd.ready('w', pollErrClosing)
+	})
+}
+
+// locked 在创建 pd 的实例上持有 sched.lock 执行 f
+func (pd *PollDesc) locked(f func()) {
+	pd.s.do(func() {
+		sched.lock.Lock()
+		defer sched.lock.Unlock()
+		f()
+	})
+}
+
+// wait 对应 netpollblock
+func (pd *PollDesc) wait(mode int) error {
+	sched.lock.Lock()
+	if !isuserg(getg()) {
+		sched.lock.Unlock()
+		panic("gmp: PollDesc wait must be called from a gmp goroutine")
+	}
+	exploretouch(unsafe.Pointer(pd))
+	gpp, rdy, errp, deadline := pd.fields(mode)
+
+	if err := pd.check(deadline); err != nil {
+		sched.lock.Unlock()
+		return err
+	}
+	if *rdy {
+		*rdy = false
+		sched.lock.Unlock()
+		return nil
+	}
+	if *gpp != nil {
+		sched.lock.Unlock()
+		panic("gmp: concurrent wait on PollDesc")
+	}
+
+	*gpp = getg()
+	*errp = pollNoError
+	gopark(waitReasonIOWait)
+
+	switch *errp {
+	case pollErrClosing:
+		return net.ErrClosed
+	case pollErrTimeout:
+		return os.ErrDeadlineExceeded
+	}
+	return nil
+}
+
+// check 检查描述符是否已关闭或已超时，调用者必须持有 sched.lock
+func (pd *PollDesc) check(deadline time.Time) error {
+	if pd.closing {
+		return net.ErrClosed
+	}
+	if !deadline.IsZero() && !deadline.After(nanotime()) {
+		return os.ErrDeadlineExceeded
+	}
+	return nil
+}
+
+// ready 对应 netpollunblock：把等待的 G 交给网络轮询器
+// 调用者必须持有 sched.lock
+func (pd *PollDesc) ready(mode int, why int) {
+	exploretouch(unsafe.Pointer(pd))
+	gpp, rdy, errp, _ := pd.fields(mode)
+	gp := *gpp
+	if gp == nil {
+		if why == pollNoError {
+			*rdy = true
+		}
+		return
+	}
+	*gpp = nil
+	*errp = why
+	netpollready(gp)
+}
+
+// setDeadline 设置截止时间并（重新）安排超时定时器
+// 调用者必须持有 sched.lock
+func (pd *PollDesc) setDeadline(mode int, t time.Time) {
+	deadline, tp := &pd.rd, &pd.rt
+	if mode == 'w' {
+		deadline, tp = &pd.wd, &pd.wt
+	}
+	*deadline = t
+	if *tp != nil {
+		deltimer(*tp)
+		*tp = nil
+	}
+	if t.IsZero() {
+		return
+	}
+	if !t.After(nanotime()) {
+		// 已经过期：立即唤醒等待者
+		pd.ready(mode, pollErrTimeout)
+		return
+	}
+	*tp = &timer{
+		when: t,
+		f:    func() { pd.ready(mode, pollErrTimeout) },
+	}
+	addtimer(*tp)
+}
+
+func (pd *PollDesc) fields(mode int) (gpp **g, rdy *bool, errp *int, deadline time.Time) {
+	if mode == 'w' {
+		return &pd.wg, &pd.wready, &pd.werr, pd.wd
+	}
+	return &pd.rg, &pd.rready, &pd.rerr, pd.rd
+}
+
+// netpollready 将因 I/O 就绪而被唤醒的 G 放入网络轮询器的就绪列表，
+// 等待 findrunnable 通过 netpoll 取走，调用者必须持有 sched.lock
+func netpollready(gp *g) {
+	gp.runnableat = nanotime()
+	explorewrite(qNetpoll)
+	sched.netpollq = append(sched.netpollq, gp)
+	wakep()
+}
+
+// netpoll 返回所有已就绪的 G（对应非阻塞的 netpoll(0)）
+// 返回的 G 仍处于 _Gwaiting，由调用者负责放入运行队列
+func netpoll() []*g {
+	list := sched.netpollq
+	sched.netpollq = nil
+	return list
+}
@@ -0,0 +1,79 @@
+package gmp
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPollDescReady(t *testing.T) {
+	initVirtual(t, 2)
+
+	pd := NewPollDesc()
+	var got error = errors.New("未执行")
+	Go(func() {
+		got = pd.WaitRead()
+	})
+	AfterFunc(time.Millisecond, pd.ReadyRead)
+	Run()
+
+	if got != nil {
+		t.Errorf("读就绪后 WaitRead 应该返回 nil, 实际 %v", got)
+	}
+}
+
+func TestPollDescReadyBeforeWait(t *testing.T) {
+	initVirtual(t, 1)
+
+	pd := NewPollDesc()
+	var got error = errors.New("未执行")
+	Go(func() {
+		pd.ReadyRead()
+		got = pd.WaitRead()
+	})
+	Run()
+
+	if got != nil {
+		t.Errorf("提前到达的就绪通知不应该丢失, 实际 %v", got)
+	}
+}
+
+func TestPollDescDeadline(t *testing.T) {
+	initVirtual(t, 1)
+
+	pd := NewPollDesc()
+	var got error
+	var waited time.Duration
+	Go(func() {
+		start := Now()
+		pd.SetReadDeadline(start.Add(10 * time.Millisecond))
+		got = pd.WaitRead()
+		waited = Since(start)
+	})
+	Run()
+
+	if !errors.Is(got, os.ErrDeadlineExceeded) {
+		t.Errorf("超时应该返回 os.ErrDeadlineExceeded, 实际 %v", got)
+	}
+	if waited != 10*time.Millisecond {
+		t.Errorf("应该等待 10ms, 实际 %v", waited)
+	}
+}
+
+func TestPollDescClose(t *testing.T) {
+	initVirtual(t, 1)
+
+	pd := NewPollDesc()
+	var got error
+	Go(func() {
+		got = pd.WaitWrite()
+	})
+	AfterFunc(time.Millisecond, pd.Close)
+	Run()
+
+	if !errors.Is(got, net.ErrClosed) {
+		t.Errorf("关闭后应该返回 net.ErrClosed, 实际 %v", got)
+	}
+}
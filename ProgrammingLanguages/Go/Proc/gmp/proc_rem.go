@@ -1,19 +1,47 @@
 package gmp
 
 import (
-	"os"
-	"runtime"
-	"strconv"
+	"errors"
+	"iter"
+	"slices"
+	"time"
 )
 
+// ============ 每个 M 的 g ============
+//
+// runtime 把当前的 g 存放在线程局部存储（TLS）中，每个线程读到自己的 g。
+// 这里的"线程"是 goroutine：每个 M 在 m.tls 中保存自己的 g，sched.curm 是正在执行
+// 装入的实例的 goroutine（owner，见 extern_rem.go）所在的 M。调度循环在同一个 goroutine 上
+// 轮流执行各个 M，切换 M 时用 setm 改变 curm；G 的协程运行在执行它的 M 上，execute 不切换 curm；
+// 系统调用中的 M 在自己的 goroutine（相当于 M 的线程）上运行，返回时装入实例并用 setm 回到自己的 M。
+// getg 按调用者所在的 goroutine 查找：调用者不是 owner 时返回 nil，就像 runtime 中没有 M 的外部线程，
+// 所以与调度器并行运行的代码读不到调度循环刚刚切换到的 M 的 g。
+// curm 和所有 tls 只在持有 sched.lock 时修改。
+
+// getg 返回调用者所在的 M 上运行的 g
+// 调用者不在任何 M 上时（调度器之外的 goroutine、系统调用中的 M 返回之前，
+// 调度循环等待定时器或系统调用返回时）返回 nil
 func getg() *g {
-	return currentG
+	if owner.Load() != gtoken() {
+		return nil
+	}
+	if mp := sched.curm; mp != nil {
+		return mp.tls
+	}
+	return nil
 }
 
-func setg(g *g) {
-	currentG = g
+// setg 设置 sched.curm 上运行的 g
+func setg(gp *g) {
+	sched.curm.tls = gp
 }
 
+// setm 让调用者的 goroutine 切换到 mp 上执行，之后 getg 返回 mp 的 g，调用者必须是 owner
+func setm(mp *m) {
+	sched.curm = mp
+}
+
+// ExecuteG 在调用者的栈上直接运行 g（不经过调度器）
 func ExecuteG(g *g) {
 	g.fn()
 	g.status = _Gdead
@@ -31,13 +59,21 @@ func initG0M0() {
 		id:       0,
 		g0:       g0,
 		curg:     g0,
+		tls:      g0,
 		spinning: false,
 	}
 
 	g0.m = m0
 	g0.g0 = g0 // g0 的 g0 指向自己
 
-	setg(g0)
+	// m0 是第一个 M
+	sched.allm = []*m{m0}
+	sched.midle = nil
+	sched.mnext = 1
+	sched.mcursor = 0
+	sched.nmspinning = 0
+
+	setm(m0)
 }
 
 // 模拟汇编代码的初始化操作
@@ -53,23 +89,49 @@ func schedinit() {
 		panic("schedinit must run on g0")
 	}
 
-	sched.maxmcount = 10000
-
-	// 读取 GOMAXPROCS 环境变量
-	procs := int32(runtime.NumCPU())
-	if v := os.Getenv("GOMAXPROCS"); v != "" {
-		if i, err := strconv.ParseInt(v, 10, 32); err == nil {
-			procs = int32(i)
-		}
+	cfg, err := sched.cfg.resolve()
+	if err != nil {
+		panic(err)
 	}
-
+	sched.cfg = cfg
+	sched.maxmcount = int32(cfg.MaxThreads)
+	sched.clock = sched.cfg.Clock
+	if sched.clock == nil {
+		sched.clock = realClock{}
+	}
+	sched.timers = nil
+	sched.netpollq = nil
+	sched.nsyscall = 0
+	sched.wakeup = make(chan struct{}, 1)
+	sched.allgs = nil
+	sched.running = false
+
+	// GMPDEBUG 中的调试变量，由 resolve 读取
+	sched.debug = cfg.debug
+	sched.starttime = nanotime()
+	sched.nextschedtrace = sched.starttime.Add(schedtraceInterval())
+
+	procs := int32(cfg.Procs)
 	if procresize(procs) != nil {
 		panic("unknown runnable goroutine during bootstrap")
 	}
+	initdecider(procs)
+	initrace()
 }
 
 // ============ Phase 3: 调度器核心逻辑 ============
 
+// gomaxprocs 返回没有被 procresize 废弃的 P 的数量，调用者必须持有 sched.lock
+func gomaxprocs() int {
+	n := 0
+	for _, pp := range sched.allp {
+		if pp.status != _Pdead {
+			n++
+		}
+	}
+	return n
+}
+
 // procresize 调整 P 的数量
 // 返回一个有可运行 G 的 P（如果有的话）
 func procresize(nprocs int32) *p {
@@ -80,6 +142,7 @@ func procresize(nprocs int32) *p {
 		pp := &p{
 			id:     int64(i),
 			status: _Pidle,
+			runq:   make([]*g, sched.cfg.LocalQueueSize),
 		}
 		sched.allp = append(sched.allp, pp)
 	}
@@ -127,6 +190,7 @@ func procresize(nprocs int32) *p {
 			continue
 		}
 		pp.status = _Pidle
+		pp.m = nil
 		pp.link = pidle
 		pidle = pp
 	}
@@ -138,12 +202,29 @@ func procresize(nprocs int32) *p {
 
 // newproc 创建一个新的 G 来运行 fn
 func newproc(fn func()) {
-	gp := newG(fn)
-	gp.status = _Grunnable
+	pc := callerpc()
+	sched.lock.Lock()
+	newproc1(fn, getg(), pc)
+	sched.lock.Unlock()
+}
 
-	// 获取当前的 P
-	mp := getg().m
-	pp := mp.p
+// newprocext 为调度器之外的调用者提交的函数创建 G，调用者必须持有 sched.lock
+// 调用者没有 P：G 全部放入全局队列，并为每个 G 启动一个空闲的 P（见 injectglist）
+func newprocext(q []extg) {
+	mp := sched.curm
+	setm(nil)
+	list := make([]*g, len(q))
+	for i, e := range q {
+		list[i], _ = newgrunnable(e.fn, nil, e.pc)
+	}
+	injectglist(list)
+	setm(mp)
+}
+
+// newproc1 是 newproc 的实现，调用者必须持有 sched.lock
+// callergp 和 callerpc 记录是谁在哪里创建了这个 G
+func newproc1(fn func(), callergp *g, callerpc uintptr) *g {
+	gp, pp := newgrunnable(fn, callergp, callerpc)
 
 	if pp == nil {
 		// 没有 P，放入全局队列
@@ -153,13 +234,52 @@ func newproc(fn func()) {
 		// next=true 使用 runnext 优化
 		runqput(pp, gp, true)
 	}
+
+	// 调度循环已经启动时，尝试唤醒一个空闲的 P 来分担工作
+	if sched.running {
+		wakep()
+	}
+	return gp
+}
+
+// newgrunnable 创建一个可运行但还没有放入任何队列的 G，同时返回当前的 P
+// 没有 M 在运行时（例如空闲时触发的定时器）P 为 nil。调用者必须持有 sched.lock
+func newgrunnable(fn func(), callergp *g, callerpc uintptr) (*g, *p) {
+	gp := newG(fn)
+	gp.status = _Grunnable
+	gp.runnableat = nanotime()
+	if isuserg(callergp) {
+		gp.parentGoid = callergp.goid
+	}
+	exploreready(gp)
+	racego(gp)
+	gp.gopc = callerpc
+	allgadd(gp)
+
+	var mp *m
+	var pp *p
+	if curg := getg(); curg != nil {
+		mp, pp = curg.m, curg.m.p
+	}
+	traceGoCreate(pp, mp, gp, callergp)
+	return gp, pp
+}
+
+// newprocbatch 为 fns 中的每个函数创建一个 G，用 injectglist 一次放入队列
+// 调用者必须持有 sched.lock
+func newprocbatch(fns []func(), callergp *g, callerpc uintptr) {
+	list := make([]*g, len(fns))
+	for i, fn := range fns {
+		list[i], _ = newgrunnable(fn, callergp, callerpc)
+	}
+	injectglist(list)
 }
 
 // findrunnable 查找一个可运行的 G
 // 按照以下顺序查找：
 // 1. 本地队列
 // 2. 全局队列
-// 3. 网络轮询器（暂不实现）
+// 3. 网络轮询器
 // 4. 工作窃取
 func findrunnable() *g {
 	mp := getg().m
@@ -169,18 +289,53 @@ func findrunnable() *g {
 		return nil
 	}
 
+	// runnext 中的 G 继承当前的时间片（对应 runtime 的 inheritTime）。时间片用完后
+	// 像被 sysmon 抢占一样把它排到本地队列尾部，防止互相唤醒的两个 G 独占 P
+	now := nanotime()
+	if next := pp.runnext; next == nil {
+		pp.schedwhen = now
+	} else if now.Sub(pp.schedwhen) >= timeslice() {
+		pp.runnext = nil
+		runqput(pp, next, false)
+		pp.schedwhen = now
+	}
+
 	// 1. 从本地队列获取
+	fromnext := pp.runnext != nil
 	if gp := runqget(pp); gp != nil {
+		sched.lastfind.src, sched.lastfind.n = "runq", 1
+		if fromnext {
+			sched.lastfind.src = "runnext"
+		}
 		return gp
 	}
 
 	// 2. 从全局队列获取
 	if gp := globrunqget(pp, 1); gp != nil {
+		sched.lastfind.src = "global"
 		return gp
 	}
 
-	// 3. 尝试从其他 P 窃取
+	// 3. 从网络轮询器获取已就绪的 G
+	if list := netpoll(); len(list) > 0 {
+		for _, gp := range list {
+			gp.waitreason = waitReasonZero
+			traceGoUnpark(pp, mp, gp)
+		}
+		// 同时就绪的 G 谁先运行
+		k := choose(decWake, len(list))
+		list[0], list[k] = list[k], list[0]
+		explorewrite(qNetpoll)
+		gp := list[0]
+		injectglist(list[1:])
+		gp.status = _Grunnable
+		sched.lastfind.src, sched.lastfind.n = "netpoll", len(list)
+		return gp
+	}
+
+	// 4. 尝试从其他 P 窃取
 	if gp := runqsteal(pp); gp != nil {
+		sched.lastfind.src = "steal"
 		return gp
 	}
 
@@ -188,7 +343,16 @@ func findrunnable() *g {
 	return nil
 }
 
-// execute 开始执行 gp
+// timeslice 返回 runnext 继承的时间片长度
+func timeslice() time.Duration {
+	if d := sched.cfg.TimeSlice; d > 0 {
+		return d
+	}
+	return defaultTimeSlice
+}
+
+// execute 开始执行 gp，直到 gp 结束或让出（park）后返回
+// 调用者必须持有 sched.lock，返回时仍然持有
 func execute(gp *g) {
 	mp := getg().m
 
@@ -196,54 +360,600 @@ func execute(gp *g) {
 	gp.status = _Grunning
 	gp.m = mp // 设置 g.m 关联
 	mp.curg = gp
+	mp.p.schedtick++
+	recordLatency(mp.p, gp)
+	traceGoStart(mp.p, mp, gp)
 
-	// 切换到 gp
+	// 切换到 gp，直到 gp 通过 mcall 切回 g0
+	// tls 只在持有 sched.lock 时修改，用户代码运行时不持有调度器锁
 	setg(gp)
+	sched.lock.Unlock()
+	goexited := true
+	defer func() {
+		if goexited {
+			// gp 调用了 runtime.Goexit（例如 t.FailNow），iter.Pull 把它传播到了
+			// 运行调度循环的 goroutine，与 runtime 中 Goexit 结束当前 goroutine 一样结束调度
+			setg(mp.g0)
+			goexit0(gp)
+			schedexit()
+		}
+	}()
+	gogo(gp)
+	goexited = false
+	setg(mp.g0)
+
+	// 此时 sched.lock 已由 gp 获取并随 mcall 交给了 g0
+	fn := mp.mcallfn
+	mp.mcallfn = nil
+	fn(gp)
+}
+
+// gogo 切换到 gp 的"栈"上运行，直到 gp 通过 mcall 切回或者结束
+// 每个 G 都是一个 iter.Pull 协程：gogo 调用 next 切换到协程，mcall 调用 yield 切回，
+// 与 runtime 在 g0 栈和 G 栈之间切换一样，调用者和 G 不会同时运行，
+// 切换由 runtime 的 coroswitch 直接完成，不经过 channel 和调度器的 runq。
+// 协程运行时 owner 是协程的 goroutine，切回后（包括 Goexit 传播回来时）换回调用者
+func gogo(gp *g) {
+	if gp.stopped {
+		// 协程已经被 gostop 结束，直接在 g0 上完成退出
+		gp.m.mcallfn = goexit0
+		return
+	}
+	if gp.coro == nil {
+		// 第一次运行：为 gp 分配栈
+		gp.coro, gp.stop = iter.Pull(func(yield func(struct{}) bool) {
+			gp.yield = yield
+			goentry(gp)
+		})
+	}
+	defer owner.Store(owner.Load())
+	gp.coro()
+}
+
+// goentry 是每个 G 的栈底，对应 runtime 在 G 栈上伪造的 goexit 返回地址
+func goentry(gp *g) {
+	owner.Store(gtoken())
+	defer func() {
+		r := recover()
+		if gp.stopped {
+			// 被 gostop 结束：不回到调度器，G 的记录由 gostop 的调用者处理
+			return
+		}
+		if r != nil {
+			gp.panicarg = r
+		}
+		goexit()
+	}()
 
 	// 执行 G 的函数
 	if gp.fn != nil {
 		gp.fn()
 	}
+}
 
-	// G 执行完毕，调用 goexit
-	goexit()
+// mcall 从当前 G 切换到 m 的 g0，并在 g0 上调用 fn(gp)
+// 调用者必须持有 sched.lock，锁随切换交给 g0。
+// 当 gp 再次被 execute 调度时 mcall 才返回
+func mcall(fn func(*g)) {
+	gp := getg()
+	gp.m.mcallfn = fn
+	ok := gp.yield(struct{}{})
+	owner.Store(gtoken())
+	if !ok {
+		// 协程被 gostop 结束，沿着 G 的栈展开到 goentry；defer 中调用的 gmp 函数仍在这个实例上执行
+		panic(errGostop)
+	}
+}
+
+// errGostop 是 gostop 结束协程时在 G 中抛出的 panic
+var errGostop = errors.New("gmp: goroutine stopped by the scheduler")
+
+// gostop 结束 gp 的协程，释放它占用的 goroutine 和栈，之后 gp 不会再运行
+// 调度器放弃还没有结束的 G 时调用（Close、重新初始化、报告死锁之后），否则 park 着的协程
+// 会一直留在进程中。协程从 park 的位置以 errGostop panic 展开，与 runtime.Goexit 一样
+// G 中的 defer 会执行，其中的 panic 被丢弃。
+// 调用者必须已经装入 gp 的实例，并且不能持有 sched.lock（defer 中可能调用 gmp 的函数）
+func gostop(gp *g) {
+	if gp.stop == nil {
+		return
+	}
+	stop := gp.stop
+	gp.stopped = true
+	defer owner.Store(owner.Load())
+	stop()
+	gp.coro, gp.yield, gp.stop = nil, nil, nil
+}
+
+// gostopall 结束所有 G 的协程，系统调用中的 G 返回后还会被调度，不结束
+// 调用者必须已经装入实例，并且不能持有 sched.lock
+func gostopall() {
+	for _, gp := range slices.Clone(sched.allgs) {
+		if gp.status != _Gsyscall {
+			gostop(gp)
+		}
+	}
 }
 
 // goexit G 退出时的清理工作
+// 运行在 G 自己的栈上，返回后协程结束，gogo 返回到 g0
 func goexit() {
-	gp := getg()
-	mp := gp.m
+	sched.lock.Lock()
+	getg().m.mcallfn = goexit0
+}
+
+// goexit0 在 g0 上完成 G 的退出
+func goexit0(gp *g) {
+	mp := getg().m
+	traceGoEnd(mp.p, mp, gp)
+	racegoexit(gp)
 
 	// 设置状态为 dead
 	gp.status = _Gdead
+	gp.m = nil
+	gp.coro, gp.yield, gp.stop = nil, nil, nil
+	allgremove(gp)
 
 	// 切换回 g0
-	setg(mp.g0)
 	mp.curg = nil
 
-	// 继续调度
-	schedule()
+	if gp.panicarg != nil {
+		// 与 runtime 一样，未恢复的 panic 会终止整个调度器
+		sched.running = false
+		sched.lock.Unlock()
+		panic(gp.panicarg)
+	}
 }
 
-// schedule 调度循环
-// 找到一个可运行的 G 并执行它
-func schedule() {
+// gopark 将当前 G 置为等待状态并切换回调度循环
+// 调用者必须持有 sched.lock；当 G 被 ready 并重新调度后返回，返回时不持有锁
+func gopark(reason waitReason) {
+	gp := getg()
+	if !isuserg(gp) {
+		sched.lock.Unlock()
+		panic("gopark: must be called from a gmp goroutine")
+	}
+	gp.waitreason = reason
+	mcall(park_m)
+}
+
+// isuserg 报告 gp 是否是用户 G（而不是某个 M 的 g0）
+func isuserg(gp *g) bool {
+	return gp != nil && gp.m != nil && gp != gp.m.g0
+}
+
+// park_m 在 g0 上完成 park
+func park_m(gp *g) {
 	mp := getg().m
+	traceGoPark(mp.p, mp, gp, gp.waitreason)
+	gp.status = _Gwaiting
+	gp.waitsince = nanotime()
+	gp.m = nil
+	mp.curg = nil
+}
+
+// ready 将等待中的 gp 标记为可运行并放入当前 P 的 runnext
+// 调用者必须持有 sched.lock
+func ready(gp *g) {
+	if gp.status != _Gwaiting {
+		panic("ready: bad g status")
+	}
+	gp.status = _Grunnable
+	gp.waitreason = waitReasonZero
+	gp.runnableat = nanotime()
+
+	var mp *m
+	var pp *p
+	if curg := getg(); curg != nil {
+		mp, pp = curg.m, curg.m.p
+	}
+	traceGoUnpark(pp, mp, gp)
+	exploreready(gp)
+	raceready(gp)
+	if pp != nil {
+		runqput(pp, gp, true)
+	} else {
+		globrunqput(gp)
+	}
+	wakep()
+}
+
+// goready 唤醒 gp，可以从 G 的代码中调用
+func goready(gp *g) {
+	sched.lock.Lock()
+	ready(gp)
+	sched.lock.Unlock()
+}
+
+// schedule 调度循环
+// 轮流让每个持有 P 的 M 找到一个可运行的 G 并执行它，
+// 直到所有 M 都空闲并且没有待触发的定时器
+func schedule() error {
+	var err error
+	current().do(func() {
+		if !initialized {
+			err = &SchedError{Op: "Run", Err: ErrNotInitialized}
+			return
+		}
+
+		sched.lock.Lock()
+		schedenter(homem())
+		var ev Event
+		for schedstep(&ev) {
+			// 两步之间让其他调度器实例执行
+			yieldengine()
+		}
+		schedexit()
+	})
+	return err
+}
+
+// schedenter 启动调度循环，mp 是调用者所在的 M，可能为 nil（见 homem）
+// 调用者必须持有 sched.lock
+func schedenter(mp *m) {
+	// 进入调度循环的 M 需要一个 P
+	if mp != nil && mp.p == nil {
+		if pp := pidleget(); pp != nil {
+			mremove(mp)
+			acquirep(mp, pp)
+		}
+	}
+	var pp *p
+	if mp != nil {
+		pp = mp.p
+	}
+	if pp != nil {
+		pp.schedwhen = nanotime()
+	}
+	sched.running = true
+	sched.deadlock = nil
+	sched.fatal = nil
+	// 和 runtime 的 newproc 一样，有待运行的 G 时唤醒空闲的 P 来窃取
+	if hasRunnable() || (pp != nil && !runqempty(pp)) {
+		wakep()
+	}
+}
+
+// schedexit 结束调度循环，调用者回到 homem 并释放 sched.lock
+func schedexit() {
+	sched.running = false
+	gohome()
+	sched.lock.Unlock()
+}
+
+// homem 返回调度循环之外的调用者（Run、Step 的调用者）所在的 M，即 m0
+// m0 在系统调用中时它在自己的 goroutine 上运行，g 是系统调用中的 G，调用者不能回到它上面，返回 nil；
+// 系统调用返回时再回到 m0（见 exitsyscall）
+func homem() *m {
+	if gp := m0.curg; isuserg(gp) && gp.status == _Gsyscall {
+		return nil
+	}
+	return m0
+}
+
+// gohome 让调用者回到 homem，调用者必须持有 sched.lock
+func gohome() {
+	mp := homem()
+	setm(mp)
+	if mp != nil {
+		setg(mp.g0)
+	}
+}
 
+// schedstep 做一次调度决定：让下一个 M 找到一个 G 并运行它直到它结束或让出，
+// 或者在所有 M 都空闲时等待定时器。ev 记录发生了什么。
+// 没有更多工作时返回 false。调用者必须持有 sched.lock
+func schedstep(ev *Event) bool {
+	*ev = Event{M: -1, P: -1, Victim: -1}
+	if sched.fatal != nil {
+		// 与 runtime 的 fatal error 一样立即停止调度
+		ev.Kind = EventDone
+		ev.Time = nanotime()
+		ev.Err = sched.fatal
+		return false
+	}
+	extinject()
+	mp := nextm()
 	if mp == nil {
-		panic("schedule: m is nil")
+		// 所有 M 都在休眠，调度循环不在任何 M 上
+		setm(nil)
+		if !idlewait() {
+			racedone()
+			ev.Kind = EventDone
+			ev.Time = nanotime()
+			if sched.deadlock != nil {
+				ev.Err = sched.deadlock
+			}
+			return false
+		}
+		ev.Kind = EventIdle
+		ev.Time = nanotime()
+		return true
 	}
 
+	setm(mp)
+	if x := sched.explore; x != nil {
+		x.begin(mp)
+	}
+	checkTimers()
+	checkschedtrace()
+	ev.M, ev.P = mp.id, mp.p.id
+	ev.Time = nanotime()
+
 	// 查找可运行的 G
+	sched.lastfind = findInfo{victim: -1}
 	gp := findrunnable()
-
 	if gp == nil {
-		// 没有可运行的 G
-		return
+		// 没有可运行的 G，M 交还 P 并休眠
+		ev.Kind = EventStop
+		stopm(mp)
+		if x := sched.explore; x != nil {
+			x.end(nil, "stop")
+		}
+		return true
+	}
+	if mp.spinning {
+		resetspinning(mp)
 	}
 
+	ev.Kind = EventRun
+	ev.G = gp.goid
+	ev.Source = sched.lastfind.src
+	ev.Victim = sched.lastfind.victim
+	ev.Count = sched.lastfind.n
+
 	// 执行找到的 G
 	execute(gp)
+	if x := sched.explore; x != nil {
+		x.end(gp, ev.Source)
+	}
+
+	switch gp.status {
+	case _Gdead:
+		ev.Outcome = "exit"
+	case _Gwaiting:
+		ev.Outcome = "park"
+		ev.WaitReason = gp.waitreason.String()
+	case _Grunnable:
+		ev.Outcome = "yield"
+	case _Gsyscall:
+		ev.Outcome = "syscall"
+	}
+	return true
+}
+
+// nextm 按轮转顺序返回下一个持有 P 的 M
+// 这样多个 M 交替执行，模拟它们并行运行
+func nextm() *m {
+	n := len(sched.allm)
+	skip := 0
+	if sched.decide.enabled() {
+		var ready []int64
+		for i := 0; i < n; i++ {
+			if mp := sched.allm[(sched.mcursor+i)%n]; mp.p != nil {
+				ready = append(ready, mp.id)
+			}
+		}
+		skip = choose(decNextm, len(ready))
+		if x := sched.explore; x != nil && len(ready) > 1 {
+			x.decisions[len(x.decisions)-1].cands = ready
+		}
+	}
+	for i := 0; i < n; i++ {
+		mp := sched.allm[(sched.mcursor+i)%n]
+		if mp.p != nil {
+			if skip > 0 {
+				skip--
+				continue
+			}
+			sched.mcursor = (sched.mcursor + i + 1) % n
+			return mp
+		}
+	}
+	return nil
+}
+
+// idlewait 在所有 M 都休眠时调用
+// 如果还有工作（新就绪的 G 或未来的定时器）返回 true
+func idlewait() bool {
+	extinject()
+	if hasRunnable() {
+		wakep()
+		return true
+	}
+	if len(sched.timers) == 0 {
+		if sched.nsyscall == 0 && (!sched.background || sched.shutdown) {
+			checkdead()
+			return false
+		}
+		// 等待系统调用返回，或者在后台运行时等待新提交的 G
+		wakeup := sched.wakeup
+		s := unlockengine()
+		<-wakeup
+		lockengine(s)
+		return true
+	}
+
+	// 等待最早的定时器到期：真实时钟会睡眠，虚拟时钟直接跳到该时刻
+	d := sched.timers[0].when.Sub(nanotime())
+	if sched.debug.schedtrace > 0 {
+		// 像 sysmon 一样按时醒来输出 schedtrace
+		d = min(d, sched.nextschedtrace.Sub(nanotime()))
+	}
+	if d > 0 {
+		clock, wakeup := sched.clock, sched.wakeup
+		_, real := clock.(realClock)
+		insyscall := sched.nsyscall > 0 || sched.background
+		s := unlockengine()
+		if real && insyscall {
+			// 系统调用和新提交的 G 可能在定时器之前到来
+			t := time.NewTimer(d)
+			select {
+			case <-t.C:
+			case <-wakeup:
+			}
+			t.Stop()
+		} else {
+			clock.Sleep(d)
+		}
+		lockengine(s)
+	}
+	checkTimers()
+	checkschedtrace()
+	return true
+}
+
+// hasRunnable 报告是否有不在任何运行中 P 上的可运行 G
+func hasRunnable() bool {
+	if len(sched.runq) > 0 || len(sched.netpollq) > 0 {
+		return true
+	}
+	for _, pp := range sched.allp {
+		if pp.status == _Pidle && !runqempty(pp) {
+			return true
+		}
+	}
+	return false
+}
+
+// ============ Phase 4: M 的管理 ============
+
+// wakep 如果有空闲的 P 并且没有自旋的 M，启动一个 M 去寻找工作
+func wakep() {
+	if sched.npidle.Load() == 0 || sched.nmspinning >= spinlimit() {
+		return
+	}
+	startm(true)
+}
+
+// startm 获取一个空闲的 P，并让一个空闲的（或新建的）M 绑定它
+func startm(spinning bool) {
+	pp := pidleget()
+	if pp == nil {
+		return
+	}
+	mp := mget()
+	if mp == nil {
+		if mp = allocm(); mp == nil {
+			pidleput(pp)
+			return
+		}
+	}
+	acquirep(mp, pp)
+	if spinning {
+		mp.spinning = true
+		sched.nmspinning++
+	}
+}
+
+// resetspinning M 找到了工作，退出自旋状态
+// 自旋的 M 少于上限时再唤醒一个 M，避免还有没人处理的工作
+func resetspinning(mp *m) {
+	mp.spinning = false
+	sched.nmspinning--
+	wakep()
+}
+
+// spinlimit 返回同时自旋的 M 的上限
+func spinlimit() int32 {
+	if n := sched.cfg.SpinLimit; n > 0 {
+		return int32(n)
+	}
+	return defaultSpinLimit
+}
+
+// stopm 交还 mp 的 P 并让 mp 进入空闲链表
+func stopm(mp *m) {
+	if mp.spinning {
+		mp.spinning = false
+		sched.nmspinning--
+	}
+	pidleput(releasep(mp))
+	mput(mp)
+}
+
+// allocm 创建一个新的 M
+// M 的数量达到上限时记录 ErrThreadLimit 并返回 nil
+func allocm() *m {
+	if int32(len(sched.allm)) >= sched.maxmcount {
+		schedfatal("newm", ErrThreadLimit)
+		return nil
+	}
+	mp := &m{
+		id: sched.mnext,
+		g0: &g{status: _Gidle},
+	}
+	mp.tls = mp.g0
+	sched.mnext++
+	mp.g0.m = mp
+	mp.g0.g0 = mp.g0
+	sched.allm = append(sched.allm, mp)
+	return mp
+}
+
+// acquirep 将 pp 绑定到 mp
+func acquirep(mp *m, pp *p) {
+	mp.p = pp
+	pp.m = mp
+	pp.status = _Prunning
+	pp.schedwhen = nanotime()
+	traceProcStart(pp, mp)
+}
+
+// releasep 解除 mp 与其 P 的绑定
+func releasep(mp *m) *p {
+	pp := mp.p
+	traceProcStop(pp, mp)
+	mp.p = nil
+	pp.m = nil
+	pp.status = _Pidle
+	return pp
+}
+
+// mput 将 mp 放入空闲 M 链表
+func mput(mp *m) {
+	mp.link = sched.midle
+	sched.midle = mp
+}
+
+// mget 从空闲 M 链表取出一个 M
+func mget() *m {
+	mp := sched.midle
+	if mp != nil {
+		sched.midle = mp.link
+		mp.link = nil
+	}
+	return mp
+}
+
+// mremove 将 mp 从空闲 M 链表中移除（如果它在其中）
+func mremove(mp *m) {
+	for pp := &sched.midle; *pp != nil; pp = &(*pp).link {
+		if *pp == mp {
+			*pp = mp.link
+			mp.link = nil
+			return
+		}
+	}
+}
+
+// pidleput 将 pp 放入空闲 P 链表
+func pidleput(pp *p) {
+	explorewrite(qIdle)
+	pp.link = sched.pidle
+	sched.pidle = pp
+	sched.npidle.Add(1)
+}
+
+// pidleget 从空闲 P 链表取出一个 P
+func pidleget() *p {
+	pp := sched.pidle
+	if pp != nil {
+		explorewrite(qIdle)
+		sched.pidle = pp.link
+		pp.link = nil
+		sched.npidle.Add(-1)
+	}
+	return pp
 }
 
 // ============ Phase 2: P 的本地队列操作 ============
@@ -252,6 +962,14 @@ func schedule() {
 // 如果队列满了，将一半的 G 放入全局队列
 // 参数 next 为 true 时，将 gp 放入 pp.runnext
 func runqput(pp *p, gp *g, next bool) {
+	switch sched.cfg.Policy {
+	case PolicyFIFO:
+		next = false
+	case PolicyGlobal:
+		globrunqput(gp)
+		return
+	}
+	explorewrite(pp.id)
 	if next {
 		// 优先放入 runnext
 		oldnext := pp.runnext
@@ -265,6 +983,11 @@ func runqput(pp *p, gp *g, next bool) {
 		gp = oldnext
 	}
 
+	if pp.runq == nil {
+		// 不经过 procresize 创建的 P
+		pp.runq = make([]*g, runqsize())
+	}
+
 	// 尝试放入本地队列
 retry:
 	h := pp.runqhead
@@ -282,13 +1005,27 @@ retry:
 	if runqputslow(pp, gp) {
 		return
 	}
-	// 全局队列操作失败，重试
+	// runqputslow 只在队列被其他 P 改变时失败（runtime 中 CAS 失败），重试
 	goto retry
 }
 
+// runqfull 报告在 gp 所在的 P 上创建 G 是否需要把本地队列的一半移到全局队列
+// 没有 P 或者只使用全局队列时不会满。调用者必须持有 sched.lock
+func runqfull(gp *g) bool {
+	if gp == nil || gp.m.p == nil || sched.cfg.Policy == PolicyGlobal {
+		return false
+	}
+	pp := gp.m.p
+	if pp.runnext == nil && sched.cfg.Policy != PolicyFIFO {
+		// 新的 G 直接放入 runnext
+		return false
+	}
+	return len(pp.runq) > 0 && pp.runqtail-pp.runqhead >= uint32(len(pp.runq))
+}
+
 // runqputslow 将 pp 的本地队列的一半 G 和 gp 一起放入全局队列
 func runqputslow(pp *p, gp *g) bool {
-	var batch [len(pp.runq)/2 + 1]*g
+	batch := make([]*g, len(pp.runq)/2+1)
 
 	// 获取本地队列的一半
 	h := pp.runqhead
@@ -297,7 +1034,8 @@ func runqputslow(pp *p, gp *g) bool {
 	n = n / 2
 
 	if n != uint32(len(pp.runq)/2) {
-		panic("runqputslow: queue size mismatch")
+		// 队列不是刚好满的，由 runqput 重试
+		return false
 	}
 
 	for i := uint32(0); i < n; i++ {
@@ -313,13 +1051,23 @@ func runqputslow(pp *p, gp *g) bool {
 	return true
 }
 
+// runqsize 返回本地队列的长度
+func runqsize() int {
+	if n := sched.cfg.LocalQueueSize; n > 0 {
+		return n
+	}
+	return defaultLocalQueueSize
+}
+
 // runqget 从 pp 的本地可运行队列获取一个 G
 // 如果 inheritTime 为 true，gp 应该继承当前时间片
 func runqget(pp *p) *g {
 	// 先检查 runnext
 	next := pp.runnext
 	if next != nil {
+		explorewrite(pp.id)
 		pp.runnext = nil
+		pp.stats.runnexthits++
 		return next
 	}
 
@@ -333,6 +1081,7 @@ func runqget(pp *p) *g {
 
 	gp := pp.runq[h%uint32(len(pp.runq))]
 	pp.runqhead = h + 1
+	explorewrite(pp.id)
 	return gp
 }
 
@@ -345,6 +1094,10 @@ func runqempty(pp *p) bool {
 
 // globrunqputbatch 将一批 G 放入全局队列
 func globrunqputbatch(batch []*g) {
+	if len(batch) == 0 {
+		return
+	}
+	explorewrite(qGlobal)
 	for _, gp := range batch {
 		if gp != nil {
 			gp.status = _Grunnable
@@ -355,6 +1108,7 @@ func globrunqputbatch(batch []*g) {
 
 // globrunqput 将 gp 放入全局队列
 func globrunqput(gp *g) {
+	explorewrite(qGlobal)
 	gp.status = _Grunnable
 	sched.runq = append(sched.runq, gp)
 }
@@ -367,14 +1121,22 @@ func globrunqget(pp *p, max int32) *g {
 	}
 
 	// 获取一个 G
+	explorewrite(qGlobal)
 	gp := sched.runq[0]
 	sched.runq = sched.runq[1:]
 
 	// 尝试获取更多 G 到本地队列（负载均衡）
 	n := int32(len(sched.runq))
+	if sched.cfg.Policy == PolicyGlobal {
+		// 没有本地队列
+		n = 0
+	}
 	if n > max {
 		n = max
 	}
+	pp.stats.globalgets++
+	sched.lastfind.n = int(n + 1)
+	traceGlobalGet(pp, n+1)
 
 	for i := int32(0); i < n && len(sched.runq) > 0; i++ {
 		g1 := sched.runq[0]
@@ -385,13 +1147,63 @@ func globrunqget(pp *p, max int32) *g {
 	return gp
 }
 
+// injectglist 将一批可运行的 G 放入队列，并为它们启动空闲的 P
+// 先用 runqputbatch 填满当前 P 的本地队列，放不下的放入全局队列；当前没有 P 时
+// （调度器之外的调用者、调度循环空闲时）全部放入全局队列。然后为这批 G 启动空闲的 P，
+// 最多 len(list) 个：启动的 M 从全局队列取走 G，或者从当前 P 窃取一半。
+// 这样一批 G 马上分散到各个 P 上，不用等空闲的 P 自己醒来窃取
+func injectglist(list []*g) {
+	if len(list) == 0 {
+		return
+	}
+	for _, gp := range list {
+		gp.status = _Grunnable
+	}
+	var pp *p
+	if curg := getg(); curg != nil {
+		pp = curg.m.p
+	}
+	if pp != nil && sched.cfg.Policy != PolicyGlobal {
+		runqputbatch(pp, list)
+	} else {
+		globrunqputbatch(list)
+	}
+	if sched.running {
+		for i := 0; i < len(list) && sched.npidle.Load() > 0; i++ {
+			startm(false)
+		}
+	}
+}
+
+// runqputbatch 将 list 放入 pp 的本地队列尾部，放不下的放入全局队列
+func runqputbatch(pp *p, list []*g) {
+	size := uint32(len(pp.runq))
+	i := 0
+	for ; i < len(list) && pp.runqtail-pp.runqhead < size; i++ {
+		pp.runq[pp.runqtail%size] = list[i]
+		pp.runqtail++
+	}
+	if i > 0 {
+		explorewrite(pp.id)
+	}
+	if i < len(list) {
+		globrunqputbatch(list[i:])
+	}
+}
+
 // ============ Phase 5: 工作窃取 ============
 
 // runqsteal 尝试从其他 P 的运行队列窃取 G
 // 窃取一半的 G 到 pp 的本地队列
 func runqsteal(pp *p) *g {
-	// 遍历所有 P
-	for _, p2 := range sched.allp {
+	// 遍历所有 P，从哪个 P 开始由 choose 决定（只有一个可窃取的 P 时不用选）
+	n := len(sched.allp)
+	off := 0
+	if n > 2 {
+		off = choose(decSteal, n)
+	}
+	for i := 0; i < n; i++ {
+		p2 := sched.allp[(off+i)%n]
 		if p2 == pp {
 			continue // 跳过自己
 		}
@@ -415,6 +1227,7 @@ func runqstealFromP(pp, p2 *p) *g {
 	if n == 0 {
 		return nil // p2 队列为空
 	}
+	explorewrite(p2.id)
 
 	// 窃取一半
 	n = n / 2
@@ -441,6 +1254,9 @@ func runqstealFromP(pp, p2 *p) *g {
 
 	// 更新 p2 的队列头
 	p2.runqhead = h + n
+	pp.stats.steals++
+	sched.lastfind.victim, sched.lastfind.n = p2.id, int(n)
+	traceSteal(pp, p2, n)
 
 	// 将剩余的 G 放入 pp 的本地队列
 	for _, g1 := range batch {
@@ -216,3 +216,142 @@ func TestRunqempty(t *testing.T) {
 		t.Error("有队列元素不应该为空")
 	}
 }
+
+func TestGoBatchOverflow(t *testing.T) {
+	s, err := New(Config{Procs: 1, LocalQueueSize: 4, Clock: NewVirtualClock(epoch)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// 没有空闲的 P：填满本地队列，剩下的放入全局队列，不使用 runnext
+	n := 0
+	fns := make([]func(), 10)
+	for i := range fns {
+		fns[i] = func() { n++ }
+	}
+	s.GoBatch(fns)
+	si := s.Snapshot()
+	if pi := si.Procs[0]; len(pi.Runq) != 4 || pi.Runnext != 0 || len(si.GlobalRunq) != 6 {
+		t.Errorf("本地队列应该有 4 个 G，全局队列 6 个: %+v", si)
+	}
+	s.Run()
+	if n != 10 {
+		t.Errorf("n = %d", n)
+	}
+}
+
+func TestGoBatchSpreads(t *testing.T) {
+	s := newVirtual(t, 4)
+
+	// 一批 G 先填入当前 P 的本地队列，空闲的 P 被唤醒后把它们窃取过去
+	ran := map[int64]int{}
+	var idle, started, global, local int
+	s.Go(func() {
+		sched.lock.Lock()
+		idle = int(sched.npidle.Load())
+		sched.lock.Unlock()
+		fns := make([]func(), 10)
+		for i := range fns {
+			fns[i] = func() {
+				sched.lock.Lock()
+				ran[getg().m.p.id]++
+				goyield()
+			}
+		}
+		GoBatch(fns)
+		sched.lock.Lock()
+		pp := getg().m.p
+		started = idle - int(sched.npidle.Load())
+		global, local = len(sched.runq), int(pp.runqtail-pp.runqhead)
+		sched.lock.Unlock()
+	})
+	s.Run()
+
+	if idle == 0 || started != idle || global != 0 || local != 10 {
+		t.Errorf("10 个 G 应该都在本地队列中并启动 %d 个空闲的 P，实际本地队列 %d 个，全局队列 %d 个，启动 %d 个 P",
+			idle, local, global, started)
+	}
+	if len(ran) != 4 {
+		t.Errorf("这批 G 应该在 4 个 P 上运行，实际为 %v", ran)
+	}
+}
+
+func TestGoBatchSingle(t *testing.T) {
+	s := newVirtual(t, 1)
+
+	// 只有一个函数的 GoBatch 也放入本地队列，不像 Go 那样占用 runnext
+	var si SchedInfo
+	ran := false
+	s.Go(func() {
+		GoBatch([]func(){func() { ran = true }})
+		si = Snapshot()
+	})
+	s.Run()
+
+	if pi := si.Procs[0]; len(pi.Runq) != 1 || pi.Runnext != 0 {
+		t.Errorf("这个 G 应该在本地队列中而不是 runnext: %+v", pi)
+	}
+	if !ran {
+		t.Error("GoBatch 创建的 G 应该运行")
+	}
+}
+
+func TestGoBatchLanding(t *testing.T) {
+	s, err := New(Config{Procs: 4, LocalQueueSize: 4, Clock: NewVirtualClock(epoch)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// 本地队列放得下 4 个：前 4 个按顺序填入当前 P，剩下 6 个按顺序放入全局队列，
+	// 3 个空闲的 P 都被启动，它们的队列还是空的
+	fns := make([]func(), 10)
+	for i := range fns {
+		fns[i] = func() {}
+	}
+	var self int64
+	var si SchedInfo
+	var procs []PInfo
+	s.Go(func() {
+		GoBatch(fns)
+		sched.lock.Lock()
+		self = getg().m.p.id
+		sched.lock.Unlock()
+		si = Snapshot()
+		procs = ReadProcs()
+	})
+	s.Run()
+
+	var batch []uint64
+	for _, pi := range si.Procs {
+		if pi.ID != self {
+			if len(pi.Runq) != 0 || pi.Runnext != 0 {
+				t.Errorf("P%d 的队列应该为空: %+v", pi.ID, pi)
+			}
+			continue
+		}
+		if len(pi.Runq) != 4 || pi.Runnext != 0 {
+			t.Errorf("当前 P 的本地队列应该有 4 个 G，不使用 runnext: %+v", pi)
+		}
+		batch = append(batch, pi.Runq...)
+	}
+	if len(si.GlobalRunq) != 6 {
+		t.Errorf("全局队列应该有 6 个 G，实际 %v", si.GlobalRunq)
+	}
+	batch = append(batch, si.GlobalRunq...)
+	for i := 1; i < len(batch); i++ {
+		if batch[i] != batch[i-1]+1 {
+			t.Errorf("这批 G 应该按创建顺序先填本地队列再放入全局队列，实际 %v", batch)
+			break
+		}
+	}
+	if len(si.IdleProcs) != 0 {
+		t.Errorf("空闲的 P 都应该被启动，实际空闲 %v", si.IdleProcs)
+	}
+	for _, pi := range procs {
+		if pi.Status != "running" || pi.M < 0 {
+			t.Errorf("P%d 应该绑定一个 M 运行: %+v", pi.ID, pi)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package gmp
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unsafe"
+)
+
+// ============ 数据竞争检测 ============
+//
+// 与 runtime 的 -race（ThreadSanitizer）一样基于 happens-before 关系：
+// 每个 G 有一个向量时钟，每个同步对象保存最后一次释放时的时钟。
+//
+//	创建 G        子 G 继承父 G 的时钟
+//	release(x)    L(x) = L(x) ⊔ C(g)，然后 C(g)[g]++
+//	acquire(x)    C(g) = C(g) ⊔ L(x)
+//	ready(gp)     C(gp) = C(gp) ⊔ C(g)，相当于在唤醒者和被唤醒者之间做一次 release/acquire
+//
+// 信号量、NotifyList 和 park/ready 在调度器内部标注，gmp/sync 的 Mutex、RWMutex、
+// WaitGroup、Once 通过 RaceAcquire/RaceRelease 标注（标准库的 sync 也是这样做的）。
+// gmp 没有 channel，G 之间传递数据要通过这些原语或 fakenet。
+//
+// 普通变量的读写不经过调度器，需要用 RaceRead/RaceWrite 或 Var[T] 标注。
+// 每个地址记录最后一次写和每个 G 最后一次读，两次访问中至少有一次是写、
+// 而且前一次访问不 happens-before 当前访问时报告数据竞争。
+// 调度器之外的代码（Run 之前和之后）算作 goroutine 0，Run 结束时它与所有结束的 G 同步。
+
+// raceenabled 在设置了 Config.Race 时为 true，原子变量使标注在关闭时不必加锁
+var raceenabled atomic.Bool
+
+// vclock 是向量时钟：goid -> 这个 G 的逻辑时间
+type vclock map[uint64]uint64
+
+func (c vclock) join(o vclock) {
+	for id, t := range o {
+		if t > c[id] {
+			c[id] = t
+		}
+	}
+}
+
+func (c vclock) clone() vclock {
+	n := make(vclock, len(c))
+	n.join(c)
+	return n
+}
+
+// raceaccess 是一次读或写
+type raceaccess struct {
+	gp    *g // nil 表示调度器之外的代码
+	goid  uint64
+	epoch uint64 // 访问时 G 自己的逻辑时间
+	write bool
+	pcs   []uintptr
+}
+
+// shadow 是一个地址的访问历史
+type shadow struct {
+	write *raceaccess
+	reads map[uint64]*raceaccess
+}
+
+// raceState 是竞争检测器的状态，由 sched.lock 保护
+type raceState struct {
+	main   vclock // 调度器之外的代码的时钟
+	exited vclock // 所有结束的 G 的时钟的并
+	syncs  map[uintptr]vclock
+	shadow map[uintptr]*shadow
+	seen   map[[2]uintptr]bool // 已经报告过的 (当前, 之前) 位置
+	races  []Race
+}
+
+// initrace 按 cfg 重置竞争检测器，由 schedinit 调用
+func initrace() {
+	sched.race = raceState{}
+	raceenabled.Store(sched.cfg.Race)
+	if !sched.cfg.Race {
+		return
+	}
+	sched.race = raceState{
+		main:   vclock{0: 1},
+		exited: vclock{},
+		syncs:  make(map[uintptr]vclock),
+		shadow: make(map[uintptr]*shadow),
+		seen:   make(map[[2]uintptr]bool),
+	}
+}
+
+// racectx 返回当前代码的时钟和 goid，调用者必须持有 sched.lock
+func racectx() (vclock, uint64) {
+	if gp := getg(); isuserg(gp) {
+		if gp.racectx == nil {
+			// 在开启竞争检测之前创建的 G
+			gp.racectx = vclock{gp.goid: 1}
+		}
+		return gp.racectx, gp.goid
+	}
+	return sched.race.main, 0
+}
+
+// 以下函数在没有开启竞争检测时什么都不做，调用者必须持有 sched.lock
+
+// racego 在创建 G 时调用：子 G 继承创建者的时钟
+func racego(newg *g) {
+	if !raceenabled.Load() {
+		return
+	}
+	c, id := racectx()
+	newg.racectx = c.clone()
+	newg.racectx[newg.goid] = 1
+	c[id]++
+}
+
+// raceready 在 G 被另一个 G 唤醒时调用
+// 定时器和 netpoll 在 g0 上唤醒 G，它们不是同步的参与者
+func raceready(gp *g) {
+	if !raceenabled.Load() || !isuserg(getg()) {
+		return
+	}
+	c, id := racectx()
+	if gp.racectx == nil {
+		gp.racectx = vclock{gp.goid: 1}
+	}
+	gp.racectx.join(c)
+	c[id]++
+}
+
+// racegoexit 在 G 结束时调用
+func racegoexit(gp *g) {
+	if raceenabled.Load() && gp.racectx != nil {
+		sched.race.exited.join(gp.racectx)
+	}
+}
+
+// racedone 在调度循环结束时调用：Run 返回之后的代码能看到所有 G 的写
+func racedone() {
+	if raceenabled.Load() {
+		sched.race.main.join(sched.race.exited)
+	}
+}
+
+func raceacquire(addr unsafe.Pointer) {
+	if !raceenabled.Load() {
+		return
+	}
+	c, _ := racectx()
+	if l := sched.race.syncs[uintptr(addr)]; l != nil {
+		c.join(l)
+	}
+}
+
+// racerelease 用当前时钟替换 addr 的时钟，racereleasemerge 与之合并
+func racerelease(addr unsafe.Pointer, merge bool) {
+	if !raceenabled.Load() {
+		return
+	}
+	c, id := racectx()
+	l := sched.race.syncs[uintptr(addr)]
+	if l == nil || !merge {
+		l = vclock{}
+		sched.race.syncs[uintptr(addr)] = l
+	}
+	l.join(c)
+	c[id]++
+}
+
+// RaceAcquire 在 addr 上建立 happens-before 关系：之前对 addr 的 RaceRelease 都 happens-before 当前 G
+// 对应 internal/race.Acquire，用于在 gmp 之外实现的同步原语
+func RaceAcquire(addr unsafe.Pointer) {
+	if !raceenabled.Load() {
+		return
+	}
+	sched.lock.Lock()
+	raceacquire(addr)
+	sched.lock.Unlock()
+}
+
+// RaceRelease 在 addr 上记录当前 G 的时钟，供之后的 RaceAcquire 使用
+func RaceRelease(addr unsafe.Pointer) {
+	if !raceenabled.Load() {
+		return
+	}
+	sched.lock.Lock()
+	racerelease(addr, false)
+	sched.lock.Unlock()
+}
+
+// RaceReleaseMerge 与 RaceRelease 相同，但保留之前的 release，
+// 用于有多个释放者的原语（例如 WaitGroup.Done、RWMutex.RUnlock）
+func RaceReleaseMerge(addr unsafe.Pointer) {
+	if !raceenabled.Load() {
+		return
+	}
+	sched.lock.Lock()
+	racerelease(addr, true)
+	sched.lock.Unlock()
+}
+
+// RaceRead 报告当前 G 读取了 addr 处的共享变量
+func RaceRead(addr unsafe.Pointer) {
+	raceaccess1(addr, false, 3)
+}
+
+// RaceWrite 报告当前 G 写入了 addr 处的共享变量
+func RaceWrite(addr unsafe.Pointer) {
+	raceaccess1(addr, true, 3)
+}
+
+// raceaccess1 检查一次访问，skip 是 runtime.Callers 要跳过的栈帧数，使栈从用户代码开始
+func raceaccess1(addr unsafe.Pointer, write bool, skip int) {
+	if !raceenabled.Load() {
+		return
+	}
+	var buf [16]uintptr
+	n := runtime.Callers(skip, buf[:])
+	pcs := append([]uintptr(nil), buf[:n]...)
+
+	sched.lock.Lock()
+	defer sched.lock.Unlock()
+	c, id := racectx()
+	cur := &raceaccess{goid: id, epoch: c[id], write: write, pcs: pcs}
+	if id != 0 {
+		cur.gp = getg()
+	}
+
+	sh := sched.race.shadow[uintptr(addr)]
+	if sh == nil {
+		sh = &shadow{reads: make(map[uint64]*raceaccess)}
+		sched.race.shadow[uintptr(addr)] = sh
+	}
+	// 前一次访问没有 happens-before 当前访问
+	concurrent := func(prev *raceaccess) bool {
+		return prev.goid != id && c[prev.goid] < prev.epoch
+	}
+	if w := sh.write; w != nil && concurrent(w) {
+		racereport(addr, cur, w)
+	}
+	if !write {
+		sh.reads[id] = cur
+		return
+	}
+	for _, r := range sh.reads {
+		if concurrent(r) {
+			racereport(addr, cur, r)
+		}
+	}
+	sh.write = cur
+	clear(sh.reads)
+}
+
+// Var 是一个在 G 之间共享的变量，Load 和 Store 会报告给竞争检测器
+// 零值可以直接使用，没有开启竞争检测时与普通变量一样
+type Var[T any] struct {
+	v T
+}
+
+// Load 读取变量
+func (v *Var[T]) Load() T {
+	raceaccess1(unsafe.Pointer(v), false, 3)
+	return v.v
+}
+
+// Store 写入变量
+func (v *Var[T]) Store(x T) {
+	raceaccess1(unsafe.Pointer(v), true, 3)
+	v.v = x
+}
+
+// Race 描述一次数据竞争：两次访问同一个地址，至少有一次是写，而且没有 happens-before 关系
+type Race struct {
+	Addr uintptr
+	Cur  RaceAccess // 发现竞争的访问
+	Prev RaceAccess // 之前的访问
+}
+
+// RaceAccess 是数据竞争中的一次访问
+type RaceAccess struct {
+	Write     bool
+	Goroutine GoroutineInfo // 访问者，Goid 为 0 表示调度器之外的代码
+	Stack     string        // 访问时的调用栈，每个栈帧两行，格式与 Stack 相同
+}
+
+// RaceError 由 RunE 在设置了 Config.Race 并且发现了数据竞争时返回
+type RaceError struct {
+	Races []Race
+}
+
+func (e *RaceError) Error() string {
+	return fmt.Sprintf("gmp: found %d data race(s)", len(e.Races))
+}
+
+// racereport 记录一次竞争，同一对位置只报告一次
+func racereport(addr unsafe.Pointer, cur, prev *raceaccess) {
+	var key [2]uintptr
+	if len(cur.pcs) > 0 && len(prev.pcs) > 0 {
+		key = [2]uintptr{cur.pcs[0], prev.pcs[0]}
+	}
+	if sched.race.seen[key] {
+		return
+	}
+	sched.race.seen[key] = true
+	sched.race.races = append(sched.race.races, Race{
+		Addr: uintptr(addr),
+		Cur:  cur.info(),
+		Prev: prev.info(),
+	})
+}
+
+func (a *raceaccess) info() RaceAccess {
+	ra := RaceAccess{Write: a.write, Stack: racestack(a.pcs)}
+	if a.gp == nil {
+		ra.Goroutine = GoroutineInfo{Status: "running", Func: "main"}
+		return ra
+	}
+	ra.Goroutine = ginfo(a.gp)
+	if a.gp.status == _Gdead {
+		ra.Goroutine.Status = "finished"
+	}
+	return ra
+}
+
+// racestack 格式化访问时的调用栈，到 G 的入口函数为止
+func racestack(pcs []uintptr) string {
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		if f.Function == "go-rem/gmp.goentry" || f.Function == "runtime.goexit" {
+			break
+		}
+		fmt.Fprintf(&b, "%s()\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// String 返回与 runtime 的竞争报告类似的文本
+//
+//	WARNING: DATA RACE
+//	Write at 0xc000012345 by goroutine 7:
+//	  ...
+//	Previous read at 0xc000012345 by goroutine 6:
+//	  ...
+//
+//	Goroutine 7 (running) created at:
+//	  ...
+func (r Race) String() string {
+	var b strings.Builder
+	b.WriteString("WARNING: DATA RACE\n")
+	r.Cur.write(&b, "", r.Addr)
+	b.WriteString("\n")
+	r.Prev.write(&b, "Previous ", r.Addr)
+	for _, a := range []RaceAccess{r.Cur, r.Prev} {
+		gi := a.Goroutine
+		if gi.Goid == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\nGoroutine %d (%s) created at:\n", gi.Goid, gi.Status)
+		if gi.CreatedBy != "" {
+			fmt.Fprintf(&b, "  %s()\n      %s:%d\n", gi.CreatedBy, gi.File, gi.Line)
+		}
+	}
+	return b.String()
+}
+
+func (a RaceAccess) write(b *strings.Builder, prefix string, addr uintptr) {
+	op := "read"
+	if a.Write {
+		op = "write"
+	}
+	if prefix == "" {
+		op = strings.ToUpper(op[:1]) + op[1:]
+	}
+	who := "main goroutine"
+	if a.Goroutine.Goid != 0 {
+		who = "goroutine " + strconv.FormatUint(a.Goroutine.Goid, 10)
+	}
+	fmt.Fprintf(b, "%s%s at %#x by %s:\n", prefix, op, addr, who)
+	for _, line := range strings.Split(strings.TrimSuffix(a.Stack, "\n"), "\n") {
+		if strings.HasPrefix(line, "\t") {
+			b.WriteString("      " + line[1:] + "\n")
+		} else {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+}
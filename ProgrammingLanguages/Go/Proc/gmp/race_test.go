@@ -0,0 +1,147 @@
+package gmp
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func initRace(t *testing.T) {
+	t.Helper()
+	if err := InitWithConfig(Config{Procs: 2, Clock: NewVirtualClock(epoch), Race: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func raceErr(t *testing.T, err error) *RaceError {
+	t.Helper()
+	var re *RaceError
+	if err != nil && !errors.As(err, &re) {
+		t.Fatalf("应该返回 *RaceError，实际为 %v", err)
+	}
+	return re
+}
+
+func TestRaceDetected(t *testing.T) {
+	initRace(t)
+	var x int
+	var w1, w2 uint64
+	Go(func() {
+		w1 = getg().goid
+		RaceWrite(unsafe.Pointer(&x))
+		x = 1
+	})
+	Go(func() {
+		w2 = getg().goid
+		RaceWrite(unsafe.Pointer(&x))
+		x = 2
+	})
+	re := raceErr(t, RunE())
+	if re == nil || len(re.Races) != 1 {
+		t.Fatalf("应该发现 1 个竞争: %v", re)
+	}
+
+	r := re.Races[0]
+	if r.Addr != uintptr(unsafe.Pointer(&x)) || !r.Cur.Write || !r.Prev.Write {
+		t.Errorf("竞争的访问错误: %+v", r)
+	}
+	if ids := []uint64{r.Cur.Goroutine.Goid, r.Prev.Goroutine.Goid}; !(ids[0] == w1 && ids[1] == w2 || ids[0] == w2 && ids[1] == w1) {
+		t.Errorf("竞争的 G 应该是 %d 和 %d，实际为 %v", w1, w2, ids)
+	}
+	if !strings.Contains(r.Cur.Stack, "TestRaceDetected.func") || !strings.HasSuffix(r.Prev.Goroutine.File, "race_test.go") {
+		t.Errorf("应该报告访问位置和创建位置: %+v", r)
+	}
+	if r.Prev.Goroutine.Status != "finished" {
+		t.Errorf("之前的 G 已经结束，状态为 %q", r.Prev.Goroutine.Status)
+	}
+
+	out := r.String()
+	for _, want := range []string{"WARNING: DATA RACE\nWrite at ", "Previous write at ", "(finished) created at:", "race_test.go:"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("报告中应该有 %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRaceSemaphore(t *testing.T) {
+	initRace(t)
+	var x Var[int]
+	sema := uint32(1)
+	for i := 0; i < 3; i++ {
+		Go(func() {
+			Semacquire(&sema)
+			x.Store(x.Load() + 1)
+			Semrelease(&sema, false)
+		})
+	}
+	if err := RunE(); err != nil {
+		t.Fatal(err)
+	}
+	if x.Load() != 3 {
+		t.Errorf("x = %d", x.Load())
+	}
+}
+
+func TestRaceReadWrite(t *testing.T) {
+	initRace(t)
+	var x Var[int]
+	// 并发的读不是竞争
+	for i := 0; i < 2; i++ {
+		Go(func() { x.Load() })
+	}
+	if err := RunE(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Run 结束后外部代码与所有 G 同步
+	x.Store(1)
+
+	Go(func() { x.Load() })
+	Go(func() { x.Store(2) })
+	re := raceErr(t, RunE())
+	if re == nil || len(re.Races) != 1 {
+		t.Fatalf("读和写之间应该有 1 个竞争: %v", re)
+	}
+	if r := re.Races[0]; r.Cur.Write == r.Prev.Write {
+		t.Errorf("应该是一次读和一次写: %+v", r)
+	}
+}
+
+func TestRaceGoAndReady(t *testing.T) {
+	initRace(t)
+	var x Var[int]
+	var parked *g
+	Go(func() {
+		// 创建之前的写 happens-before 子 G
+		x.Store(1)
+		Go(func() {
+			x.Store(x.Load() + 1)
+
+			// 唤醒之前的写 happens-before 被唤醒的 G
+			sched.lock.Lock()
+			ready(parked)
+			sched.lock.Unlock()
+		})
+		sched.lock.Lock()
+		parked = getg()
+		gopark(waitReasonZero)
+		x.Store(x.Load() + 1)
+	})
+	if err := RunE(); err != nil {
+		t.Fatal(err)
+	}
+	if x.Load() != 3 {
+		t.Errorf("x = %d", x.Load())
+	}
+}
+
+func TestRaceDisabled(t *testing.T) {
+	initVirtual(t, 2)
+	var x Var[int]
+	Go(func() { x.Store(1) })
+	Go(func() { x.Store(2) })
+	if err := RunE(); err != nil {
+		t.Errorf("没有开启竞争检测时不应该报告: %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package gmp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ============ 确定性调度与录制回放 ============
+//
+// 调度器中每个"有多个合法选择"的地方都通过 choose 做决定：
+//
+//	nextm  下一个运行的 M（有多个持有 P 的 M 时）
+//	steal  窃取时从哪个 P 开始尝试（对应 runtime 的 stealOrder）
+//	wake   多个 G 同时就绪时先唤醒哪一个（同时到期的定时器、netpoll 返回的 G）
+//
+// 默认总是选第一个，与没有这些决定点时的行为相同；设置了 Config.Seed 时用
+// 以 Seed 为种子的伪随机数选择，同一个 Seed 得到同一个交错顺序。
+// Config.Record 把每个决定写成一行，Replay 读回后强制调度器做出完全相同的决定。
+//
+// gmp 是协作式调度，没有抢占，也没有 select，所以没有抢占点和 select 分支的决定；
+// 系统调用与其他 G 真正并行运行，它们返回的先后顺序不受调度器控制，无法回放。
+
+// 决定的种类
+const (
+	decNextm = "nextm"
+	decSteal = "steal"
+	decWake  = "wake"
+)
+
+// replayHeader 是录制文件的第一行
+const replayHeader = "gmp-replay v1"
+
+// decision 是录制文件中的一行：在 n 个选择中选了第 choice 个
+type decision struct {
+	kind   string
+	choice int
+	n      int
+}
+
+// decider 做出并记录调度决定，由 sched.lock 保护
+type decider struct {
+	rng    *rand.Rand // nil 表示总是选第一个
+	record io.Writer
+	replay []decision
+	pos    int
+	count  int          // 已经做出的决定的数量
+	err    *ReplayError // 回放偏离录制时的错误
+}
+
+// ReplayError 表示回放时调度器的决定与录制文件不一致，
+// 通常是因为被测代码或配置与录制时不同
+type ReplayError struct {
+	Decision int    // 第几个决定（从 1 开始）
+	Want     string // 录制文件中的决定
+	Got      string // 调度器实际需要的决定
+}
+
+func (e *ReplayError) Error() string {
+	return fmt.Sprintf("gmp: replay diverged at decision %d: recorded %s, scheduler needed %s", e.Decision, e.Want, e.Got)
+}
+
+// initdecider 按 cfg 重置决定器，由 schedinit 调用
+func initdecider(procs int32) {
+	sched.decide = decider{record: sched.cfg.Record}
+	if sched.cfg.Seed != 0 {
+		sched.decide.rng = newrng(sched.cfg.Seed)
+	}
+	if w := sched.decide.record; w != nil {
+		fmt.Fprintf(w, "%s seed=%d procs=%d\n", replayHeader, sched.cfg.Seed, procs)
+	}
+}
+
+func newrng(seed int64) *rand.Rand {
+	return rand.New(rand.NewPCG(uint64(seed), 0))
+}
+
+// enabled 报告是否需要在决定点上做选择
+// 默认行为下总是选第一个，调用者可以跳过计算候选
+func (d *decider) enabled() bool {
+	return d.rng != nil || d.record != nil || d.replay != nil || sched.explore != nil
+}
+
+// choose 在 n 个选择中选一个，调用者必须持有 sched.lock
+// 只有一个选择时不算做决定，不会被记录
+func choose(kind string, n int) int {
+	d := &sched.decide
+	if n <= 1 {
+		return 0
+	}
+	d.count++
+
+	choice := -1
+	if d.pos < len(d.replay) {
+		rec := d.replay[d.pos]
+		if rec.kind == kind && rec.choice < n {
+			choice = rec.choice
+			d.pos++
+		} else if d.err == nil {
+			// 偏离之后不再回放，剩下的决定按种子做
+			d.err = &ReplayError{
+				Decision: d.count,
+				Want:     fmt.Sprintf("%s %d/%d", rec.kind, rec.choice, rec.n),
+				Got:      fmt.Sprintf("%s ?/%d", kind, n),
+			}
+			d.replay = nil
+		}
+	}
+	if choice < 0 {
+		choice = 0
+		if d.rng != nil {
+			choice = d.rng.IntN(n)
+		}
+	}
+
+	if d.record != nil {
+		fmt.Fprintf(d.record, "%s %d/%d\n", kind, choice, n)
+	}
+	recordexplore(kind, choice, n)
+	return choice
+}
+
+// Replay 读取 Config.Record 录制的文件，之后的调度强制做出与录制时相同的决定
+// 必须在 InitWithConfig 之后、创建 G 和 Run 之前调用，并且 P 的数量要与录制时相同。
+// 录制文件用完后按文件头中的种子继续做决定。
+// 如果运行偏离了录制（例如被测代码改变了），RunE 返回 *ReplayError
+func Replay(r io.Reader) error {
+	return current().Replay(r)
+}
+
+// Replay 与包级的 Replay 相同，回放到 s 上
+func (s *Scheduler) Replay(r io.Reader) error {
+	seed, procs, decisions, err := parseReplay(r)
+	if err != nil {
+		return err
+	}
+	s.do(func() { err = replay(seed, procs, decisions) })
+	return err
+}
+
+// parseReplay 解析整个录制文件，不需要装入调度器
+func parseReplay(r io.Reader) (seed int64, procs int, decisions []decision, err error) {
+	sc := bufio.NewScanner(r)
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return 0, 0, nil, err
+		}
+		return 0, 0, nil, fmt.Errorf("gmp: replay file is empty")
+	}
+	seed, procs, err = parseReplayHeader(sc.Text())
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	for line := 2; sc.Scan(); line++ {
+		d, err := parseDecision(sc.Text())
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("gmp: replay file line %d: %v", line, err)
+		}
+		decisions = append(decisions, d)
+	}
+	if err := sc.Err(); err != nil {
+		return 0, 0, nil, err
+	}
+	return seed, procs, decisions, nil
+}
+
+func replay(seed int64, procs int, decisions []decision) error {
+	sched.lock.Lock()
+	defer sched.lock.Unlock()
+	if !initialized {
+		return fmt.Errorf("gmp: Replay called before Init")
+	}
+	if sched.running {
+		return fmt.Errorf("gmp: Replay called while the scheduler is running")
+	}
+	if n := gomaxprocs(); n != procs {
+		return fmt.Errorf("gmp: replay file was recorded with %d Ps, scheduler has %d", procs, n)
+	}
+	sched.decide.replay = decisions
+	sched.decide.pos = 0
+	sched.decide.count = 0
+	sched.decide.err = nil
+	sched.decide.rng = nil
+	if seed != 0 {
+		sched.decide.rng = newrng(seed)
+	}
+	return nil
+}
+
+// parseReplayHeader 解析 "gmp-replay v1 seed=N procs=N"
+func parseReplayHeader(line string) (seed int64, procs int, err error) {
+	rest, ok := strings.CutPrefix(line, replayHeader+" ")
+	if !ok {
+		return 0, 0, fmt.Errorf("gmp: not a replay file: %q", line)
+	}
+	for _, field := range strings.Fields(rest) {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "seed":
+			seed, err = strconv.ParseInt(value, 10, 64)
+		case "procs":
+			procs, err = strconv.Atoi(value)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("gmp: bad replay header %q: %v", line, err)
+		}
+	}
+	return seed, procs, nil
+}
+
+// parseDecision 解析 "kind choice/n"
+func parseDecision(line string) (decision, error) {
+	kind, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return decision{}, fmt.Errorf("bad decision %q", line)
+	}
+	c, n, ok := strings.Cut(rest, "/")
+	if !ok {
+		return decision{}, fmt.Errorf("bad decision %q", line)
+	}
+	choice, err1 := strconv.Atoi(c)
+	total, err2 := strconv.Atoi(n)
+	if err1 != nil || err2 != nil || choice < 0 || choice >= total {
+		return decision{}, fmt.Errorf("bad decision %q", line)
+	}
+	return decision{kind: kind, choice: choice, n: total}, nil
+}
+
+// dueTimer 从已到期的定时器中选一个先触发，调用者必须持有 sched.lock
+// 候选按到期时间和加入顺序排序，默认选第一个，与堆顶相同
+func dueTimer() *timer {
+	now := nanotime()
+	var due []*timer
+	for _, t := range sched.timers {
+		if !t.when.After(now) {
+			due = append(due, t)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].when.Equal(due[j].when) {
+			return due[i].when.Before(due[j].when)
+		}
+		return due[i].seq < due[j].seq
+	})
+	t := due[choose(decWake, len(due))]
+	deltimer(t)
+	return t
+}
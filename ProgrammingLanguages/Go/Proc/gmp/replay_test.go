@@ -0,0 +1,134 @@
+package gmp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// seededRun 用 cfg 运行一个有多个 P、多个同时到期的定时器的负载，返回 G 完成的顺序
+func seededRun(t *testing.T, cfg Config, replay string) string {
+	t.Helper()
+	cfg.Procs = 4
+	cfg.Clock = NewVirtualClock(epoch)
+	if err := InitWithConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if replay != "" {
+		if err := Replay(strings.NewReader(replay)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var order []string
+	for i := 0; i < 6; i++ {
+		id := i
+		Go(func() {
+			order = append(order, fmt.Sprint(id))
+			Sleep(time.Millisecond) // 所有定时器同时到期
+			order = append(order, fmt.Sprint(id))
+		})
+	}
+	if err := RunE(); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(order, " ")
+}
+
+func TestSeedDeterministic(t *testing.T) {
+	base := seededRun(t, Config{}, "")
+	if again := seededRun(t, Config{}, ""); again != base {
+		t.Errorf("没有种子时调度应该是确定的: %s != %s", again, base)
+	}
+
+	orders := make(map[string]bool)
+	for seed := int64(1); seed <= 10; seed++ {
+		a := seededRun(t, Config{Seed: seed}, "")
+		if b := seededRun(t, Config{Seed: seed}, ""); a != b {
+			t.Errorf("种子 %d 两次运行的顺序不同: %s != %s", seed, a, b)
+		}
+		orders[a] = true
+	}
+	if len(orders) < 2 {
+		t.Errorf("不同的种子应该产生不同的交错顺序: %v", orders)
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	var rec bytes.Buffer
+	want := seededRun(t, Config{Seed: 42, Record: &rec}, "")
+
+	log := rec.String()
+	if !strings.HasPrefix(log, "gmp-replay v1 seed=42 procs=4\n") {
+		t.Fatalf("录制文件头错误:\n%s", log)
+	}
+	for _, kind := range []string{"nextm ", "wake "} {
+		if !strings.Contains(log, "\n"+kind) {
+			t.Errorf("录制文件中应该有 %q 决定:\n%s", kind, log)
+		}
+	}
+
+	// 去掉种子后仍然能靠录制文件重现
+	replay := strings.Replace(log, "seed=42", "seed=0", 1)
+	if got := seededRun(t, Config{}, replay); got != want {
+		t.Errorf("回放的顺序不同:\n录制 %s\n回放 %s", want, got)
+	}
+}
+
+func TestReplayDiverged(t *testing.T) {
+	if err := InitWithConfig(Config{Procs: 2, Clock: NewVirtualClock(epoch)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Replay(strings.NewReader("gmp-replay v1 seed=0 procs=2\nsteal 1/3\n")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		Go(func() {})
+	}
+	err := RunE()
+	var re *ReplayError
+	if !errors.As(err, &re) {
+		t.Fatalf("应该返回 *ReplayError，实际为 %v", err)
+	}
+	if re.Decision != 1 || re.Want != "steal 1/3" || !strings.HasPrefix(re.Got, "nextm") {
+		t.Errorf("ReplayError 错误: %+v", re)
+	}
+}
+
+func TestReplayInstance(t *testing.T) {
+	initVirtual(t, 1)
+	s := newVirtual(t, 2)
+
+	// 录制文件按 s 的 P 数量检查，回放也只影响 s
+	const file = "gmp-replay v1 seed=0 procs=2\nsteal 1/3\n"
+	if err := Replay(strings.NewReader(file)); err == nil {
+		t.Error("默认实例只有 1 个 P，Replay 应该返回错误")
+	}
+	if err := s.Replay(strings.NewReader(file)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		s.Go(func() {})
+	}
+	var re *ReplayError
+	if err := s.RunE(); !errors.As(err, &re) {
+		t.Fatalf("s 应该返回 *ReplayError，实际为 %v", err)
+	}
+}
+
+func TestReplayBadFile(t *testing.T) {
+	initVirtual(t, 2)
+	for _, tc := range []struct{ name, file string }{
+		{"empty", ""},
+		{"header", "not a replay file\n"},
+		{"procs", "gmp-replay v1 seed=0 procs=3\n"},
+		{"decision", "gmp-replay v1 seed=0 procs=2\nnextm 2/2\n"},
+	} {
+		if err := Replay(strings.NewReader(tc.file)); err == nil {
+			t.Errorf("%s: 应该返回错误", tc.name)
+		}
+	}
+}
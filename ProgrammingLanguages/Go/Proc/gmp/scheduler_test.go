@@ -1,12 +1,17 @@
 package gmp
 
 import (
+	"errors"
+	"iter"
+	"runtime"
 	"testing"
+	"time"
 )
 
 // Phase 3: 调度器核心功能测试
 
 func TestProcresize(t *testing.T) {
+	ownengine(t)
 	// 重置
 	g0 = nil
 	m0 = nil
@@ -49,6 +54,7 @@ func TestProcresize(t *testing.T) {
 }
 
 func TestNewproc(t *testing.T) {
+	ownengine(t)
 	// 重置
 	g0 = nil
 	m0 = nil
@@ -78,6 +84,7 @@ func TestNewproc(t *testing.T) {
 }
 
 func TestScheduleBasic(t *testing.T) {
+	ownengine(t)
 	// 重置
 	g0 = nil
 	m0 = nil
@@ -111,6 +118,7 @@ func TestScheduleBasic(t *testing.T) {
 }
 
 func TestFindrunnable(t *testing.T) {
+	ownengine(t)
 	// 重置
 	g0 = nil
 	m0 = nil
@@ -149,6 +157,7 @@ func TestFindrunnable(t *testing.T) {
 }
 
 func TestExecuteAndGoexit(t *testing.T) {
+	ownengine(t)
 	// 重置
 	g0 = nil
 	m0 = nil
@@ -199,6 +208,7 @@ func TestExecuteAndGoexit(t *testing.T) {
 }
 
 func TestScheduleMultipleGs(t *testing.T) {
+	ownengine(t)
 	// 重置
 	g0 = nil
 	m0 = nil
@@ -237,6 +247,7 @@ func TestScheduleMultipleGs(t *testing.T) {
 }
 
 func TestProcresizeExpand(t *testing.T) {
+	ownengine(t)
 	// 重置
 	g0 = nil
 	m0 = nil
@@ -269,6 +280,7 @@ func TestProcresizeExpand(t *testing.T) {
 }
 
 func TestProcresizeShrink(t *testing.T) {
+	ownengine(t)
 	// 重置
 	g0 = nil
 	m0 = nil
@@ -309,3 +321,152 @@ func TestProcresizeShrink(t *testing.T) {
 		t.Log("注意：P 中的 G 可能已被转移到全局队列")
 	}
 }
+
+func TestGoexitInG(t *testing.T) {
+	initVirtual(t, 2)
+
+	// runtime.Goexit 由 iter.Pull 传播到运行调度循环的 goroutine，结束它
+	done := make(chan bool)
+	go func() {
+		returned := false
+		defer func() { done <- returned }()
+		Go(func() { runtime.Goexit() })
+		RunE()
+		returned = true
+	}()
+	if <-done {
+		t.Error("Goexit 应该结束调用 RunE 的 goroutine")
+	}
+
+	// 调度器没有被破坏
+	initVirtual(t, 2)
+	ran := false
+	Go(func() { ran = true })
+	if err := RunE(); err != nil || !ran {
+		t.Errorf("Goexit 之后调度器应该还能使用: %v", err)
+	}
+}
+
+// BenchmarkSwitch 测量一次 goyield 往返：G -> g0 -> findrunnable -> G
+func BenchmarkSwitch(b *testing.B) {
+	if err := InitWithConfig(Config{Procs: 1}); err != nil {
+		b.Fatal(err)
+	}
+	Go(func() {
+		for i := 0; i < b.N; i++ {
+			sched.lock.Lock()
+			goyield()
+		}
+	})
+	b.ResetTimer()
+	Run()
+}
+
+// BenchmarkSwitchCoro 测量裸的 iter.Pull 往返（不经过调度器），即 gogo + mcall 本身的开销
+func BenchmarkSwitchCoro(b *testing.B) {
+	next, stop := iter.Pull(func(yield func(struct{}) bool) {
+		for yield(struct{}{}) {
+		}
+	})
+	defer stop()
+	for i := 0; i < b.N; i++ {
+		next()
+	}
+}
+
+// BenchmarkSwitchChannel 测量 Phase 22 之前的切换方式：g0 和 G 各是一个 goroutine，
+// 通过 gp.resume 和 m.g0ch 两个 channel 交接控制权，作为 BenchmarkSwitchCoro 的对照
+func BenchmarkSwitchChannel(b *testing.B) {
+	resume, g0ch := make(chan struct{}), make(chan struct{})
+	go func() {
+		for range resume {
+			g0ch <- struct{}{}
+		}
+	}()
+	defer close(resume)
+	for i := 0; i < b.N; i++ {
+		resume <- struct{}{}
+		<-g0ch
+	}
+}
+
+// BenchmarkGo 创建并运行 b.N 个 G，-benchtime=1000000x 即一百万个 G
+func BenchmarkGo(b *testing.B) {
+	if err := InitWithConfig(Config{Procs: 4}); err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		Go(func() {})
+	}
+	Run()
+}
+
+// BenchmarkGoFromG 在 G 中创建 G，Go 要比较调用者的 gtoken 才能确定使用哪个实例
+func BenchmarkGoFromG(b *testing.B) {
+	if err := InitWithConfig(Config{Procs: 4}); err != nil {
+		b.Fatal(err)
+	}
+	Go(func() {
+		for i := 0; i < b.N; i++ {
+			Go(func() {})
+		}
+	})
+	Run()
+}
+
+func TestGostopReleasesGoroutines(t *testing.T) {
+	initVirtual(t, 2)
+	base := runtime.NumGoroutine()
+
+	// 死锁之后阻塞的 G 的协程被结束，defer 与 runtime.Goexit 一样执行
+	const n = 100
+	deferred := 0
+	for i := 0; i < n; i++ {
+		Go(func() {
+			defer func() { deferred++ }()
+			blockForever()
+		})
+	}
+	if err := RunE(); err == nil {
+		t.Fatal("应该检测到死锁")
+	}
+	if got := runtime.NumGoroutine(); got > base+2 {
+		t.Errorf("死锁之后还有 %d 个 goroutine，开始时为 %d", got, base)
+	}
+	if deferred != n {
+		t.Errorf("执行了 %d 个 defer，应该是 %d", deferred, n)
+	}
+	if l := Leaks(); len(l) != n {
+		t.Errorf("结束协程之后 G 仍然应该出现在 Leaks 中，实际为 %d 个", len(l))
+	}
+
+	// 线程耗尽使调度停止时 G 还 park 着，Close 结束它们
+	s, err := New(Config{Procs: 1, MaxThreads: 1, Clock: NewVirtualClock(epoch)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	s.Go(func() {
+		for i := 0; i < n; i++ {
+			Go(blockForever)
+		}
+		Sleep(time.Millisecond)
+		Syscall(func() { <-release })
+	})
+	if err := s.RunE(); !errors.Is(err, ErrThreadLimit) {
+		t.Fatalf("RunE 应该返回 ErrThreadLimit，实际为 %v", err)
+	}
+	close(release)
+	for s.Snapshot().NumSyscall > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if got := runtime.NumGoroutine(); got < base+n {
+		t.Fatalf("park 着的 G 应该各占一个 goroutine，实际为 %d", got-base)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := runtime.NumGoroutine(); got > base+2 {
+		t.Errorf("Close 之后还有 %d 个 goroutine，开始时为 %d", got, base)
+	}
+}
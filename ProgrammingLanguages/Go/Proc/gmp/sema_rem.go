@@ -0,0 +1,328 @@
+package gmp
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// ============ 信号量 ============
+//
+// 对应 runtime/sema.go：以地址为键的信号量表，是 gmp/sync 中所有同步原语的基础。
+// 表有 semTabSize 个 semaRoot，每个 semaRoot 上挂着一个按地址区分的链表，
+// 链表的每个节点（sudog）又带着一串等待同一个地址的 G。
+// 与 runtime 用 treap 不同，这里用链表查找地址，等待者很少时两者差别不大。
+// 每个调度器实例有自己的表（sched.semtable），所有 semaRoot 都由 sched.lock 保护。
+
+const semTabSize = 251
+
+// sudog 表示一个等待在某个地址上的 G
+type sudog struct {
+	g    *g
+	addr *uint32
+
+	next     *sudog // 同一个 semaRoot 中下一个不同地址的链表头
+	waitlink *sudog // 等待同一个地址的下一个 G
+	waittail *sudog // 等待同一个地址的最后一个 G（只在链表头上有效）
+
+	ticket uint32 // 为 1 表示信号量已由 semrelease 直接交给了这个 G
+}
+
+type semaRoot struct {
+	head  *sudog // 每个不同地址的第一个等待者
+	nwait atomic.Uint32
+}
+
+func semroot(addr *uint32) *semaRoot {
+	return &sched.semtable[(uintptr(unsafe.Pointer(addr))>>3)%semTabSize]
+}
+
+// cansemacquire 尝试把 *addr 减一
+func cansemacquire(addr *uint32) bool {
+	for {
+		v := atomic.LoadUint32(addr)
+		if v == 0 {
+			return false
+		}
+		if atomic.CompareAndSwapUint32(addr, v, v-1) {
+			return true
+		}
+	}
+}
+
+// queue 把 s 加入等待 addr 的队列，lifo 为 true 时放到队首
+func (root *semaRoot) queue(addr *uint32, s *sudog, lifo bool) {
+	s.addr = addr
+	for pt := &root.head; *pt != nil; pt = &(*pt).next {
+		t := *pt
+		if t.addr != addr {
+			continue
+		}
+		if lifo {
+			// s 取代 t 成为链表头
+			*pt = s
+			s.next = t.next
+			s.waitlink = t
+			s.waittail = t.waittail
+			if s.waittail == nil {
+				s.waittail = t
+			}
+			t.next = nil
+			t.waittail = nil
+		} else {
+			if t.waittail == nil {
+				t.waitlink = s
+			} else {
+				t.waittail.waitlink = s
+			}
+			t.waittail = s
+		}
+		return
+	}
+	// addr 还没有等待者
+	s.next = root.head
+	root.head = s
+}
+
+// dequeue 取出等待 addr 的第一个 G
+func (root *semaRoot) dequeue(addr *uint32) *sudog {
+	for pt := &root.head; *pt != nil; pt = &(*pt).next {
+		s := *pt
+		if s.addr != addr {
+			continue
+		}
+		if t := s.waitlink; t != nil {
+			// 下一个等待者成为链表头
+			*pt = t
+			t.next = s.next
+			t.waittail = s.waittail
+			if t.waittail == t {
+				t.waittail = nil
+			}
+		} else {
+			*pt = s.next
+		}
+		s.next, s.waitlink, s.waittail = nil, nil, nil
+		return s
+	}
+	return nil
+}
+
+// semacquire1 等待 *addr > 0，然后把它减一
+func semacquire1(addr *uint32, lifo bool, reason waitReason) {
+	Touch(unsafe.Pointer(addr))
+	defer RaceAcquire(unsafe.Pointer(addr))
+	// 快速路径
+	if cansemacquire(addr) {
+		return
+	}
+
+	s := &sudog{}
+	root := semroot(addr)
+	for {
+		sched.lock.Lock()
+		// 先增加 nwait，让 semrelease 知道需要唤醒
+		root.nwait.Add(1)
+		if cansemacquire(addr) {
+			root.nwait.Add(^uint32(0))
+			sched.lock.Unlock()
+			return
+		}
+		s.g = getg()
+		s.ticket = 0
+		root.queue(addr, s, lifo)
+		gopark(reason)
+		if s.ticket != 0 || cansemacquire(addr) {
+			return
+		}
+	}
+}
+
+// semrelease1 把 *addr 加一，并唤醒一个等待者
+// handoff 为 true 时直接把信号量交给等待者，并让出当前 G 使其立即运行
+func semrelease1(addr *uint32, handoff bool) {
+	Touch(unsafe.Pointer(addr))
+	RaceReleaseMerge(unsafe.Pointer(addr))
+	atomic.AddUint32(addr, 1)
+	current().do(func() { semwake(addr, handoff) })
+}
+
+// semwake 唤醒 addr 上的一个等待者，调用者必须已经装入调度器实例
+func semwake(addr *uint32, handoff bool) {
+	root := semroot(addr)
+
+	// 没有等待者
+	if root.nwait.Load() == 0 {
+		return
+	}
+
+	sched.lock.Lock()
+	s := root.dequeue(addr)
+	if s == nil {
+		sched.lock.Unlock()
+		return
+	}
+	root.nwait.Add(^uint32(0))
+	if handoff && cansemacquire(addr) {
+		s.ticket = 1
+	}
+	ready(s.g)
+	if s.ticket == 1 && isuserg(getg()) {
+		// 等待者已经在 runnext 上，让出 P 让它立即运行
+		goyield()
+		return
+	}
+	sched.lock.Unlock()
+}
+
+// goyield 让出当前 G：放到当前 P 本地队列的队尾，而不是像 Gosched 那样放入全局队列
+// 调用者必须持有 sched.lock，返回时不持有
+func goyield() {
+	mcall(goyield_m)
+}
+
+func goyield_m(gp *g) {
+	mp := getg().m
+	traceGoSched(mp.p, mp, gp)
+	gp.runnableat = nanotime()
+	gp.m = nil
+	mp.curg = nil
+	runqput(mp.p, gp, false)
+}
+
+// ============ notifyList（sync.Cond 的基础）============
+
+// NotifyList 对应 runtime 的 notifyList，基于票号实现 sync.Cond
+// 零值可以直接使用
+type NotifyList struct {
+	wait   atomic.Uint32 // 下一个等待者的票号
+	notify uint32        // 下一个要被唤醒的票号
+	head   *sudog
+	tail   *sudog
+}
+
+// Add 领取一个票号，必须在释放外部锁之前调用
+func (l *NotifyList) Add() uint32 {
+	Touch(unsafe.Pointer(l))
+	return l.wait.Add(1) - 1
+}
+
+// Wait 等待票号 t 被通知
+func (l *NotifyList) Wait(t uint32) {
+	defer RaceAcquire(unsafe.Pointer(l))
+	sched.lock.Lock()
+	exploretouch(unsafe.Pointer(l))
+	if less(t, l.notify) {
+		// 已经被通知过了
+		sched.lock.Unlock()
+		return
+	}
+	s := &sudog{g: getg(), ticket: t}
+	if l.tail == nil {
+		l.head = s
+	} else {
+		l.tail.next = s
+	}
+	l.tail = s
+	gopark(waitReasonSyncCondWait)
+}
+
+// NotifyOne 唤醒票号最小的一个等待者
+func (l *NotifyList) NotifyOne() {
+	Touch(unsafe.Pointer(l))
+	RaceReleaseMerge(unsafe.Pointer(l))
+	if l.wait.Load() == atomic.LoadUint32(&l.notify) {
+		return
+	}
+	current().do(l.notifyone)
+}
+
+func (l *NotifyList) notifyone() {
+	sched.lock.Lock()
+	defer sched.lock.Unlock()
+	t := l.notify
+	if t == l.wait.Load() {
+		return
+	}
+	atomic.StoreUint32(&l.notify, t+1)
+
+	// 票号为 t 的等待者可能还没有调用 Wait，此时它会在 Wait 中直接返回
+	for p, s := (*sudog)(nil), l.head; s != nil; p, s = s, s.next {
+		if s.ticket == t {
+			n := s.next
+			if p != nil {
+				p.next = n
+			} else {
+				l.head = n
+			}
+			if n == nil {
+				l.tail = p
+			}
+			s.next = nil
+			ready(s.g)
+			return
+		}
+	}
+}
+
+// NotifyAll 唤醒所有等待者
+func (l *NotifyList) NotifyAll() {
+	Touch(unsafe.Pointer(l))
+	RaceReleaseMerge(unsafe.Pointer(l))
+	if l.wait.Load() == atomic.LoadUint32(&l.notify) {
+		return
+	}
+	current().do(l.notifyall)
+}
+
+func (l *NotifyList) notifyall() {
+	sched.lock.Lock()
+	defer sched.lock.Unlock()
+	s := l.head
+	l.head = nil
+	l.tail = nil
+	atomic.StoreUint32(&l.notify, l.wait.Load())
+	for s != nil {
+		next := s.next
+		s.next = nil
+		ready(s.g)
+		s = next
+	}
+}
+
+// less 在票号回绕时也能正确比较
+func less(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+// ============ 导出给 gmp/sync 的信号量 API ============
+
+// Semacquire 等待 *addr > 0 然后将其减一（对应 runtime_Semacquire）
+func Semacquire(addr *uint32) {
+	semacquire1(addr, false, waitReasonSemacquire)
+}
+
+// SemacquireMutex 供 Mutex 使用，lifo 为 true 时排到队首（对应 runtime_SemacquireMutex）
+func SemacquireMutex(addr *uint32, lifo bool) {
+	semacquire1(addr, lifo, waitReasonSyncMutexLock)
+}
+
+// SemacquireRWMutexR 供 RWMutex.RLock 使用
+func SemacquireRWMutexR(addr *uint32, lifo bool) {
+	semacquire1(addr, lifo, waitReasonSyncRWMutexRLock)
+}
+
+// SemacquireRWMutex 供 RWMutex.Lock 使用
+func SemacquireRWMutex(addr *uint32, lifo bool) {
+	semacquire1(addr, lifo, waitReasonSyncRWMutexLock)
+}
+
+// SemacquireWaitGroup 供 WaitGroup.Wait 使用
+func SemacquireWaitGroup(addr *uint32) {
+	semacquire1(addr, false, waitReasonSyncWaitGroupWait)
+}
+
+// Semrelease 将 *addr 加一并唤醒一个等待者（对应 runtime_Semrelease）
+// handoff 为 true 时信号量直接交给等待者，当前 G 让出 P
+func Semrelease(addr *uint32, handoff bool) {
+	semrelease1(addr, handoff)
+}
@@ -0,0 +1,79 @@
+package gmp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSemaRootQueue(t *testing.T) {
+	var root semaRoot
+	var a, b uint32
+	s1, s2, s3, s4 := &sudog{}, &sudog{}, &sudog{}, &sudog{}
+
+	root.queue(&a, s1, false)
+	root.queue(&b, s2, false)
+	root.queue(&a, s3, false)
+	root.queue(&a, s4, true) // lifo 排到队首
+
+	want := []*sudog{s4, s1, s3}
+	for i, w := range want {
+		if got := root.dequeue(&a); got != w {
+			t.Fatalf("第 %d 个出队的等待者错误", i)
+		}
+	}
+	if root.dequeue(&a) != nil {
+		t.Error("a 上已经没有等待者")
+	}
+	if root.dequeue(&b) != s2 {
+		t.Error("b 上的等待者不应该受 a 影响")
+	}
+}
+
+func TestSemacquireParks(t *testing.T) {
+	initVirtual(t, 2)
+
+	var sema uint32
+	var order []int
+	for i := 0; i < 3; i++ {
+		id := i
+		Go(func() {
+			Semacquire(&sema)
+			order = append(order, id)
+		})
+	}
+	Go(func() {
+		Sleep(time.Millisecond)
+		for i := 0; i < 3; i++ {
+			Semrelease(&sema, false)
+		}
+	})
+	Run()
+
+	if len(order) != 3 {
+		t.Fatalf("3 个等待者都应该获取到信号量, 实际 %v", order)
+	}
+	if sema != 0 {
+		t.Errorf("信号量应该归零, 实际 %d", sema)
+	}
+}
+
+func TestSemreleaseHandoff(t *testing.T) {
+	initVirtual(t, 1)
+
+	var sema uint32
+	var events []string
+	Go(func() {
+		Semacquire(&sema)
+		events = append(events, "waiter")
+	})
+	Go(func() {
+		Sleep(time.Millisecond)
+		Semrelease(&sema, true)
+		events = append(events, "releaser")
+	})
+	Run()
+
+	if len(events) != 2 || events[0] != "waiter" {
+		t.Errorf("handoff 应该让等待者先于释放者运行, 实际 %v", events)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package gmp
+
+// 没有 SIGQUIT 的平台上 DumpOnSIGQUIT 不起作用
+func installSigquit()   {}
+func uninstallSigquit() {}
@@ -0,0 +1,40 @@
+//go:build unix
+
+package gmp
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var (
+	sigquitCh  chan os.Signal
+	sigquitOut io.Writer = os.Stderr
+)
+
+// installSigquit 在收到 SIGQUIT 时输出所有 G 的转储
+func installSigquit() {
+	if sigquitCh != nil {
+		return
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGQUIT)
+	sigquitCh = ch
+	go func() {
+		for range ch {
+			// 信号在调度器之外的 goroutine 上处理，Stack 转储默认实例
+			io.WriteString(sigquitOut, "SIGQUIT: gmp goroutine dump\n\n"+Stack(true)+"\n")
+		}
+	}()
+}
+
+func uninstallSigquit() {
+	if sigquitCh == nil {
+		return
+	}
+	signal.Stop(sigquitCh)
+	close(sigquitCh)
+	sigquitCh = nil
+}
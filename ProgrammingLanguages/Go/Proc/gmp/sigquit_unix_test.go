@@ -0,0 +1,44 @@
+//go:build unix
+
+package gmp
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type chanWriter chan string
+
+func (w chanWriter) Write(b []byte) (int, error) {
+	w <- string(b)
+	return len(b), nil
+}
+
+func TestDumpOnSIGQUIT(t *testing.T) {
+	out := make(chanWriter, 1)
+	sigquitOut = out
+	defer func() {
+		uninstallSigquit()
+		sigquitOut = os.Stderr
+	}()
+
+	err := InitWithConfig(Config{Procs: 1, Clock: NewVirtualClock(epoch), DumpOnSIGQUIT: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Go(namedWorker)
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGQUIT)
+	select {
+	case dump := <-out:
+		if !strings.Contains(dump, "go-rem/gmp.namedWorker()") {
+			t.Errorf("SIGQUIT 转储中应该包含 namedWorker:\n%s", dump)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("收到 SIGQUIT 后应该输出转储")
+	}
+	Run()
+}
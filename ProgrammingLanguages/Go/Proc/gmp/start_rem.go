@@ -0,0 +1,139 @@
+package gmp
+
+import (
+	"context"
+	"errors"
+)
+
+// ============ 后台运行 ============
+//
+// Run 在队列清空后返回，适合跑完一段程序。Start 在后台的 goroutine 上启动调度循环，
+// 空闲时调度循环在 sched.wakeup 上等待而不是返回，所以调度器可以像服务进程中的执行器一样
+// 一直接收新的 G：调度器之外调用的 Go 经过注入队列放入全局队列并唤醒空闲的 P（见 extern_rem.go）。
+// Shutdown 停止接收新的 G，等待已经提交的 G 运行完毕后调度循环才返回。
+
+// Start 在后台启动默认实例的调度循环，见 Scheduler.Start
+func Start() error {
+	return defaultSched.Start()
+}
+
+// Shutdown 停止默认实例的后台调度循环，见 Scheduler.Shutdown
+func Shutdown(ctx context.Context) error {
+	return defaultSched.Shutdown(ctx)
+}
+
+// Start 在新的 goroutine 上启动 s 的调度循环并立即返回
+// 之后可以在任何 goroutine 中调用 s.Go 提交 G；所有 M 都空闲时调度循环等待，直到 Shutdown。
+// 启动之后不能再调用 Run 和 Step。调度器已经在运行时返回错误
+func (s *Scheduler) Start() error {
+	var err error
+	s.do(func() {
+		if err = s.check("Start"); err != nil {
+			return
+		}
+		if sched.running {
+			err = errors.New("gmp: Start called while the scheduler is running")
+			return
+		}
+		sched.background = true
+		sched.shutdown = false
+		sched.running = true
+		s.done, s.bgerr = make(chan struct{}), nil
+		s.setextopen(true, false)
+	})
+	if err != nil {
+		return err
+	}
+
+	done := s.done
+	go func() {
+		var err error
+		s.do(func() {
+			err = rune()
+			sched.background = false
+			s.setextopen(false, sched.shutdown)
+		})
+		s.bgerr = err
+		close(done)
+	}()
+	return nil
+}
+
+// Shutdown 停止接收调度器之外提交的 G（之后 Go 以 ErrShutdown 失败），
+// 等待队列中的 G 和正在运行、阻塞的 G 结束，返回调度循环的结果（例如 *DeadlockError）。
+// 已经运行的 G 仍然可以创建新的 G。
+// ctx 结束时丢弃队列中还没有开始运行的 G 并返回 ctx.Err()，已经开始的 G 继续运行，
+// 之后可以再次调用 Shutdown 等待它们。没有 Start 时只停止接收新的 G。
+// 不能在 G 中调用
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	var done chan struct{}
+	s.do(func() {
+		s.setextopen(false, true)
+		sched.lock.Lock()
+		defer sched.lock.Unlock()
+		sched.shutdown = true
+		if sched.background {
+			done = s.done
+			notewakeup()
+		}
+		if ctx.Err() != nil {
+			runqcancel()
+		}
+	})
+	if done == nil {
+		return ctx.Err()
+	}
+
+	select {
+	case <-done:
+		return s.bgerr
+	case <-ctx.Done():
+	}
+	s.do(func() {
+		sched.lock.Lock()
+		runqcancel()
+		sched.lock.Unlock()
+	})
+	return ctx.Err()
+}
+
+// runqcancel 丢弃全局队列和所有 P 的本地队列中还没有开始运行的 G
+// 从系统调用返回或被唤醒的 G 已经开始运行，留在队列中。调用者必须持有 sched.lock
+func runqcancel() {
+	drop := func(gp *g) bool {
+		// 已经开始的 G 有协程，留在队列中继续运行，调度循环结束前会被调度到；
+		// 只丢弃还没有协程的 G，所以这里不会留下 park 着的协程，不需要 gostop
+		if gp.coro != nil {
+			return false
+		}
+		gp.status = _Gdead
+		racegoexit(gp)
+		allgremove(gp)
+		return true
+	}
+
+	runq := sched.runq[:0]
+	for _, gp := range sched.runq {
+		if !drop(gp) {
+			runq = append(runq, gp)
+		}
+	}
+	clear(sched.runq[len(runq):])
+	sched.runq = runq
+
+	for _, pp := range sched.allp {
+		if pp.runnext != nil && drop(pp.runnext) {
+			pp.runnext = nil
+		}
+		// 在环形队列中原地压缩，写的位置不会超过读的位置
+		n := uint32(len(pp.runq))
+		h, t := pp.runqhead, pp.runqtail
+		pp.runqtail = h
+		for i := h; i != t; i++ {
+			if gp := pp.runq[i%n]; !drop(gp) {
+				pp.runq[pp.runqtail%n] = gp
+				pp.runqtail++
+			}
+		}
+	}
+}
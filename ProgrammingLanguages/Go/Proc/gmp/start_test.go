@@ -0,0 +1,114 @@
+package gmp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStartShutdown(t *testing.T) {
+	s := newVirtual(t, 2)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err == nil {
+		t.Error("重复 Start 应该返回错误")
+	}
+	if err := s.RunE(); err == nil {
+		t.Error("Start 之后 Run 应该返回错误")
+	}
+
+	// 调度器空闲之后仍然可以从其他 goroutine 提交 G
+	var mu sync.Mutex
+	n := 0
+	add := func() {
+		mu.Lock()
+		n++
+		mu.Unlock()
+	}
+	for round := 0; round < 5; round++ {
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.Go(func() {
+					add()
+					Go(add)
+				})
+			}()
+		}
+		wg.Wait()
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n != 40 {
+		t.Errorf("n = %d", n)
+	}
+	if si := s.Snapshot(); len(si.Gs) != 0 || si.Running {
+		t.Errorf("Shutdown 之后不应该还有 G: %+v", si)
+	}
+	if err := s.TryGo(func() {}); !errors.Is(err, ErrShutdown) {
+		t.Errorf("Shutdown 之后 TryGo 应该返回 ErrShutdown，实际为 %v", err)
+	}
+}
+
+func TestShutdownWaitsForSyscall(t *testing.T) {
+	s := newVirtual(t, 1)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	done := false
+	s.Go(func() {
+		Syscall(func() { <-release })
+		done = true
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("系统调用没有返回时 Shutdown 应该超时，实际为 %v", err)
+	}
+
+	// 超时之后已经开始的 G 继续运行，再次 Shutdown 等待它
+	close(release)
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !done {
+		t.Error("系统调用中的 G 应该运行完毕")
+	}
+}
+
+func TestShutdownCancel(t *testing.T) {
+	s, err := New(Config{Procs: 1, LocalQueueSize: 2, Clock: NewVirtualClock(epoch)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// runnext、本地队列和全局队列中都有还没有运行的 G
+	n := 0
+	for i := 0; i < 6; i++ {
+		s.Go(func() { n++ })
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Shutdown 应该返回 context.Canceled，实际为 %v", err)
+	}
+	si := s.Snapshot()
+	if len(si.Gs) != 0 || len(si.GlobalRunq) != 0 || len(si.Procs[0].Runq) != 0 || si.Procs[0].Runnext != 0 {
+		t.Errorf("队列中的 G 应该被丢弃: %+v", si)
+	}
+	s.Run()
+	if n != 0 {
+		t.Errorf("被丢弃的 G 不应该运行: n = %d", n)
+	}
+}
@@ -0,0 +1,161 @@
+package gmp
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ============ 单步调度 ============
+//
+// Run 一口气跑完整个调度循环，Step 每次只做一个调度决定：
+// 某个 M 找到一个 G（runnext、本地队列、全局队列、netpoll 或窃取）并运行它，
+// 直到它结束、park、让出或进入系统调用，然后返回描述这次决定的 Event。
+// 调试器、可视化工具和教学演示可以在两次 Step 之间用 Snapshot 观察队列。
+
+// EventKind 是调度事件的类型
+type EventKind int
+
+const (
+	EventRun  EventKind = iota // M 找到一个 G 并运行了它
+	EventStop                  // M 没有找到 G，交还 P 后休眠（对应 stopm）
+	EventIdle                  // 所有 M 都在休眠，等待定时器或系统调用
+	EventDone                  // 没有更多工作，调度循环结束
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventRun:
+		return "run"
+	case EventStop:
+		return "stop"
+	case EventIdle:
+		return "idle"
+	case EventDone:
+		return "done"
+	}
+	return "???"
+}
+
+// Event 描述一次调度决定
+type Event struct {
+	Kind EventKind
+	Time time.Time // 做出决定时的调度器时钟
+	M    int64     // 做出决定的 M，-1 表示没有
+	P    int64     // M 持有的 P，-1 表示没有
+	G    uint64    // 运行的 G，只对 EventRun 有效
+
+	// Source 是 G 的来源："runnext"、"runq"、"global"、"netpoll"、"steal"
+	Source string
+	Victim int64 // Source 为 "steal" 时被窃取的 P，否则为 -1
+	Count  int   // 这次从来源取走的 G 的数量（包括运行的 G）
+
+	// Outcome 是 G 让出 M 的原因："exit"、"park"、"yield"、"syscall"
+	Outcome    string
+	WaitReason string // Outcome 为 "park" 时的等待原因
+
+	// Err 是 EventDone 时检测到的错误（*DeadlockError），没有错误时为 nil
+	Err error
+}
+
+// String 返回可读的描述，例如 "M1/P1: stole 2 from P0, ran G7 until it parked (sleep)"
+func (ev Event) String() string {
+	var b strings.Builder
+	switch ev.Kind {
+	case EventRun:
+		fmt.Fprintf(&b, "M%d/P%d: ", ev.M, ev.P)
+		switch ev.Source {
+		case "runnext":
+			b.WriteString("took runnext, ")
+		case "runq":
+			b.WriteString("took local runq, ")
+		case "global":
+			fmt.Fprintf(&b, "took %d from global runq, ", ev.Count)
+		case "netpoll":
+			fmt.Fprintf(&b, "took %d from netpoll, ", ev.Count)
+		case "steal":
+			fmt.Fprintf(&b, "stole %d from P%d, ", ev.Count, ev.Victim)
+		}
+		fmt.Fprintf(&b, "ran G%d", ev.G)
+		switch ev.Outcome {
+		case "exit":
+			b.WriteString(" until it exited")
+		case "park":
+			fmt.Fprintf(&b, " until it parked (%s)", ev.WaitReason)
+		case "yield":
+			b.WriteString(" until it yielded")
+		case "syscall":
+			b.WriteString(" until it entered a syscall")
+		}
+	case EventStop:
+		fmt.Fprintf(&b, "M%d/P%d: no work, stopm", ev.M, ev.P)
+	case EventIdle:
+		b.WriteString("all Ms idle, waited for timers or syscalls")
+	case EventDone:
+		b.WriteString("done")
+		if ev.Err != nil {
+			fmt.Fprintf(&b, ": %v", ev.Err)
+		}
+	}
+	return b.String()
+}
+
+// findInfo 记录 findrunnable 从哪里找到了 G
+type findInfo struct {
+	src    string
+	victim int64
+	n      int
+}
+
+// Step 做一个调度决定并返回描述它的事件
+// 第一次调用时启动调度循环（与 Run 一样），之后每次调用继续上一次停下的地方。
+// 没有更多工作时返回 EventDone 和 false，此时调度循环结束，可以再次 Go 和 Step。
+// 两次 Step 之间可以调用 Go、Snapshot 等 API，也可以改用 Run/RunE 跑完剩下的部分。
+// 只能在调度器之外调用
+func Step() (ev Event, ok bool) {
+	defaultSched.do(func() { ev, ok = step() })
+	return ev, ok
+}
+
+func step() (Event, bool) {
+	if !initialized {
+		panic(&SchedError{Op: "Step", Err: ErrNotInitialized})
+	}
+	if sched.background {
+		panic("gmp.Step must not be called while the scheduler is started")
+	}
+	sched.lock.Lock()
+	if isuserg(getg()) {
+		sched.lock.Unlock()
+		panic("gmp.Step must not be called from a gmp goroutine")
+	}
+	if !sched.running {
+		schedenter(homem())
+	}
+	var ev Event
+	ok := schedstep(&ev)
+	if !ok {
+		sched.running = false
+	}
+	gohome()
+	sched.lock.Unlock()
+	if !ok && sched.deadlock != nil {
+		// 与 Run 相同，结束阻塞的 G 的协程
+		gostopall()
+	}
+	return ev, ok
+}
+
+// RunUntil 反复调用 Step，直到 pred 对某个事件返回 true 或者没有更多工作
+// 返回最后一个事件，以及 pred 是否得到满足
+func RunUntil(pred func(Event) bool) (Event, bool) {
+	for {
+		ev, ok := Step()
+		if pred(ev) {
+			return ev, true
+		}
+		if !ok {
+			return ev, false
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package gmp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStep(t *testing.T) {
+	initVirtual(t, 1)
+
+	var order []int
+	var g1, g2 uint64
+	Go(func() {
+		g1 = getg().goid
+		order = append(order, 1)
+		Sleep(time.Millisecond)
+		order = append(order, 3)
+	})
+	Go(func() {
+		g2 = getg().goid
+		order = append(order, 2)
+	})
+
+	var events []Event
+	for {
+		ev, ok := Step()
+		events = append(events, ev)
+		if !ok {
+			break
+		}
+		if len(events) > 20 {
+			t.Fatal("Step 没有结束")
+		}
+	}
+
+	// G2 在 runnext 中先运行；G1 运行到 Sleep 时 park；
+	// 定时器在所有 M 空闲时到期，G1 被放入全局队列，再被 M0 取走运行
+	want := []string{
+		fmt.Sprintf("M0/P0: took runnext, ran G%d until it exited", g2),
+		fmt.Sprintf("M0/P0: took local runq, ran G%d until it parked (sleep)", g1),
+		"M0/P0: no work, stopm",
+		"all Ms idle, waited for timers or syscalls",
+		fmt.Sprintf("M0/P0: took 1 from global runq, ran G%d until it exited", g1),
+		"M0/P0: no work, stopm",
+		"done",
+	}
+	if len(events) != len(want) {
+		t.Fatalf("事件数量错误:\n%v", events)
+	}
+	for i, ev := range events {
+		if s := ev.String(); s != want[i] {
+			t.Errorf("第 %d 个事件为 %q，期望 %q", i, s, want[i])
+		}
+	}
+	if order[0] != 2 || order[1] != 1 || order[2] != 3 {
+		t.Errorf("执行顺序错误: %v", order)
+	}
+	if sched.running {
+		t.Error("Step 返回 false 后调度循环应该结束")
+	}
+}
+
+func TestRunUntilSteal(t *testing.T) {
+	initVirtual(t, 2)
+
+	Go(func() {
+		for i := 0; i < 4; i++ {
+			Go(func() {})
+		}
+	})
+
+	ev, ok := RunUntil(func(ev Event) bool { return ev.Source == "steal" })
+	if !ok {
+		t.Fatal("应该发生窃取")
+	}
+	if ev.Kind != EventRun || ev.P != 1 || ev.Victim != 0 || ev.Count < 1 {
+		t.Errorf("窃取事件错误: %+v", ev)
+	}
+	if !strings.Contains(ev.String(), "from P0") {
+		t.Errorf("事件描述错误: %s", ev)
+	}
+
+	// 两次 Step 之间可以观察调度器状态，也可以用 RunE 跑完剩下的部分
+	si := Snapshot()
+	if !si.Running || si.Procs[1].Steals != 1 {
+		t.Errorf("窃取后的快照错误: running=%v P1=%+v", si.Running, si.Procs[1])
+	}
+	if err := RunE(); err != nil {
+		t.Fatal(err)
+	}
+	if n := GetGCount(); n != 0 {
+		t.Errorf("RunE 之后还有 %d 个 G 在队列中", n)
+	}
+}
+
+func TestStepDeadlock(t *testing.T) {
+	initVirtual(t, 1)
+	Go(blockForever)
+
+	ev, ok := RunUntil(func(ev Event) bool { return false })
+	if ok || ev.Kind != EventDone {
+		t.Fatalf("应该以 EventDone 结束: %+v", ev)
+	}
+	if _, isDeadlock := ev.Err.(*DeadlockError); !isDeadlock {
+		t.Errorf("EventDone 应该带有死锁错误: %v", ev.Err)
+	}
+}
@@ -0,0 +1,37 @@
+package gmpsync
+
+import (
+	"go-rem/gmp"
+)
+
+// Cond 是条件变量
+type Cond struct {
+	// L 是观察或修改条件时必须持有的锁
+	L Locker
+
+	notify gmp.NotifyList
+}
+
+// NewCond 创建一个使用 l 的条件变量
+func NewCond(l Locker) *Cond {
+	return &Cond{L: l}
+}
+
+// Wait 释放 c.L 并 park 当前 G，被唤醒后重新获取 c.L 再返回
+// 被唤醒时条件不一定成立，调用者应该在循环中检查条件
+func (c *Cond) Wait() {
+	t := c.notify.Add()
+	c.L.Unlock()
+	c.notify.Wait(t)
+	c.L.Lock()
+}
+
+// Signal 唤醒一个等待的 G
+func (c *Cond) Signal() {
+	c.notify.NotifyOne()
+}
+
+// Broadcast 唤醒所有等待的 G
+func (c *Cond) Broadcast() {
+	c.notify.NotifyAll()
+}
@@ -0,0 +1,173 @@
+// Package gmpsync 为 gmp 调度器上的 Goroutine 提供同步原语
+//
+// 导入方式：
+//
+//	import gmpsync "go-rem/gmp/sync"
+//
+// 实现移植自标准库 sync，阻塞时通过 gmp 的信号量 park 当前 G 而不是自旋，
+// 因此所有阻塞操作只能在 gmp 创建的 Goroutine 中调用
+package gmpsync
+
+import (
+	"sync/atomic"
+	"unsafe"
+
+	"go-rem/gmp"
+)
+
+// Locker 与 sync.Locker 相同
+type Locker interface {
+	Lock()
+	Unlock()
+}
+
+// Mutex 是互斥锁，零值为未加锁状态
+//
+// 与 sync.Mutex 一样有两种模式：
+//
+// 正常模式下等待者按 FIFO 排队，但被唤醒的等待者要和新到达的 G 竞争锁。
+// 新到达的 G 正在 P 上运行，往往会赢，被唤醒的等待者只好重新排到队首。
+// 如果一个等待者超过 1ms（按调度器时钟）没有拿到锁，Mutex 切换到饥饿模式。
+//
+// 饥饿模式下 Unlock 把锁直接交给队首的等待者，并让出当前 G 使它立即运行；
+// 新到达的 G 不会尝试获取锁，而是直接排到队尾。
+// 当拿到锁的等待者是最后一个等待者，或者它等待不到 1ms 时，切换回正常模式。
+type Mutex struct {
+	state int32
+	sema  uint32
+}
+
+const (
+	mutexLocked = 1 << iota // 已加锁
+	mutexWoken
+	mutexStarving
+	mutexWaiterShift = iota
+
+	starvationThresholdNs = 1e6
+)
+
+// Lock 加锁，如果锁已被占用，当前 G park 直到锁可用
+func (m *Mutex) Lock() {
+	gmp.Touch(unsafe.Pointer(m))
+	// 快速路径：直接抢到未加锁的锁
+	if atomic.CompareAndSwapInt32(&m.state, 0, mutexLocked) {
+		gmp.RaceAcquire(unsafe.Pointer(m))
+		return
+	}
+	m.lockSlow()
+	gmp.RaceAcquire(unsafe.Pointer(m))
+}
+
+// TryLock 尝试加锁，返回是否成功
+func (m *Mutex) TryLock() bool {
+	gmp.Touch(unsafe.Pointer(m))
+	old := m.state
+	if old&(mutexLocked|mutexStarving) != 0 {
+		return false
+	}
+	if !atomic.CompareAndSwapInt32(&m.state, old, old|mutexLocked) {
+		return false
+	}
+	gmp.RaceAcquire(unsafe.Pointer(m))
+	return true
+}
+
+func (m *Mutex) lockSlow() {
+	var waitStartTime int64
+	starving := false
+	awoke := false
+	old := m.state
+	for {
+		// 与 sync.Mutex 不同，这里不自旋：G 不能占着 M 空转
+		new := old
+		// 饥饿模式下不尝试获取锁，新到达的 G 必须排队
+		if old&mutexStarving == 0 {
+			new |= mutexLocked
+		}
+		if old&(mutexLocked|mutexStarving) != 0 {
+			new += 1 << mutexWaiterShift
+		}
+		// 当前 G 要把锁切换到饥饿模式
+		// 如果锁已经被释放了就不切换，因为 Unlock 认为饥饿模式下一定有等待者
+		if starving && old&mutexLocked != 0 {
+			new |= mutexStarving
+		}
+		if awoke {
+			// 当前 G 是被唤醒的，重置 woken 标志
+			if new&mutexWoken == 0 {
+				panic("gmpsync: inconsistent mutex state")
+			}
+			new &^= mutexWoken
+		}
+		if atomic.CompareAndSwapInt32(&m.state, old, new) {
+			if old&(mutexLocked|mutexStarving) == 0 {
+				break // 用 CAS 拿到了锁
+			}
+			// 之前等待过的 G 排到队首
+			queueLifo := waitStartTime != 0
+			if waitStartTime == 0 {
+				waitStartTime = nanotime()
+			}
+			gmp.SemacquireMutex(&m.sema, queueLifo)
+			starving = starving || nanotime()-waitStartTime > starvationThresholdNs
+			old = m.state
+			if old&mutexStarving != 0 {
+				// 饥饿模式下锁已经直接交给了当前 G，但 state 还没有更新：
+				// mutexLocked 没有设置，而且当前 G 仍被算作等待者
+				if old&(mutexLocked|mutexWoken) != 0 || old>>mutexWaiterShift == 0 {
+					panic("gmpsync: inconsistent mutex state")
+				}
+				delta := int32(mutexLocked - 1<<mutexWaiterShift)
+				if !starving || old>>mutexWaiterShift == 1 {
+					// 退出饥饿模式
+					delta -= mutexStarving
+				}
+				atomic.AddInt32(&m.state, delta)
+				break
+			}
+			awoke = true
+		} else {
+			old = m.state
+		}
+	}
+}
+
+// Unlock 解锁，对未加锁的 Mutex 解锁会 panic
+func (m *Mutex) Unlock() {
+	gmp.Touch(unsafe.Pointer(m))
+	gmp.RaceRelease(unsafe.Pointer(m))
+	// 快速路径：没有等待者
+	new := atomic.AddInt32(&m.state, -mutexLocked)
+	if new != 0 {
+		m.unlockSlow(new)
+	}
+}
+
+func (m *Mutex) unlockSlow(new int32) {
+	if (new+mutexLocked)&mutexLocked == 0 {
+		panic("gmpsync: unlock of unlocked mutex")
+	}
+	if new&mutexStarving == 0 {
+		old := new
+		for {
+			// 没有等待者，或者已经有 G 被唤醒 / 拿到了锁，不需要唤醒别人
+			if old>>mutexWaiterShift == 0 || old&(mutexLocked|mutexWoken|mutexStarving) != 0 {
+				return
+			}
+			// 唤醒一个等待者
+			new = (old - 1<<mutexWaiterShift) | mutexWoken
+			if atomic.CompareAndSwapInt32(&m.state, old, new) {
+				gmp.Semrelease(&m.sema, false)
+				return
+			}
+			old = m.state
+		}
+	} else {
+		// 饥饿模式：把锁直接交给下一个等待者，并让出 P 使它立即运行
+		gmp.Semrelease(&m.sema, true)
+	}
+}
+
+func nanotime() int64 {
+	return gmp.Now().UnixNano()
+}
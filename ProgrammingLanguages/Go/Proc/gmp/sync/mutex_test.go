@@ -0,0 +1,131 @@
+package gmpsync
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-rem/gmp"
+	"go-rem/gmp/internal/schedtest"
+)
+
+func TestMutexExclusion(t *testing.T) {
+	schedtest.Init(t, 4)
+
+	var mu Mutex
+	inside := false
+	counter := 0
+	for i := 0; i < 20; i++ {
+		gmp.Go(func() {
+			mu.Lock()
+			if inside {
+				t.Error("两个 G 同时持有锁")
+			}
+			inside = true
+			v := counter
+			gmp.Sleep(time.Millisecond) // 持有锁时 park，让其他 G 有机会竞争
+			counter = v + 1
+			inside = false
+			mu.Unlock()
+		})
+	}
+	gmp.Run()
+
+	if counter != 20 {
+		t.Errorf("期望 counter = 20, 实际 %d", counter)
+	}
+	if mu.state != 0 {
+		t.Errorf("所有 G 结束后锁应该处于初始状态, state = %d", mu.state)
+	}
+}
+
+func TestMutexTryLock(t *testing.T) {
+	var mu Mutex
+	if !mu.TryLock() {
+		t.Fatal("未加锁的 Mutex TryLock 应该成功")
+	}
+	if mu.TryLock() {
+		t.Error("已加锁的 Mutex TryLock 应该失败")
+	}
+	mu.Unlock()
+}
+
+func TestMutexUnlockUnlocked(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("解锁未加锁的 Mutex 应该 panic")
+		}
+	}()
+	var mu Mutex
+	mu.Unlock()
+}
+
+// TestMutexStarvation 复现饥饿模式：
+// greedy 反复加锁并在锁内休眠 3ms，解锁后立即重新加锁。
+// 正常模式下被唤醒的 waiter 总是输给正在运行的 greedy，
+// 等待超过 1ms 后 waiter 把锁切换到饥饿模式，下一次 Unlock 直接把锁交给它
+func TestMutexStarvation(t *testing.T) {
+	schedtest.Init(t, 1)
+
+	var mu Mutex
+	const rounds = 10
+	done := 0
+	acquiredAfter := -1
+	sawStarving := false
+
+	gmp.Go(func() {
+		for i := 0; i < rounds; i++ {
+			mu.Lock()
+			gmp.Sleep(3 * time.Millisecond)
+			if atomic.LoadInt32(&mu.state)&mutexStarving != 0 {
+				sawStarving = true
+			}
+			done++
+			mu.Unlock()
+		}
+	})
+	gmp.Go(func() {
+		gmp.Sleep(time.Millisecond)
+		mu.Lock()
+		acquiredAfter = done
+		mu.Unlock()
+	})
+	gmp.Run()
+
+	if !sawStarving {
+		t.Error("waiter 等待超过 1ms 后锁应该进入饥饿模式")
+	}
+	if acquiredAfter < 0 || acquiredAfter >= rounds {
+		t.Errorf("饥饿模式应该让 waiter 在 greedy 结束前拿到锁, 实际在第 %d 轮之后", acquiredAfter)
+	}
+	if mu.state&mutexStarving != 0 {
+		t.Error("最后一个等待者拿到锁后应该退出饥饿模式")
+	}
+	t.Logf("waiter 在 greedy 完成 %d/%d 轮后拿到锁", acquiredAfter, rounds)
+}
+
+func TestMutexRace(t *testing.T) {
+	for _, lock := range []bool{true, false} {
+		schedtest.InitConfig(t, gmp.Config{Procs: 2, Race: true})
+		var mu Mutex
+		var counter gmp.Var[int]
+		for i := 0; i < 3; i++ {
+			gmp.Go(func() {
+				if lock {
+					mu.Lock()
+					defer mu.Unlock()
+				}
+				counter.Store(counter.Load() + 1)
+			})
+		}
+		err := gmp.RunE()
+		if lock && err != nil {
+			t.Errorf("加锁时不应该报告竞争: %v", err)
+		}
+		var re *gmp.RaceError
+		if !lock && !errors.As(err, &re) {
+			t.Errorf("不加锁时应该报告竞争，实际为 %v", err)
+		}
+	}
+}
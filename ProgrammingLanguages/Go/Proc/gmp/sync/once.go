@@ -0,0 +1,35 @@
+package gmpsync
+
+import (
+	"sync/atomic"
+	"unsafe"
+
+	"go-rem/gmp"
+)
+
+// Once 保证函数只执行一次
+type Once struct {
+	done atomic.Uint32
+	m    Mutex
+}
+
+// Do 在第一次调用时执行 f，之后的调用直接返回
+// 同时调用 Do 的其他 G 会 park，直到 f 返回
+func (o *Once) Do(f func()) {
+	gmp.Touch(unsafe.Pointer(o))
+	if o.done.Load() == 0 {
+		o.doSlow(f)
+		return
+	}
+	gmp.RaceAcquire(unsafe.Pointer(o))
+}
+
+func (o *Once) doSlow(f func()) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if o.done.Load() == 0 {
+		defer o.done.Store(1)
+		defer gmp.RaceRelease(unsafe.Pointer(o))
+		f()
+	}
+}
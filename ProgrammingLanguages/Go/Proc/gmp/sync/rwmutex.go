@@ -0,0 +1,121 @@
+package gmpsync
+
+import (
+	"sync/atomic"
+	"unsafe"
+
+	"go-rem/gmp"
+)
+
+// rwmutexMaxReaders 是读者数量的上限
+const rwmutexMaxReaders = 1 << 30
+
+// RWMutex 是读写锁，零值为未加锁状态
+// 有写者在等待时，新的读者会阻塞，避免写者饿死
+type RWMutex struct {
+	w           Mutex        // 写者之间互斥
+	writerSem   uint32       // 写者等待读者完成
+	readerSem   uint32       // 读者等待写者完成
+	readerCount atomic.Int32 // 正在持有读锁的读者数量，有写者时为负
+	readerWait  atomic.Int32 // 写者还需要等待离开的读者数量
+}
+
+// RLock 加读锁
+func (rw *RWMutex) RLock() {
+	gmp.Touch(unsafe.Pointer(rw))
+	if rw.readerCount.Add(1) < 0 {
+		// 有写者持有或在等待写锁
+		gmp.SemacquireRWMutexR(&rw.readerSem, false)
+	}
+	gmp.RaceAcquire(unsafe.Pointer(&rw.readerSem))
+}
+
+// TryRLock 尝试加读锁，返回是否成功
+func (rw *RWMutex) TryRLock() bool {
+	gmp.Touch(unsafe.Pointer(rw))
+	for {
+		c := rw.readerCount.Load()
+		if c < 0 {
+			return false
+		}
+		if rw.readerCount.CompareAndSwap(c, c+1) {
+			gmp.RaceAcquire(unsafe.Pointer(&rw.readerSem))
+			return true
+		}
+	}
+}
+
+// RUnlock 释放读锁
+func (rw *RWMutex) RUnlock() {
+	gmp.Touch(unsafe.Pointer(rw))
+	gmp.RaceReleaseMerge(unsafe.Pointer(&rw.writerSem))
+	if r := rw.readerCount.Add(-1); r < 0 {
+		rw.rUnlockSlow(r)
+	}
+}
+
+func (rw *RWMutex) rUnlockSlow(r int32) {
+	if r+1 == 0 || r+1 == -rwmutexMaxReaders {
+		panic("gmpsync: RUnlock of unlocked RWMutex")
+	}
+	// 有写者在等待，最后一个离开的读者唤醒它
+	if rw.readerWait.Add(-1) == 0 {
+		gmp.Semrelease(&rw.writerSem, false)
+	}
+}
+
+// Lock 加写锁
+func (rw *RWMutex) Lock() {
+	gmp.Touch(unsafe.Pointer(rw))
+	// 先和其他写者竞争
+	rw.w.Lock()
+	// 告诉读者有写者在等待
+	r := rw.readerCount.Add(-rwmutexMaxReaders) + rwmutexMaxReaders
+	// 等待已经持有读锁的读者离开
+	if r != 0 && rw.readerWait.Add(r) != 0 {
+		gmp.SemacquireRWMutex(&rw.writerSem, false)
+	}
+	gmp.RaceAcquire(unsafe.Pointer(&rw.readerSem))
+	gmp.RaceAcquire(unsafe.Pointer(&rw.writerSem))
+}
+
+// TryLock 尝试加写锁，返回是否成功
+func (rw *RWMutex) TryLock() bool {
+	gmp.Touch(unsafe.Pointer(rw))
+	if !rw.w.TryLock() {
+		return false
+	}
+	if !rw.readerCount.CompareAndSwap(0, -rwmutexMaxReaders) {
+		rw.w.Unlock()
+		return false
+	}
+	gmp.RaceAcquire(unsafe.Pointer(&rw.readerSem))
+	gmp.RaceAcquire(unsafe.Pointer(&rw.writerSem))
+	return true
+}
+
+// Unlock 释放写锁
+func (rw *RWMutex) Unlock() {
+	gmp.Touch(unsafe.Pointer(rw))
+	gmp.RaceRelease(unsafe.Pointer(&rw.readerSem))
+	// 告诉读者没有写者了
+	r := rw.readerCount.Add(rwmutexMaxReaders)
+	if r >= rwmutexMaxReaders {
+		panic("gmpsync: Unlock of unlocked RWMutex")
+	}
+	// 唤醒被阻塞的读者
+	for i := 0; i < int(r); i++ {
+		gmp.Semrelease(&rw.readerSem, false)
+	}
+	rw.w.Unlock()
+}
+
+// RLocker 返回一个用 RLock/RUnlock 实现 Locker 的对象
+func (rw *RWMutex) RLocker() Locker {
+	return (*rlocker)(rw)
+}
+
+type rlocker RWMutex
+
+func (r *rlocker) Lock()   { (*RWMutex)(r).RLock() }
+func (r *rlocker) Unlock() { (*RWMutex)(r).RUnlock() }
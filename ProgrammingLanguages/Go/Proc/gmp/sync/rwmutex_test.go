@@ -0,0 +1,95 @@
+package gmpsync
+
+import (
+	"testing"
+	"time"
+
+	"go-rem/gmp"
+	"go-rem/gmp/internal/schedtest"
+)
+
+func TestRWMutexReadersShare(t *testing.T) {
+	schedtest.Init(t, 2)
+
+	var rw RWMutex
+	readers, maxReaders := 0, 0
+	for i := 0; i < 5; i++ {
+		gmp.Go(func() {
+			rw.RLock()
+			readers++
+			if readers > maxReaders {
+				maxReaders = readers
+			}
+			gmp.Sleep(time.Millisecond)
+			readers--
+			rw.RUnlock()
+		})
+	}
+	gmp.Run()
+
+	if maxReaders != 5 {
+		t.Errorf("5 个读者应该同时持有读锁, 实际最多 %d 个", maxReaders)
+	}
+}
+
+func TestRWMutexWriterExcludes(t *testing.T) {
+	schedtest.Init(t, 2)
+
+	var rw RWMutex
+	var events []string
+	gmp.Go(func() {
+		rw.RLock()
+		events = append(events, "r1+")
+		gmp.Sleep(2 * time.Millisecond)
+		events = append(events, "r1-")
+		rw.RUnlock()
+	})
+	gmp.Go(func() {
+		gmp.Sleep(time.Millisecond)
+		rw.Lock()
+		events = append(events, "w+")
+		gmp.Sleep(time.Millisecond)
+		events = append(events, "w-")
+		rw.Unlock()
+	})
+	gmp.Go(func() {
+		// 写者等待时新来的读者必须排在写者后面
+		gmp.Sleep(1500 * time.Microsecond)
+		rw.RLock()
+		events = append(events, "r2+")
+		rw.RUnlock()
+	})
+	gmp.Run()
+
+	want := []string{"r1+", "r1-", "w+", "w-", "r2+"}
+	if len(events) != len(want) {
+		t.Fatalf("期望 %v, 实际 %v", want, events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("期望 %v, 实际 %v", want, events)
+		}
+	}
+}
+
+func TestRWMutexRace(t *testing.T) {
+	schedtest.InitConfig(t, gmp.Config{Procs: 2, Race: true})
+	var rw RWMutex
+	var x gmp.Var[int]
+	for i := 0; i < 4; i++ {
+		gmp.Go(func() {
+			if i%2 == 0 {
+				rw.Lock()
+				x.Store(x.Load() + 1)
+				rw.Unlock()
+			} else {
+				rw.RLock()
+				x.Load()
+				rw.RUnlock()
+			}
+		})
+	}
+	if err := gmp.RunE(); err != nil {
+		t.Error(err)
+	}
+}
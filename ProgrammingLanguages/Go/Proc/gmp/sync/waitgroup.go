@@ -0,0 +1,79 @@
+package gmpsync
+
+import (
+	"sync/atomic"
+	"unsafe"
+
+	"go-rem/gmp"
+)
+
+// WaitGroup 等待一组 Goroutine 结束
+type WaitGroup struct {
+	state atomic.Uint64 // 高 32 位是计数器，低 32 位是等待者数量
+	sema  uint32
+}
+
+// Add 给计数器加上 delta，计数器归零时唤醒所有 Wait 的 G
+func (wg *WaitGroup) Add(delta int) {
+	gmp.Touch(unsafe.Pointer(wg))
+	if delta < 0 {
+		// Done 之前的写 happens-before Wait 返回
+		gmp.RaceReleaseMerge(unsafe.Pointer(wg))
+	}
+	state := wg.state.Add(uint64(delta) << 32)
+	v := int32(state >> 32)
+	w := uint32(state)
+	if v < 0 {
+		panic("gmpsync: negative WaitGroup counter")
+	}
+	if w != 0 && delta > 0 && v == int32(delta) {
+		panic("gmpsync: WaitGroup misuse: Add called concurrently with Wait")
+	}
+	if v > 0 || w == 0 {
+		return
+	}
+	// 计数器归零并且有等待者：重置状态并唤醒所有等待者
+	if wg.state.Load() != state {
+		panic("gmpsync: WaitGroup misuse: Add called concurrently with Wait")
+	}
+	wg.state.Store(0)
+	for ; w != 0; w-- {
+		gmp.Semrelease(&wg.sema, false)
+	}
+}
+
+// Done 将计数器减一
+func (wg *WaitGroup) Done() {
+	wg.Add(-1)
+}
+
+// Go 在一个新的 gmp Goroutine 中调用 f，并把它加入 WaitGroup
+func (wg *WaitGroup) Go(f func()) {
+	wg.Add(1)
+	gmp.Go(func() {
+		defer wg.Done()
+		f()
+	})
+}
+
+// Wait 阻塞直到计数器归零
+func (wg *WaitGroup) Wait() {
+	gmp.Touch(unsafe.Pointer(wg))
+	for {
+		state := wg.state.Load()
+		v := int32(state >> 32)
+		if v == 0 {
+			gmp.RaceAcquire(unsafe.Pointer(wg))
+			return
+		}
+		// 增加等待者数量
+		if wg.state.CompareAndSwap(state, state+1) {
+			gmp.SemacquireWaitGroup(&wg.sema)
+			if wg.state.Load() != 0 {
+				panic("gmpsync: WaitGroup is reused before previous Wait has returned")
+			}
+			gmp.RaceAcquire(unsafe.Pointer(wg))
+			return
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package gmpsync
+
+import (
+	"testing"
+	"time"
+
+	"go-rem/gmp"
+	"go-rem/gmp/internal/schedtest"
+)
+
+func TestWaitGroup(t *testing.T) {
+	schedtest.Init(t, 4)
+
+	var wg WaitGroup
+	finished := 0
+	waited := false
+	for i := 1; i <= 10; i++ {
+		d := time.Duration(i) * time.Millisecond
+		wg.Go(func() {
+			gmp.Sleep(d)
+			finished++
+		})
+	}
+	for i := 0; i < 3; i++ {
+		gmp.Go(func() {
+			wg.Wait()
+			if finished != 10 {
+				t.Errorf("Wait 返回时应该有 10 个 G 结束, 实际 %d", finished)
+			}
+			waited = true
+		})
+	}
+	gmp.Run()
+
+	if !waited {
+		t.Error("Wait 应该返回")
+	}
+}
+
+func TestWaitGroupNegative(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("计数器为负时应该 panic")
+		}
+	}()
+	var wg WaitGroup
+	wg.Done()
+}
+
+func TestOnce(t *testing.T) {
+	schedtest.Init(t, 2)
+
+	var once Once
+	calls := 0
+	after := 0
+	for i := 0; i < 5; i++ {
+		gmp.Go(func() {
+			once.Do(func() {
+				gmp.Sleep(time.Millisecond) // 其他 G 在 Do 中 park
+				calls++
+			})
+			if calls != 1 {
+				t.Error("Do 返回时 f 应该已经执行完")
+			}
+			after++
+		})
+	}
+	gmp.Run()
+
+	if calls != 1 || after != 5 {
+		t.Errorf("f 应该只执行 1 次 (实际 %d), 5 个 G 都应该返回 (实际 %d)", calls, after)
+	}
+}
+
+func TestCond(t *testing.T) {
+	schedtest.Init(t, 2)
+
+	var mu Mutex
+	c := NewCond(&mu)
+	ready := false
+	woken := 0
+	for i := 0; i < 4; i++ {
+		gmp.Go(func() {
+			mu.Lock()
+			for !ready {
+				c.Wait()
+			}
+			woken++
+			mu.Unlock()
+		})
+	}
+	gmp.Go(func() {
+		gmp.Sleep(time.Millisecond)
+		mu.Lock()
+		ready = true
+		mu.Unlock()
+		c.Signal()
+		gmp.Sleep(time.Millisecond)
+		c.Broadcast()
+	})
+	gmp.Run()
+
+	if woken != 4 {
+		t.Errorf("Broadcast 后 4 个 G 都应该被唤醒, 实际 %d", woken)
+	}
+}
+
+func TestWaitGroupRace(t *testing.T) {
+	schedtest.InitConfig(t, gmp.Config{Procs: 2, Race: true})
+	var results [4]gmp.Var[int]
+	var once Once
+	var config gmp.Var[int]
+	gmp.Go(func() {
+		var wg WaitGroup
+		for i := range results {
+			wg.Go(func() {
+				once.Do(func() { config.Store(10) })
+				results[i].Store(config.Load() + i)
+			})
+		}
+		wg.Wait()
+		// Wait 返回之后可以读取所有结果
+		sum := 0
+		for i := range results {
+			sum += results[i].Load()
+		}
+		if sum != 46 {
+			t.Errorf("sum = %d", sum)
+		}
+	})
+	if err := gmp.RunE(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,105 @@
+package gmp
+
+// ============ 系统调用 ============
+//
+// 对应 runtime 的 entersyscall/exitsyscall。进入系统调用的 G 连同它的 M 一起离开调度器，
+// M 的 P 立即交给其他 M（相当于 sysmon 的 retake + handoffp），所以 fn 与其他 G 真正并行运行。
+// G 的协程不能与调度循环同时运行，所以 fn 在 M 自己的 goroutine 上执行（相当于 M 的线程），
+// G 的协程停在 Syscall 中，直到系统调用返回后被重新调度。
+// 返回时 G 放入全局队列，M 进入空闲链表，和 runtime 中 exitsyscall 没能拿到 P 的慢速路径一样。
+
+// Syscall 在系统调用中运行 fn，期间当前 P 可以运行其他 G
+// fn 可以执行任意阻塞操作（文件、网络、time.Sleep 等），但不能调用 gmp 的 API。
+// 只能在 gmp 创建的 Goroutine 中调用
+func Syscall(fn func()) {
+	sched.lock.Lock()
+	gp := getg()
+	if !isuserg(gp) {
+		sched.lock.Unlock()
+		panic("gmp.Syscall must be called from a gmp goroutine")
+	}
+	gp.syscallfn = fn
+	mcall(entersyscall_m)
+	if r := gp.syscallpanic; r != nil {
+		// fn 中的 panic 在 G 上重新抛出
+		gp.syscallpanic = nil
+		panic(r)
+	}
+}
+
+// entersyscall_m 在 g0 上交出 M 的 P，并在 M 的 goroutine 上开始系统调用
+func entersyscall_m(gp *g) {
+	mp := getg().m
+	gp.status = _Gsyscall
+	sched.nsyscall++
+	mp.p.syscalltick++
+	traceGoSysCall(mp.p, mp, gp)
+	handoffp(releasep(mp))
+
+	// M 留在系统调用中继续运行 gp，调度循环离开这个 M
+	setg(gp)
+	setm(nil)
+
+	fn := gp.syscallfn
+	gp.syscallfn = nil
+	s := cursched
+	go func() {
+		defer func() {
+			gp.syscallpanic = recover()
+			exitsyscall(s, mp)
+		}()
+		fn()
+	}()
+}
+
+// handoffp 把系统调用中的 M 交出的 P 交给其他 M
+// 如果 P 上还有工作就立即启动一个 M，否则放入空闲链表
+func handoffp(pp *p) {
+	pidleput(pp)
+	if !runqempty(pp) || len(sched.runq) > 0 {
+		startm(false)
+		return
+	}
+	wakep()
+}
+
+// exitsyscall 在系统调用返回后调用，运行在 mp 自己的 goroutine 上
+// 装入调度器实例 s 后回到 mp 上，G 被放入全局队列，重新被调度时从 Syscall 中的 mcall 返回
+func exitsyscall(s *Scheduler, mp *m) {
+	lockengine(s)
+	prev := sched.curm
+	setm(mp)
+	exitsyscall0()
+	if prev == nil && !sched.running {
+		// 调度循环已经退出，调用者因为 m0 在系统调用中没有回到 m0 上（见 homem），现在回去；
+		// 下一次 Run 从 m0 进入调度循环，schedenter 把它移出空闲链表
+		gohome()
+	} else {
+		setm(prev)
+	}
+	notewakeup()
+	unlockengine()
+}
+
+// exitsyscall0 在系统调用中的 M 上把 G 放回调度器，调用者必须持有 sched.lock
+func exitsyscall0() {
+	gp := getg()
+	mp := gp.m
+	setg(mp.g0)
+	sched.nsyscall--
+	traceGoSysExit(mp, gp)
+	gp.m = nil
+	mp.curg = nil
+	mput(mp)
+	gp.runnableat = nanotime()
+	globrunqput(gp)
+	wakep()
+}
+
+// notewakeup 唤醒在 idlewait 中等待的调度循环
+func notewakeup() {
+	select {
+	case sched.wakeup <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,124 @@
+package gmp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyscallHandsOffP(t *testing.T) {
+	initVirtual(t, 1)
+
+	// 只有一个 P：如果系统调用不交出 P，第二个 G 永远不会运行
+	done := make(chan struct{})
+	var order []string
+	Go(func() {
+		Syscall(func() { <-done })
+		order = append(order, "syscall")
+	})
+	Go(func() {
+		order = append(order, "other")
+		close(done)
+	})
+	Run()
+
+	if strings.Join(order, ",") != "other,syscall" {
+		t.Errorf("执行顺序错误: %v", order)
+	}
+	if sched.nsyscall != 0 {
+		t.Errorf("nsyscall 应该为 0，实际为 %d", sched.nsyscall)
+	}
+}
+
+func TestSyscallIsNotDeadlock(t *testing.T) {
+	initVirtual(t, 2)
+
+	var sema uint32
+	var dump string
+	Go(func() {
+		// 进入系统调用后 P 交给其他 M，这个 G 会立即运行
+		Go(func() { dump = Stack(true) })
+		Syscall(func() { time.Sleep(10 * time.Millisecond) })
+		Semrelease(&sema, false)
+	})
+	Go(func() {
+		Semacquire(&sema)
+	})
+
+	// 所有 M 都空闲时还有 G 在系统调用中，调度器必须等它返回
+	if err := RunE(); err != nil {
+		t.Fatalf("系统调用中的 G 还会唤醒等待者，不是死锁: %v", err)
+	}
+	if !strings.Contains(dump, "[syscall, M") {
+		t.Errorf("转储中应该包含系统调用中的 G:\n%s", dump)
+	}
+}
+
+func TestSyscallOutsideG(t *testing.T) {
+	Init()
+	defer func() {
+		if recover() == nil {
+			t.Error("在 G 之外调用 Syscall 应该 panic")
+		}
+	}()
+	Syscall(func() {})
+}
+
+func TestSyscallPanic(t *testing.T) {
+	initVirtual(t, 1)
+
+	var got any
+	Go(func() {
+		defer func() { got = recover() }()
+		Syscall(func() { panic("boom") })
+		t.Error("Syscall 应该重新抛出 fn 的 panic")
+	})
+	if err := RunE(); err != nil {
+		t.Fatal(err)
+	}
+	if got != "boom" {
+		t.Errorf("G 应该能 recover fn 的 panic，实际为 %v", got)
+	}
+}
+
+func TestSyscallKeepsG(t *testing.T) {
+	initVirtual(t, 1)
+
+	// 系统调用中的 M 仍然运行着它的 G，其他 M 的切换不会影响它
+	done := make(chan struct{})
+	var sysg, other, after, insys *g
+	var sysm *m
+	Go(func() {
+		sched.lock.Lock()
+		sysg = getg()
+		sysm = sysg.m
+		sched.lock.Unlock()
+		Go(func() {
+			sched.lock.Lock()
+			other = getg()
+			ok := sysm.tls == sysg && other.m != sysm
+			sched.lock.Unlock()
+			if !ok {
+				t.Error("系统调用中的 M 应该保留自己的 G")
+			}
+			close(done)
+		})
+		Syscall(func() {
+			<-done
+			// fn 与调度循环并行运行，不在调度器当前的 M 上
+			insys = getg()
+		})
+		sched.lock.Lock()
+		after = getg()
+		sched.lock.Unlock()
+	})
+	if err := RunE(); err != nil {
+		t.Fatal(err)
+	}
+	if other == sysg || after != sysg || insys != nil {
+		t.Errorf("getg() 应该返回各自的 G，系统调用中返回 nil")
+	}
+	if sysm.tls != sysm.g0 {
+		t.Errorf("系统调用返回后 M 应该回到 g0")
+	}
+}
@@ -0,0 +1,207 @@
+package gmp
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// ============ 时钟与定时器 ============
+
+// Clock 是调度器的时间源
+// 所有定时器、Sleep 以及 fakenet 的延迟都以它为准
+type Clock interface {
+	Now() time.Time
+	// Sleep 在所有 M 都空闲、等待下一个定时器时被调度器调用
+	Sleep(d time.Duration)
+}
+
+// realClock 使用真实的墙上时间
+type realClock struct{}
+
+func (realClock) Now() time.Time        { return time.Now() }
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// VirtualClock 是虚拟时钟：时间只在调度器空闲时跳到下一个定时器，
+// 因此依赖时间的测试既确定又不需要真的等待
+type VirtualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewVirtualClock 创建一个从 start 开始的虚拟时钟
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+func (c *VirtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep 不会阻塞，只是把时间向前推进 d
+func (c *VirtualClock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+// Advance 把时间向前推进 d
+func (c *VirtualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d > 0 {
+		c.now = c.now.Add(d)
+	}
+}
+
+// nanotime 返回调度器时钟的当前时间
+func nanotime() time.Time {
+	return sched.clock.Now()
+}
+
+// timer 对应 runtime 的 timer
+// f 在 g0 上调用，调用时持有 sched.lock，因此只能使用 ready 这类持锁版本的函数
+type timer struct {
+	when time.Time
+	seq  uint64 // 同一时刻的定时器按加入顺序触发，保证确定性
+	f    func()
+	idx  int // 在堆中的下标，-1 表示不在堆中
+}
+
+// timerHeap 是按 when 排序的最小堆
+type timerHeap []*timer
+
+func (h timerHeap) Len() int { return len(h) }
+func (h timerHeap) Less(i, j int) bool {
+	if h[i].when.Equal(h[j].when) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].when.Before(h[j].when)
+}
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].idx = i
+	h[j].idx = j
+}
+func (h *timerHeap) Push(x any) {
+	t := x.(*timer)
+	t.idx = len(*h)
+	*h = append(*h, t)
+}
+func (h *timerHeap) Pop() any {
+	old := *h
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	t.idx = -1
+	return t
+}
+
+// addtimer 将 t 加入定时器堆，调用者必须持有 sched.lock
+func addtimer(t *timer) {
+	explorewrite(qTimers)
+	sched.timerseq++
+	t.seq = sched.timerseq
+	heap.Push(&sched.timers, t)
+}
+
+// deltimer 将 t 从定时器堆中移除，返回 t 是否还未触发
+// 调用者必须持有 sched.lock
+func deltimer(t *timer) bool {
+	if t.idx < 0 || t.idx >= len(sched.timers) || sched.timers[t.idx] != t {
+		return false
+	}
+	explorewrite(qTimers)
+	heap.Remove(&sched.timers, t.idx)
+	return true
+}
+
+// checkTimers 触发所有已到期的定时器，调用者必须持有 sched.lock
+func checkTimers() {
+	if len(sched.timers) == 0 {
+		// 与 runtime 一样，没有定时器时不读取时钟
+		return
+	}
+	now := nanotime()
+	for len(sched.timers) > 0 && !sched.timers[0].when.After(now) {
+		explorewrite(qTimers)
+		var t *timer
+		if sched.decide.enabled() {
+			t = dueTimer()
+		} else {
+			t = heap.Pop(&sched.timers).(*timer)
+		}
+		t.f()
+	}
+}
+
+// ============ 导出的时间 API ============
+
+// Now 返回调度器时钟的当前时间
+func Now() time.Time {
+	var t time.Time
+	current().do(func() {
+		sched.lock.Lock()
+		defer sched.lock.Unlock()
+		t = nanotime()
+	})
+	return t
+}
+
+// Since 返回从 t 到调度器当前时间经过的时长
+func Since(t time.Time) time.Duration {
+	return Now().Sub(t)
+}
+
+// Sleep 让当前 G 休眠 d，期间 M 可以去运行其他 G
+// 只能在 gmp 创建的 Goroutine 中调用
+func Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	sched.lock.Lock()
+	gp := getg()
+	if !isuserg(gp) {
+		sched.lock.Unlock()
+		panic("gmp.Sleep must be called from a gmp goroutine")
+	}
+	addtimer(&timer{
+		when: nanotime().Add(d),
+		f:    func() { ready(gp) },
+	})
+	gopark(waitReasonSleep)
+}
+
+// Timer 是 AfterFunc 返回的定时器
+type Timer struct {
+	t *timer
+	s *Scheduler // 定时器所在的实例
+}
+
+// AfterFunc 在 d 之后创建一个新的 Goroutine 运行 f，类似 time.AfterFunc
+func AfterFunc(d time.Duration, f func()) *Timer {
+	pc := callerpc()
+	tm := &Timer{s: current()}
+	tm.s.do(func() {
+		sched.lock.Lock()
+		defer sched.lock.Unlock()
+		callergp := getg()
+		tm.t = &timer{
+			when: nanotime().Add(d),
+			f:    func() { newproc1(f, callergp, pc) },
+		}
+		addtimer(tm.t)
+	})
+	return tm
+}
+
+// Stop 取消定时器，如果定时器在触发前被取消返回 true
+func (t *Timer) Stop() bool {
+	var ok bool
+	t.s.do(func() {
+		sched.lock.Lock()
+		defer sched.lock.Unlock()
+		ok = deltimer(t.t)
+	})
+	return ok
+}
@@ -0,0 +1,114 @@
+package gmp
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// initVirtual 用虚拟时钟重新初始化调度器
+func initVirtual(t *testing.T, procs int) *VirtualClock {
+	t.Helper()
+	clk := NewVirtualClock(epoch)
+	if err := InitWithConfig(Config{Procs: procs, Clock: clk}); err != nil {
+		t.Fatal(err)
+	}
+	return clk
+}
+
+func TestSleepVirtualClock(t *testing.T) {
+	initVirtual(t, 1)
+
+	var order []int
+	for i, d := range []time.Duration{30, 10, 20} {
+		id, d := i, d*time.Millisecond
+		Go(func() {
+			Sleep(d)
+			order = append(order, id)
+		})
+	}
+	Run()
+
+	want := []int{1, 2, 0}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("唤醒顺序应该是 %v, 实际 %v", want, order)
+		}
+	}
+	if got := Now().Sub(epoch); got != 30*time.Millisecond {
+		t.Errorf("虚拟时间应该推进 30ms, 实际 %v", got)
+	}
+}
+
+func TestSleepDoesNotBlockM(t *testing.T) {
+	initVirtual(t, 1)
+
+	var order []string
+	Go(func() {
+		Sleep(time.Second)
+		order = append(order, "sleeper")
+	})
+	Go(func() {
+		order = append(order, "worker")
+	})
+	Run()
+
+	if len(order) != 2 || order[0] != "worker" {
+		t.Errorf("休眠的 G 不应该占用 M, 执行顺序 %v", order)
+	}
+}
+
+func TestAfterFunc(t *testing.T) {
+	initVirtual(t, 1)
+
+	fired := time.Time{}
+	stopped := false
+	Go(func() {
+		AfterFunc(5*time.Millisecond, func() {
+			fired = Now()
+		})
+		t2 := AfterFunc(time.Millisecond, func() {
+			stopped = true
+		})
+		if !t2.Stop() {
+			t.Error("未触发的定时器 Stop 应该返回 true")
+		}
+	})
+	Run()
+
+	if stopped {
+		t.Error("被 Stop 的定时器不应该触发")
+	}
+	if fired.Sub(epoch) != 5*time.Millisecond {
+		t.Errorf("AfterFunc 应该在 5ms 触发, 实际 %v", fired.Sub(epoch))
+	}
+}
+
+func TestSleepOutsideG(t *testing.T) {
+	initVirtual(t, 1)
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("在 G 之外调用 Sleep 应该 panic")
+		}
+	}()
+	Sleep(time.Millisecond)
+}
+
+func TestParkedGsRunOnOtherPs(t *testing.T) {
+	initVirtual(t, 4)
+
+	ps := make(map[int64]bool)
+	for i := 0; i < 16; i++ {
+		Go(func() {
+			Sleep(time.Millisecond)
+			ps[getg().m.p.id] = true
+		})
+	}
+	Run()
+
+	if len(ps) < 2 {
+		t.Errorf("被唤醒的 G 应该分散到多个 P 上运行, 实际只用到 %d 个", len(ps))
+	}
+}
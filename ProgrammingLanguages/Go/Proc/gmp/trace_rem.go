@@ -0,0 +1,406 @@
+package gmp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// ============ 执行追踪 ============
+//
+// 对应 runtime/trace：调度器在关键位置记录事件，每个 P 有自己的缓冲区，
+// 没有 P 的事件（例如空闲时触发的定时器、系统调用返回）记录在全局缓冲区中。
+// StopTrace 把所有事件按发生顺序合并，输出 Chrome Trace Event 格式的 JSON，
+// 可以直接用 Perfetto 或 chrome://tracing 打开，每个 P 一条轨道。
+
+// traceEv 是事件类型
+type traceEv uint8
+
+const (
+	traceEvGoCreate     traceEv = iota // 创建 G [新 G 的 goid, 创建者的 goid]
+	traceEvGoStart                     // G 开始在 P 上运行
+	traceEvGoEnd                       // G 结束
+	traceEvGoPark                      // G park [等待原因]
+	traceEvGoSched                     // G 让出 P（goyield）
+	traceEvGoUnpark                    // G 被唤醒
+	traceEvProcStart                   // M 获得 P
+	traceEvProcStop                    // M 交还 P
+	traceEvSteal                       // 工作窃取 [被窃取的 P, 窃取的 G 数量]
+	traceEvGlobalGet                   // 从全局队列获取 [G 的数量]
+	traceEvSyscallEnter                // G 进入系统调用
+	traceEvSyscallExit                 // G 从系统调用返回
+	traceEvSTWStart                    // Stop-the-world 开始 [原因]
+	traceEvSTWDone                     // Stop-the-world 结束
+)
+
+var traceEvNames = [...]string{
+	traceEvGoCreate:     "GoCreate",
+	traceEvGoStart:      "GoStart",
+	traceEvGoEnd:        "GoEnd",
+	traceEvGoPark:       "GoPark",
+	traceEvGoSched:      "GoSched",
+	traceEvGoUnpark:     "GoUnpark",
+	traceEvProcStart:    "ProcStart",
+	traceEvProcStop:     "ProcStop",
+	traceEvSteal:        "Steal",
+	traceEvGlobalGet:    "GlobalGet",
+	traceEvSyscallEnter: "SyscallEnter",
+	traceEvSyscallExit:  "SyscallExit",
+	traceEvSTWStart:     "STWStart",
+	traceEvSTWDone:      "STWDone",
+}
+
+func (ev traceEv) String() string {
+	if int(ev) < len(traceEvNames) {
+		return traceEvNames[ev]
+	}
+	return "unknown event"
+}
+
+// traceEvent 是一条追踪事件
+type traceEvent struct {
+	ev   traceEv
+	seq  uint64 // 全局递增的序号，用于合并各个 P 的缓冲区
+	ts   int64  // 相对追踪开始的纳秒数
+	goid uint64 // 0 表示与 G 无关
+	p    int64  // -1 表示没有 P
+	m    int64  // -1 表示没有 M
+	args [2]int64
+	str  string // 函数名、等待原因等
+}
+
+// traceState 是执行追踪的全局状态，由 sched.lock 保护
+type traceState struct {
+	enabled bool
+	w       io.Writer
+	start   time.Time
+	seq     uint64
+	lastts  int64
+	buf     []traceEvent // 没有 P 时产生的事件
+}
+
+// StartTrace 开始记录执行追踪，StopTrace 时把结果写入 w
+func StartTrace(w io.Writer) error {
+	return current().StartTrace(w)
+}
+
+// StopTrace 停止记录并把追踪写入 StartTrace 的 w
+func StopTrace() error {
+	return current().StopTrace()
+}
+
+// StartTrace 开始记录 s 的执行追踪，s.StopTrace 时把结果写入 w
+func (s *Scheduler) StartTrace(w io.Writer) error {
+	var err error
+	s.do(func() { err = starttrace(w) })
+	return err
+}
+
+// StopTrace 停止记录 s 的执行追踪并把结果写入 s.StartTrace 的 w
+// 写入在释放调度器之后进行，w 很慢时不会挡住其他实例
+func (s *Scheduler) StopTrace() error {
+	var (
+		tr     traceState
+		events []traceEvent
+		nprocs int
+		err    error
+	)
+	s.do(func() { tr, events, nprocs, err = stoptrace() })
+	if err != nil {
+		return err
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].seq < events[j].seq })
+	return writeChromeTrace(tr.w, events, nprocs)
+}
+
+func starttrace(w io.Writer) error {
+	sched.lock.Lock()
+	defer sched.lock.Unlock()
+	if !initialized {
+		return errors.New("gmp: StartTrace called before Init")
+	}
+	if sched.trace.enabled {
+		return errors.New("gmp: tracing is already enabled")
+	}
+	sched.trace = traceState{
+		enabled: true,
+		w:       w,
+		start:   nanotime(),
+	}
+	for _, pp := range sched.allp {
+		pp.tracebuf = nil
+	}
+
+	// 记录追踪开始时的状态：正在运行的 P 和 G
+	for _, pp := range sched.allp {
+		if pp.m == nil {
+			continue
+		}
+		traceProcStart(pp, pp.m)
+		if gp := pp.m.curg; isuserg(gp) && gp.status == _Grunning {
+			traceGoStart(pp, pp.m, gp)
+		}
+	}
+	return nil
+}
+
+// stoptrace 结束追踪，返回追踪状态和收集到的全部事件
+func stoptrace() (traceState, []traceEvent, int, error) {
+	sched.lock.Lock()
+	defer sched.lock.Unlock()
+	if !sched.trace.enabled {
+		return traceState{}, nil, 0, errors.New("gmp: tracing is not enabled")
+	}
+	tr := sched.trace
+	sched.trace = traceState{}
+	events := tr.buf
+	for _, pp := range sched.allp {
+		events = append(events, pp.tracebuf...)
+		pp.tracebuf = nil
+	}
+	return tr, events, len(sched.allp), nil
+}
+
+// traceEmit 记录一个事件，调用者必须持有 sched.lock
+func traceEmit(ev traceEv, pp *p, mp *m, gp *g, arg0, arg1 int64, str string) {
+	tr := &sched.trace
+	// 虚拟时钟下很多事件发生在同一时刻，每个事件至少向后推进 1ns，
+	// 使它们在时间轴上按发生顺序排开
+	ts := int64(nanotime().Sub(tr.start))
+	if ts <= tr.lastts && tr.seq > 0 {
+		ts = tr.lastts + 1
+	}
+	tr.lastts = ts
+	tr.seq++
+
+	e := traceEvent{ev: ev, seq: tr.seq, ts: ts, p: -1, m: -1, args: [2]int64{arg0, arg1}, str: str}
+	if gp != nil {
+		e.goid = gp.goid
+	}
+	if mp != nil {
+		e.m = mp.id
+	}
+	if pp != nil {
+		e.p = pp.id
+		pp.tracebuf = append(pp.tracebuf, e)
+	} else {
+		tr.buf = append(tr.buf, e)
+	}
+}
+
+// 以下函数在追踪关闭时什么都不做，调用者必须持有 sched.lock
+
+func traceGoCreate(pp *p, mp *m, newg, callergp *g) {
+	if sched.trace.enabled {
+		var parent int64
+		if isuserg(callergp) {
+			parent = int64(callergp.goid)
+		}
+		traceEmit(traceEvGoCreate, pp, mp, newg, int64(newg.goid), parent, "")
+	}
+}
+
+func traceGoStart(pp *p, mp *m, gp *g) {
+	if sched.trace.enabled {
+		name, _, _ := funcInfo(gp.fn)
+		traceEmit(traceEvGoStart, pp, mp, gp, 0, 0, name)
+	}
+}
+
+func traceGoEnd(pp *p, mp *m, gp *g) {
+	if sched.trace.enabled {
+		traceEmit(traceEvGoEnd, pp, mp, gp, 0, 0, "")
+	}
+}
+
+func traceGoPark(pp *p, mp *m, gp *g, reason waitReason) {
+	if sched.trace.enabled {
+		traceEmit(traceEvGoPark, pp, mp, gp, 0, 0, reason.String())
+	}
+}
+
+func traceGoSched(pp *p, mp *m, gp *g) {
+	if sched.trace.enabled {
+		traceEmit(traceEvGoSched, pp, mp, gp, 0, 0, "")
+	}
+}
+
+func traceGoUnpark(pp *p, mp *m, gp *g) {
+	if sched.trace.enabled {
+		traceEmit(traceEvGoUnpark, pp, mp, gp, 0, 0, "")
+	}
+}
+
+func traceProcStart(pp *p, mp *m) {
+	if sched.trace.enabled {
+		traceEmit(traceEvProcStart, pp, mp, nil, 0, 0, "")
+	}
+}
+
+func traceProcStop(pp *p, mp *m) {
+	if sched.trace.enabled {
+		traceEmit(traceEvProcStop, pp, mp, nil, 0, 0, "")
+	}
+}
+
+func traceSteal(pp, victim *p, n uint32) {
+	if sched.trace.enabled {
+		traceEmit(traceEvSteal, pp, pp.m, nil, victim.id, int64(n), "")
+	}
+}
+
+func traceGlobalGet(pp *p, n int32) {
+	if sched.trace.enabled {
+		traceEmit(traceEvGlobalGet, pp, pp.m, nil, int64(n), 0, "")
+	}
+}
+
+func traceGoSysCall(pp *p, mp *m, gp *g) {
+	if sched.trace.enabled {
+		traceEmit(traceEvSyscallEnter, pp, mp, gp, 0, 0, "")
+	}
+}
+
+func traceGoSysExit(mp *m, gp *g) {
+	if sched.trace.enabled {
+		traceEmit(traceEvSyscallExit, nil, mp, gp, 0, 0, "")
+	}
+}
+
+func traceSTWStart(reason string) {
+	if sched.trace.enabled {
+		traceEmit(traceEvSTWStart, nil, nil, nil, 0, 0, reason)
+	}
+}
+
+func traceSTWDone() {
+	if sched.trace.enabled {
+		traceEmit(traceEvSTWDone, nil, nil, nil, 0, 0, "")
+	}
+}
+
+// ============ Chrome Trace Event 格式 ============
+
+// chromeEvent 是 Chrome Trace Event 格式中的一个事件
+type chromeEvent struct {
+	Name string         `json:"name"`
+	Ph   string         `json:"ph"`
+	Ts   float64        `json:"ts"` // 微秒
+	Pid  int            `json:"pid"`
+	Tid  int64          `json:"tid"`
+	S    string         `json:"s,omitempty"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+// 轨道：tid 0 是调度器（没有 P 的事件），P n 的轨道是 tid n+1
+const traceSchedTid = 0
+
+func traceTid(pid int64) int64 {
+	if pid < 0 {
+		return traceSchedTid
+	}
+	return pid + 1
+}
+
+// writeChromeTrace 把事件转换成 Chrome Trace Event JSON：
+// P 被 M 持有的时间段和 G 在 P 上运行的时间段是嵌套的切片，其他事件是瞬时事件
+func writeChromeTrace(w io.Writer, events []traceEvent, nprocs int) error {
+	out := []chromeEvent{
+		{Name: "process_name", Ph: "M", Args: map[string]any{"name": "gmp"}},
+		{Name: "thread_name", Ph: "M", Tid: traceSchedTid, Args: map[string]any{"name": "Sched"}},
+	}
+	for i := 0; i < nprocs; i++ {
+		out = append(out, chromeEvent{
+			Name: "thread_name", Ph: "M", Tid: traceTid(int64(i)),
+			Args: map[string]any{"name": fmt.Sprintf("P%d", i)},
+		})
+	}
+
+	// 每条轨道上未结束的切片，追踪结束时统一关闭
+	open := make(map[int64]int)
+	var last float64
+	for _, e := range events {
+		ce := chromeEvent{
+			Name: e.ev.String(),
+			Ts:   float64(e.ts) / 1e3,
+			Tid:  traceTid(e.p),
+			Args: map[string]any{},
+		}
+		last = ce.Ts
+		if e.goid != 0 {
+			ce.Args["g"] = e.goid
+		}
+		if e.m >= 0 {
+			ce.Args["m"] = e.m
+		}
+
+		switch e.ev {
+		case traceEvProcStart:
+			ce.Name = fmt.Sprintf("M%d", e.m)
+			ce.Ph = "B"
+			open[ce.Tid]++
+		case traceEvGoStart:
+			ce.Name = fmt.Sprintf("G%d %s", e.goid, e.str)
+			ce.Ph = "B"
+			open[ce.Tid]++
+		case traceEvProcStop, traceEvGoEnd, traceEvGoPark, traceEvGoSched, traceEvSyscallEnter:
+			if open[ce.Tid] == 0 {
+				// 对应的开始事件在追踪开始之前
+				break
+			}
+			end := ce
+			end.Name, end.Ph, end.Args = "", "E", nil
+			out = append(out, end)
+			open[ce.Tid]--
+			if e.ev == traceEvProcStop {
+				continue
+			}
+			ce.Ph, ce.S = "i", "t"
+		default:
+			ce.Ph, ce.S = "i", "t"
+		}
+
+		switch e.ev {
+		case traceEvGoCreate:
+			ce.Args["newg"] = e.args[0]
+			if e.args[1] != 0 {
+				ce.Args["parent"] = e.args[1]
+			}
+		case traceEvGoPark:
+			ce.Args["reason"] = e.str
+		case traceEvSteal:
+			ce.Args["victim"] = fmt.Sprintf("P%d", e.args[0])
+			ce.Args["count"] = e.args[1]
+		case traceEvGlobalGet:
+			ce.Args["count"] = e.args[0]
+		case traceEvSTWStart:
+			ce.Args["reason"] = e.str
+		}
+		out = append(out, ce)
+	}
+
+	tids := make([]int64, 0, len(open))
+	for tid := range open {
+		tids = append(tids, tid)
+	}
+	sort.Slice(tids, func(i, j int) bool { return tids[i] < tids[j] })
+	for _, tid := range tids {
+		for ; open[tid] > 0; open[tid]-- {
+			out = append(out, chromeEvent{Ph: "E", Ts: last, Tid: tid})
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(struct {
+		TraceEvents     []chromeEvent `json:"traceEvents"`
+		DisplayTimeUnit string        `json:"displayTimeUnit"`
+	}{out, "ns"}); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,173 @@
+package gmp
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type traceFile struct {
+	TraceEvents []chromeEvent `json:"traceEvents"`
+}
+
+func TestTrace(t *testing.T) {
+	initVirtual(t, 2)
+
+	var buf bytes.Buffer
+	if err := StartTrace(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := StartTrace(&buf); err == nil {
+		t.Error("重复调用 StartTrace 应该返回错误")
+	}
+
+	var sema uint32
+	for i := 0; i < 8; i++ {
+		Go(func() { Sleep(time.Millisecond) })
+	}
+	Go(func() { Semacquire(&sema) })
+	Go(func() {
+		Syscall(func() {})
+		Semrelease(&sema, false)
+	})
+	Run()
+
+	if err := StopTrace(); err != nil {
+		t.Fatal(err)
+	}
+	if err := StopTrace(); err == nil {
+		t.Error("没有开始追踪时 StopTrace 应该返回错误")
+	}
+
+	var tf traceFile
+	if err := json.Unmarshal(buf.Bytes(), &tf); err != nil {
+		t.Fatalf("输出不是合法的 JSON: %v\n%s", err, buf.String())
+	}
+
+	names := make(map[string]int)
+	tracks := make(map[string]bool)
+	depth := make(map[int64]int)
+	var last float64
+	for _, e := range tf.TraceEvents {
+		switch e.Ph {
+		case "M":
+			if e.Name == "thread_name" {
+				tracks[e.Args["name"].(string)] = true
+			}
+			continue
+		case "B":
+			depth[e.Tid]++
+			if strings.HasPrefix(e.Name, "G") {
+				names["GoStart"]++
+			}
+		case "E":
+			depth[e.Tid]--
+			if depth[e.Tid] < 0 {
+				t.Fatalf("轨道 %d 上的切片没有配对", e.Tid)
+			}
+		default:
+			names[e.Name]++
+		}
+		if e.Ts < last {
+			t.Fatalf("事件没有按时间排序: %v < %v", e.Ts, last)
+		}
+		last = e.Ts
+	}
+
+	for _, track := range []string{"Sched", "P0", "P1"} {
+		if !tracks[track] {
+			t.Errorf("缺少轨道 %s", track)
+		}
+	}
+	for tid, d := range depth {
+		if d != 0 {
+			t.Errorf("轨道 %d 上有 %d 个切片没有结束", tid, d)
+		}
+	}
+	for _, ev := range []string{
+		"GoCreate", "GoStart", "GoEnd", "GoPark", "GoUnpark",
+		"Steal", "GlobalGet", "SyscallEnter", "SyscallExit",
+	} {
+		if names[ev] == 0 {
+			t.Errorf("缺少 %s 事件", ev)
+		}
+	}
+	if names["GoCreate"] != 10 || names["GoStart"] < 10 || names["GoEnd"] != 10 {
+		t.Errorf("事件数量错误: %v", names)
+	}
+}
+
+func TestTraceFromG(t *testing.T) {
+	initVirtual(t, 1)
+
+	var buf bytes.Buffer
+	Go(func() {
+		StartTrace(&buf)
+		Go(func() {})
+		Sleep(time.Millisecond)
+		Snapshot()
+		StopTrace()
+	})
+	Run()
+
+	var tf traceFile
+	if err := json.Unmarshal(buf.Bytes(), &tf); err != nil {
+		t.Fatal(err)
+	}
+	// 追踪开始时正在运行的 G 也要有自己的切片
+	var b, e, stw int
+	for _, ev := range tf.TraceEvents {
+		switch ev.Ph {
+		case "B":
+			b++
+		case "E":
+			e++
+		}
+		if ev.Name == "STWStart" || ev.Name == "STWDone" {
+			stw++
+		}
+	}
+	if stw != 2 {
+		t.Errorf("Snapshot 应该记录 STWStart 和 STWDone，实际有 %d 个 STW 事件", stw)
+	}
+	if b == 0 || b != e {
+		t.Errorf("切片没有配对: %d 个开始，%d 个结束", b, e)
+	}
+}
+
+func TestTraceInstance(t *testing.T) {
+	initVirtual(t, 1)
+	s := newVirtual(t, 2)
+
+	// 追踪 s 不影响默认实例
+	var buf bytes.Buffer
+	if err := s.StartTrace(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := StopTrace(); err == nil {
+		t.Error("默认实例没有开始追踪，StopTrace 应该返回错误")
+	}
+	s.Go(func() { Sleep(time.Millisecond) })
+	if err := s.RunE(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StopTrace(); err != nil {
+		t.Fatal(err)
+	}
+
+	var tf traceFile
+	if err := json.Unmarshal(buf.Bytes(), &tf); err != nil {
+		t.Fatal(err)
+	}
+	created := false
+	for _, ev := range tf.TraceEvents {
+		if ev.Name == "GoCreate" {
+			created = true
+		}
+	}
+	if !created {
+		t.Error("s 的追踪中应该有 GoCreate 事件")
+	}
+}
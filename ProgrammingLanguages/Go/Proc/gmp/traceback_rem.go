@@ -0,0 +1,199 @@
+package gmp
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// ============ Goroutine 列表与转储 ============
+
+// allgadd 记录一个新创建的 G，调用者必须持有 sched.lock
+func allgadd(gp *g) {
+	gp.allgsidx = len(sched.allgs)
+	sched.allgs = append(sched.allgs, gp)
+}
+
+// allgremove 移除一个已经结束的 G，调用者必须持有 sched.lock
+func allgremove(gp *g) {
+	i := gp.allgsidx
+	if i >= len(sched.allgs) || sched.allgs[i] != gp {
+		return
+	}
+	last := sched.allgs[len(sched.allgs)-1]
+	sched.allgs[i] = last
+	last.allgsidx = i
+	sched.allgs[len(sched.allgs)-1] = nil
+	sched.allgs = sched.allgs[:len(sched.allgs)-1]
+}
+
+// callerpc 返回调用 gmp 入口函数（Go、AfterFunc 等）的位置
+func callerpc() uintptr {
+	var pcs [16]uintptr
+	n := runtime.Callers(2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		if !isentryfunc(f.Function) {
+			// 与 runtime 的 gopc 一样保存返回地址，输出时再减一
+			return f.PC + 1
+		}
+		if !more {
+			return 0
+		}
+	}
+}
+
+// isentryfunc 报告 name 是否是创建 G 的 gmp 内部函数
+func isentryfunc(name string) bool {
+	switch name {
+	case "go-rem/gmp.newproc", "go-rem/gmp.newproc1",
+		"go-rem/gmp.Go", "go-rem/gmp.GoContext", "go-rem/gmp.AfterFunc",
+		"go-rem/gmp.TryGo", "go-rem/gmp.(*Scheduler).Go", "go-rem/gmp.(*Scheduler).TryGo",
+		"go-rem/gmp.GoBatch", "go-rem/gmp.(*Scheduler).GoBatch":
+		return true
+	}
+	return false
+}
+
+// gstatusString 返回转储中显示的状态
+func gstatusString(gp *g) string {
+	switch gp.status {
+	case _Gidle:
+		return "idle"
+	case _Grunnable:
+		return "runnable"
+	case _Grunning:
+		return "running"
+	case _Gwaiting:
+		return gp.waitreason.String()
+	case _Gdead:
+		return "dead"
+	case _Gsyscall:
+		return "syscall"
+	}
+	return "???"
+}
+
+// glocations 找出每个可运行的 G 在哪个队列中，调用者必须持有 sched.lock
+func glocations() map[*g]string {
+	loc := make(map[*g]string)
+	for _, pp := range sched.allp {
+		if pp.runnext != nil {
+			loc[pp.runnext] = fmt.Sprintf("P%d runnext", pp.id)
+		}
+		for i := pp.runqhead; i != pp.runqtail; i++ {
+			loc[pp.runq[i%uint32(len(pp.runq))]] = fmt.Sprintf("P%d runq", pp.id)
+		}
+	}
+	for _, gp := range sched.runq {
+		loc[gp] = "global runq"
+	}
+	for _, gp := range sched.netpollq {
+		loc[gp] = "netpoll"
+	}
+	return loc
+}
+
+// funcInfo 返回 fn 的函数名和定义位置
+func funcInfo(fn func()) (name, file string, line int) {
+	if fn == nil {
+		return "???", "?", 0
+	}
+	pc := reflect.ValueOf(fn).Pointer()
+	f := runtime.FuncForPC(pc)
+	if f == nil {
+		return "???", "?", 0
+	}
+	file, line = f.FileLine(f.Entry())
+	return f.Name(), file, line
+}
+
+// goroutineheader 输出 G 的头部，格式与 runtime 一致，并附带位置信息：
+//
+//	goroutine 7 [sync.Mutex.Lock, 2ms]:
+//	goroutine 8 [running, M1, P1]:
+//	goroutine 9 [runnable, P0 runq]:
+func goroutineheader(b *strings.Builder, gp *g, loc map[*g]string) {
+	fmt.Fprintf(b, "goroutine %d [%s", gp.goid, gstatusString(gp))
+	switch {
+	case gp.status == _Gwaiting:
+		if l, ok := loc[gp]; ok {
+			// 已经被网络轮询器唤醒，等待 findrunnable 取走
+			fmt.Fprintf(b, ", %s", l)
+		} else if !gp.waitsince.IsZero() {
+			fmt.Fprintf(b, ", %v", nanotime().Sub(gp.waitsince))
+		}
+	case (gp.status == _Grunning || gp.status == _Gsyscall) && gp.m != nil:
+		fmt.Fprintf(b, ", M%d", gp.m.id)
+		if gp.m.p != nil {
+			fmt.Fprintf(b, ", P%d", gp.m.p.id)
+		}
+	case gp.status == _Grunnable:
+		if l, ok := loc[gp]; ok {
+			fmt.Fprintf(b, ", %s", l)
+		}
+	}
+	b.WriteString("]:\n")
+}
+
+// traceback1 输出一个 G：头部、入口函数以及创建位置
+func traceback1(b *strings.Builder, gp *g, loc map[*g]string) {
+	goroutineheader(b, gp, loc)
+	name, file, line := funcInfo(gp.fn)
+	fmt.Fprintf(b, "%s()\n\t%s:%d\n", name, file, line)
+	printcreatedby(b, gp)
+}
+
+// printcreatedby 输出 "created by ..." 一行
+func printcreatedby(b *strings.Builder, gp *g) {
+	if gp.gopc == 0 {
+		return
+	}
+	frames := runtime.CallersFrames([]uintptr{gp.gopc})
+	f, _ := frames.Next()
+	fmt.Fprintf(b, "created by %s", f.Function)
+	if gp.parentGoid != 0 {
+		fmt.Fprintf(b, " in goroutine %d", gp.parentGoid)
+	}
+	fmt.Fprintf(b, "\n\t%s:%d\n", f.File, f.Line)
+}
+
+// tracebackothers 输出 me 之外的所有 G，按 goid 排序
+// 调用者必须持有 sched.lock
+func tracebackothers(b *strings.Builder, me *g) {
+	loc := glocations()
+	gs := make([]*g, 0, len(sched.allgs))
+	for _, gp := range sched.allgs {
+		if gp != me {
+			gs = append(gs, gp)
+		}
+	}
+	sort.Slice(gs, func(i, j int) bool { return gs[i].goid < gs[j].goid })
+	for _, gp := range gs {
+		b.WriteString("\n")
+		traceback1(b, gp, loc)
+	}
+}
+
+// Stack 返回类似 runtime.Stack 的 Goroutine 转储
+// 在 gmp 的 G 中调用时先输出当前 G；all 为 true 时再输出其他所有 G。
+// 在 G 中调用时转储运行它的实例，否则转储默认实例
+func Stack(all bool) string {
+	var b strings.Builder
+	current().do(func() {
+		sched.lock.Lock()
+		defer sched.lock.Unlock()
+		me := getg()
+
+		if isuserg(me) {
+			traceback1(&b, me, nil)
+		}
+		if all {
+			tracebackothers(&b, me)
+		}
+	})
+	return strings.TrimPrefix(b.String(), "\n")
+}
@@ -0,0 +1,81 @@
+package gmp
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func namedWorker() {
+	Sleep(time.Second)
+}
+
+func TestStackAll(t *testing.T) {
+	initVirtual(t, 1)
+
+	var dump string
+	Go(namedWorker)
+	Go(func() {
+		Go(func() {}) // 留在 runnext 中
+		Sleep(time.Millisecond)
+		Go(func() {})
+		dump = Stack(true)
+	})
+	Run()
+
+	t.Log("\n" + dump)
+	for _, want := range []string{
+		"[running, M",                        // 当前 G
+		"[sleep, 1ms]:",                      // namedWorker 已经等待了 1ms
+		"go-rem/gmp.namedWorker()",           // 函数名来自 g.fn
+		"created by go-rem/gmp.TestStackAll", // 由测试函数创建
+		"runnext]:",                          // 刚创建的 G 在 runnext 中
+		"in goroutine ",                      // 由另一个 G 创建
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("转储中应该包含 %q", want)
+		}
+	}
+	if !strings.HasPrefix(dump, "goroutine ") || strings.Count(dump, "goroutine ") < 4 {
+		t.Errorf("转储格式错误:\n%s", dump)
+	}
+}
+
+func TestStackCurrentOnly(t *testing.T) {
+	initVirtual(t, 1)
+
+	var dump string
+	var me uint64
+	Go(func() {})
+	Go(func() {
+		me = getg().goid
+		dump = Stack(false)
+	})
+	Run()
+
+	if strings.Count(dump, "goroutine ") != 1 || !strings.HasPrefix(dump, "goroutine ") {
+		t.Errorf("Stack(false) 只应该输出当前 G:\n%s", dump)
+	}
+	if !strings.Contains(dump, "goroutine "+strconv.FormatUint(me, 10)+" [running") {
+		t.Errorf("应该输出当前 G %d:\n%s", me, dump)
+	}
+}
+
+func TestStackOutsideScheduler(t *testing.T) {
+	initVirtual(t, 2)
+
+	Go(func() {})
+	Go(func() {})
+	dump := Stack(true)
+	if strings.Count(dump, "[runnable") != 2 {
+		t.Errorf("调度器之外调用时应该列出所有可运行的 G:\n%s", dump)
+	}
+	if Stack(false) != "" {
+		t.Error("调度器之外没有当前 G")
+	}
+	Run()
+	if Stack(true) != "" {
+		t.Error("所有 G 结束后转储应该为空")
+	}
+}
@@ -1,7 +1,9 @@
 package gmp
 
 import (
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const (
@@ -10,13 +12,13 @@ const (
 	_Grunning
 	_Gwaiting
 	_Gdead
+	_Gsyscall // 正在执行系统调用，见 Syscall
 )
 
 var (
-	g0       *g
-	m0       *m
-	currentG *g
-	sched    Schedt
+	g0    *g
+	m0    *m
+	sched = &defaultSched.sched // 当前装入的调度器实例的状态，见 switchto
 )
 
 type g struct {
@@ -26,6 +28,55 @@ type g struct {
 
 	m  *m
 	g0 *g
+
+	waitreason   waitReason              // status 为 _Gwaiting 时的等待原因
+	waitsince    time.Time               // 开始等待的时间
+	parentGoid   uint64                  // 创建者的 goid，0 表示由 gmp 之外的代码创建
+	gopc         uintptr                 // 创建这个 G 的 Go() 调用位置
+	allgsidx     int                     // 在 sched.allgs 中的下标
+	coro         func() (struct{}, bool) // G 的"栈"：iter.Pull 的 next，调用它切换到 G，nil 表示尚未开始运行
+	yield        func(struct{}) bool     // 协程的 yield，mcall 调用它切回 g0
+	stop         func()                  // 协程的 stop，见 gostop
+	stopped      bool                    // 协程已经被 gostop 结束，gp 不会再运行
+	syscallfn    func()                  // 正在执行的系统调用
+	syscallpanic any                     // 系统调用中的 panic，G 被重新调度后抛出
+	panicarg     any                     // G 以 panic 结束时保存的参数，由 g0 重新抛出
+	runnableat   time.Time               // 变为可运行的时间，用于统计调度延迟
+	racectx      vclock                  // 竞争检测的向量时钟，没有开启时为 nil
+}
+
+// waitReason 说明 G 为什么处于 _Gwaiting（对应 runtime2.go 中的 waitReason）
+type waitReason uint8
+
+const (
+	waitReasonZero              waitReason = iota // ""
+	waitReasonSleep                               // "sleep"
+	waitReasonIOWait                              // "IO wait"
+	waitReasonSemacquire                          // "semacquire"
+	waitReasonSyncMutexLock                       // "sync.Mutex.Lock"
+	waitReasonSyncRWMutexRLock                    // "sync.RWMutex.RLock"
+	waitReasonSyncRWMutexLock                     // "sync.RWMutex.Lock"
+	waitReasonSyncWaitGroupWait                   // "sync.WaitGroup.Wait"
+	waitReasonSyncCondWait                        // "sync.Cond.Wait"
+)
+
+var waitReasonStrings = [...]string{
+	waitReasonZero:              "",
+	waitReasonSleep:             "sleep",
+	waitReasonIOWait:            "IO wait",
+	waitReasonSemacquire:        "semacquire",
+	waitReasonSyncMutexLock:     "sync.Mutex.Lock",
+	waitReasonSyncRWMutexRLock:  "sync.RWMutex.RLock",
+	waitReasonSyncRWMutexLock:   "sync.RWMutex.Lock",
+	waitReasonSyncWaitGroupWait: "sync.WaitGroup.Wait",
+	waitReasonSyncCondWait:      "sync.Cond.Wait",
+}
+
+func (w waitReason) String() string {
+	if int(w) < len(waitReasonStrings) {
+		return waitReasonStrings[w]
+	}
+	return "unknown wait reason"
 }
 
 func newG(task func()) *g {
@@ -44,6 +95,9 @@ type m struct {
 	g0       *g
 	spinning bool
 	link     *m // 用于空闲 M 链表
+	tls      *g // M 上正在运行的 g，只有 sched.curm 的 tls 经过 getg 读取，见 getg
+
+	mcallfn func(*g) // mcall 切回 g0 后要在 g0 上执行的函数
 }
 
 // P 的状态
@@ -60,20 +114,66 @@ type p struct {
 	status   uint32
 	runqhead uint32
 	runqtail uint32
-	runq     [256]*g // 每个p自己的运行队列
+	runq     []*g // 每个p自己的运行队列，长度是 Config.LocalQueueSize
 	runnext  *g
 	m        *m
 	link     *p // 用于空闲 P 链表
+
+	schedtick   uint32    // 每次调度一个 G 加一
+	schedwhen   time.Time // 当前时间片的开始时间，见 findrunnable
+	syscalltick uint32    // 每次系统调用加一
+	stats       pstats    // 指标计数器，见 ReadMetrics
+
+	tracebuf []traceEvent // 执行追踪的事件缓冲区
 }
 
 type Schedt struct {
-	goidgen   atomic.Uint64
-	mnext     int64
-	maxmcount int32
-	runq      []*g //全局运行队列
-	pidle     *p   // 空闲的 P 链表
-	midle     *m   // 空间的 M 链表
-	npidle    atomic.Int32
-	allp      []*p
-	allm      []*m
+	// lock 保护调度器的全部状态（队列、G/M/P 的状态、定时器）。
+	// 用户 G 的代码运行时不持有它。
+	lock sync.Mutex
+
+	goidgen    atomic.Uint64
+	mnext      int64
+	maxmcount  int32
+	runq       []*g //全局运行队列
+	pidle      *p   // 空闲的 P 链表
+	midle      *m   // 空间的 M 链表
+	npidle     atomic.Int32
+	nmspinning int32 // 自旋（正在找工作）的 M 数量
+	allp       []*p
+	allm       []*m
+	allgs      []*g // 所有还没有结束的 G
+	mcursor    int  // 调度循环轮转到的 M 下标
+
+	running    bool // schedule 循环是否正在运行（对应 runtime 的 mainStarted）
+	background bool // 调度循环由 Start 在后台启动，空闲时等待新的工作而不是返回
+	shutdown   bool // Shutdown 已经调用，不再接受调度器之外提交的 G
+	curm       *m   // 正在调度器上执行的 M，nil 表示调度循环空闲
+
+	cfg      Config
+	clock    Clock
+	timers   timerHeap
+	timerseq uint64 // 最近加入的定时器的序号
+
+	netpollq []*g // 已就绪、等待被 netpoll 取走的 G
+
+	semtable [semTabSize]semaRoot // 信号量表，见 sema_rem.go
+
+	nsyscall int32         // 正在执行系统调用的 G 的数量
+	wakeup   chan struct{} // 唤醒空闲等待中的调度循环（对应 runtime 的 note）
+
+	trace traceState
+
+	debug          dbgvars   // GMPDEBUG
+	starttime      time.Time // schedinit 的时间，schedtrace 从这里开始计时
+	nextschedtrace time.Time
+
+	deadlock *DeadlockError // 最近一次 schedule 检测到的死锁
+	fatal    *SchedError    // 使调度停止的致命错误，见 schedfatal
+
+	lastfind findInfo // 最近一次 findrunnable 从哪里找到了 G，用于 Step 的事件
+
+	decide  decider       // 调度决定的种子、录制和回放
+	explore *exploreState // Explore 正在记录的运行，nil 表示没有在探索
+	race    raceState     // 数据竞争检测器
 }
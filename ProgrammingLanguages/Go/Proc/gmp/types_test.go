@@ -94,6 +94,7 @@ func TestExecuteG(t *testing.T) {
 
 // Phase 1: 测试 getg() 和 setg()
 func TestGetgSetg(t *testing.T) {
+	ownengine(t)
 	// 先初始化 g0 和 m0
 	initG0M0()
 
@@ -120,8 +121,50 @@ func TestGetgSetg(t *testing.T) {
 	}
 }
 
+// 每个 M 有自己的 g，切换 M 不会覆盖其他 M 的 g
+func TestGetgPerM(t *testing.T) {
+	ownengine(t)
+	initG0M0()
+	mp := allocm()
+
+	setm(mp)
+	if getg() != mp.g0 {
+		t.Error("新的 M 应该运行在自己的 g0 上")
+	}
+	newg := newG(func() {})
+	setg(newg)
+
+	setm(m0)
+	if getg() != g0 {
+		t.Error("在另一个 M 上 setg 不应该影响 m0")
+	}
+	setm(mp)
+	if getg() != newg {
+		t.Error("切换回来后应该得到 M 自己的 g")
+	}
+
+	// 与调度器并行运行的 goroutine 不在任何 M 上，读不到调度器当前的 M 的 g
+	other := newg
+	done := make(chan struct{})
+	go func() {
+		other = getg()
+		close(done)
+	}()
+	<-done
+	if other != nil {
+		t.Error("不是 owner 的 goroutine 调用 getg() 应该返回 nil")
+	}
+
+	setm(nil)
+	if getg() != nil {
+		t.Error("没有 M 时 getg() 应该返回 nil")
+	}
+	setm(m0)
+}
+
 // Phase 1: 测试 g0 和 m0 的初始化
 func TestInitG0M0(t *testing.T) {
+	ownengine(t)
 	initG0M0()
 
 	// 验证 g0
@@ -159,10 +202,11 @@ func TestInitG0M0(t *testing.T) {
 
 // Phase 1: 测试 schedinit
 func TestSchedinit(t *testing.T) {
+	ownengine(t)
 	// 重置全局变量
 	g0 = nil
 	m0 = nil
-	currentG = nil
+	sched.curm = nil
 
 	// 调用 schedinit
 	schedinit()
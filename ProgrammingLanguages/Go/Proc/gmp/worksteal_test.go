@@ -7,6 +7,7 @@ import (
 // Phase 5: 工作窃取测试
 
 func TestRunqsteal(t *testing.T) {
+	ownengine(t)
 	// 重置
 	g0 = nil
 	m0 = nil
@@ -149,6 +150,7 @@ func TestRunqstealOneG(t *testing.T) {
 }
 
 func TestFindrunableWithSteal(t *testing.T) {
+	ownengine(t)
 	// 重置
 	g0 = nil
 	m0 = nil
@@ -195,6 +197,7 @@ func TestFindrunableWithSteal(t *testing.T) {
 }
 
 func TestWorkStealingBalance(t *testing.T) {
+	ownengine(t)
 	// 重置
 	g0 = nil
 	m0 = nil